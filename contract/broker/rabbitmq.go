@@ -0,0 +1,292 @@
+// Package broker is the RabbitMQ connection both servers exchange commands and
+// events over
+package broker
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+// maxReconnectDelay caps the wait between attempts to reach RabbitMQ again
+const maxReconnectDelay = 30 * time.Second
+
+// RabbitMQ publishes and consumes JSON messages on durable queues, directly
+// or through fanout exchanges that copy each event to every queue bound to
+// them. Messages are persisted by the broker, publishing waits until the broker has taken
+// them, and they are only acknowledged once handled, so none are lost when
+// either side restarts. A dropped connection is re-established
+// in the background and consumers are registered again.
+type RabbitMQ struct {
+	url string
+
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	channel   *amqp.Channel
+	confirms  chan amqp.Confirmation
+	consumers map[string]consumer
+	closed    bool
+}
+
+// consumer is a handler registered on a queue, bound to exchange unless it is
+// empty
+type consumer struct {
+	exchange string
+	handler  func([]byte) error
+}
+
+func NewRabbitMQ(url string) (*RabbitMQ, error) {
+	r := &RabbitMQ{url: url, consumers: map[string]consumer{}}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.connect(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *RabbitMQ) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+	r.channel.Close()
+	r.conn.Close()
+}
+
+// PublishMessage sends message to the one queue named queueName
+func (r *RabbitMQ) PublishMessage(queueName string, message interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	q, err := declareQueue(r.channel, queueName)
+	if err != nil {
+		return err
+	}
+	if err := r.publish("", q.Name, message); err != nil {
+		return err
+	}
+	log.Printf("Sent message to queue %s", queueName)
+	return nil
+}
+
+// PublishEvent sends message to every queue bound to the fanout exchange named
+// exchangeName. It is dropped when no queue is bound yet.
+func (r *RabbitMQ) PublishEvent(exchangeName string, message interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := declareExchange(r.channel, exchangeName); err != nil {
+		return err
+	}
+	if err := r.publish(exchangeName, "", message); err != nil {
+		return err
+	}
+	log.Printf("Sent event to exchange %s", exchangeName)
+	return nil
+}
+
+// publish sends message and waits for the broker to confirm it. The caller
+// must hold mu.
+func (r *RabbitMQ) publish(exchangeName, routingKey string, message interface{}) error {
+	body, err := json.Marshal(message)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %v", err)
+	}
+
+	err = r.channel.Publish(
+		exchangeName, // exchange
+		routingKey,   // routing key
+		false,        // mandatory
+		false,        // immediate
+		amqp.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp.Persistent,
+			Body:         body,
+		})
+	if err != nil {
+		return fmt.Errorf("failed to publish a message: %v", err)
+	}
+	confirm, ok := <-r.confirms
+	if !ok {
+		return fmt.Errorf("failed to publish a message: channel closed before the broker confirmed it")
+	}
+	if !confirm.Ack {
+		return fmt.Errorf("failed to publish a message: rejected by the broker")
+	}
+	return nil
+}
+
+// ConsumeMessages calls handler with every message arriving on queueName, one
+// at a time. A message is acknowledged when handler succeeds and delivered
+// again when it fails, so handlers must cope with seeing a message twice.
+func (r *RabbitMQ) ConsumeMessages(queueName string, handler func([]byte) error) error {
+	return r.register(queueName, consumer{handler: handler})
+}
+
+// Subscribe binds the durable queue queueName to the fanout exchange named
+// exchangeName and consumes it like ConsumeMessages. Each subscriber uses its
+// own queue, so every one of them receives every event, including those
+// published while it was down.
+func (r *RabbitMQ) Subscribe(exchangeName, queueName string, handler func([]byte) error) error {
+	return r.register(queueName, consumer{exchange: exchangeName, handler: handler})
+}
+
+func (r *RabbitMQ) register(queueName string, c consumer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.consume(queueName, c); err != nil {
+		return err
+	}
+	r.consumers[queueName] = c
+	log.Printf("Waiting for messages in queue %s", queueName)
+	return nil
+}
+
+// connect dials RabbitMQ and starts watching the new connection. The caller
+// must hold mu.
+func (r *RabbitMQ) connect() error {
+	conn, err := amqp.Dial(r.url)
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open a channel: %v", err)
+	}
+	// Hand consumers one unacknowledged message at a time
+	if err := ch.Qos(1, 0, false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to set channel prefetch: %v", err)
+	}
+	// Have the broker confirm every message it takes responsibility for
+	if err := ch.Confirm(false); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+
+	r.conn = conn
+	r.channel = ch
+	r.confirms = ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+	go r.watch(conn.NotifyClose(make(chan *amqp.Error, 1)), ch.NotifyClose(make(chan *amqp.Error, 1)))
+	return nil
+}
+
+// watch waits for the connection or its channel to close and, unless Close
+// was called, reconnects with a growing delay
+func (r *RabbitMQ) watch(connClosed, channelClosed chan *amqp.Error) {
+	var reason *amqp.Error
+	select {
+	case reason = <-connClosed:
+	case reason = <-channelClosed:
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.conn.Close()
+	log.Printf("Lost connection to RabbitMQ: %v", reason)
+
+	for delay := time.Second; ; delay *= 2 {
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+		r.mu.Unlock()
+		time.Sleep(delay)
+		r.mu.Lock()
+		if r.closed {
+			return
+		}
+		if err := r.connect(); err != nil {
+			log.Printf("Reconnecting to RabbitMQ failed: %v", err)
+			continue
+		}
+		for queueName, c := range r.consumers {
+			if err := r.consume(queueName, c); err != nil {
+				log.Printf("Failed to resume consuming %s: %v", queueName, err)
+			}
+		}
+		log.Println("Reconnected to RabbitMQ")
+		return
+	}
+}
+
+// consume starts delivering queueName's messages to the handler of c, binding
+// the queue to its exchange first. The caller must hold mu.
+func (r *RabbitMQ) consume(queueName string, c consumer) error {
+	q, err := declareQueue(r.channel, queueName)
+	if err != nil {
+		return err
+	}
+	if c.exchange != "" {
+		if err := declareExchange(r.channel, c.exchange); err != nil {
+			return err
+		}
+		if err := r.channel.QueueBind(q.Name, "", c.exchange, false, nil); err != nil {
+			return fmt.Errorf("failed to bind queue %s to exchange %s: %v", q.Name, c.exchange, err)
+		}
+	}
+
+	msgs, err := r.channel.Consume(
+		q.Name, // queue
+		"",     // consumer
+		false,  // auto-ack
+		false,  // exclusive
+		false,  // no-local
+		false,  // no-wait
+		nil,    // args
+	)
+	if err != nil {
+		return fmt.Errorf("failed to register a consumer: %v", err)
+	}
+
+	go func() {
+		for d := range msgs {
+			if err := c.handler(d.Body); err != nil {
+				log.Printf("Error processing message, requeueing it: %v", err)
+				// Give whatever failed a moment before the message comes back
+				time.Sleep(time.Second)
+				d.Nack(false, true)
+				continue
+			}
+			d.Ack(false)
+		}
+	}()
+	return nil
+}
+
+func declareQueue(ch *amqp.Channel, queueName string) (amqp.Queue, error) {
+	q, err := ch.QueueDeclare(
+		queueName, // name
+		true,      // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		nil,       // arguments
+	)
+	if err != nil {
+		return q, fmt.Errorf("failed to declare a queue: %v", err)
+	}
+	return q, nil
+}
+
+func declareExchange(ch *amqp.Channel, exchangeName string) error {
+	err := ch.ExchangeDeclare(
+		exchangeName, // name
+		"fanout",     // type
+		true,         // durable
+		false,        // auto-deleted
+		false,        // internal
+		false,        // no-wait
+		nil,          // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare an exchange: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+module library-contract
+
+go 1.22.5
+
+require (
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/streadway/amqp v1.1.0
+	gorm.io/gorm v1.25.12
+)
+
+require (
+	github.com/jinzhu/inflection v1.0.0 // indirect
+	github.com/jinzhu/now v1.1.5 // indirect
+	golang.org/x/text v0.14.0 // indirect
+)
@@ -0,0 +1,177 @@
+// Package session stores the server side of login sessions: rotating refresh
+// tokens and the access tokens revoked by logging out. Each server owns its
+// accounts; the owner of a token is an admin on the library-server and a user
+// on the order-server.
+package session
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused means a refresh token was presented after it had
+	// been exchanged for another, so it leaked and every session of its owner
+	// should be revoked
+	ErrRefreshTokenReused = errors.New("refresh token was already used")
+)
+
+// RefreshToken is a long-lived token an account exchanges for a new access
+// token. Only a hash of the token is stored. Each token is used once; using it
+// marks it revoked and links it to the token that replaced it.
+type RefreshToken struct {
+	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	OwnerID      uint       `gorm:"not null;index" json:"owner_id"`
+	TokenHash    string     `gorm:"not null;unique" json:"-"`
+	ExpiresAt    time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at,omitempty"`
+	ReplacedByID *uint      `json:"replaced_by_id,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// RevokedToken is an access token that was logged out before it expired. It
+// can be forgotten once ExpiresAt has passed.
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+// IssueRefreshToken stores a new refresh token for ownerID, valid for
+// REFRESH_TOKEN_TTL (default 30 days), and returns it with its ID. Refresh
+// tokens of the owner that have expired are forgotten.
+func IssueRefreshToken(tx *gorm.DB, ownerID uint) (string, uint, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", 0, err
+	}
+	if err := tx.Where("owner_id = ? AND expires_at < ?", ownerID, time.Now()).Delete(&RefreshToken{}).Error; err != nil {
+		return "", 0, err
+	}
+	stored := RefreshToken{
+		OwnerID:   ownerID,
+		TokenHash: HashToken(token),
+		ExpiresAt: time.Now().Add(TTL("REFRESH_TOKEN_TTL", 30*24*time.Hour)),
+	}
+	if err := tx.Create(&stored).Error; err != nil {
+		return "", 0, err
+	}
+	return token, stored.ID, nil
+}
+
+// UseRefreshToken locks the stored refresh token and checks that it can be
+// exchanged. A token that was already exchanged for another is returned
+// together with ErrRefreshTokenReused, so the caller can revoke its owner's
+// sessions; one revoked by logging out is merely invalid.
+func UseRefreshToken(tx *gorm.DB, refreshToken string) (*RefreshToken, error) {
+	var stored RefreshToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ?", HashToken(refreshToken)).
+		Take(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.RevokedAt != nil && stored.ReplacedByID != nil {
+		return &stored, ErrRefreshTokenReused
+	}
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+	return &stored, nil
+}
+
+// RotateRefreshToken replaces a refresh token returned by UseRefreshToken with
+// a new one for the same owner and returns the new token
+func RotateRefreshToken(tx *gorm.DB, stored *RefreshToken) (string, error) {
+	next, nextID, err := IssueRefreshToken(tx, stored.OwnerID)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	err = tx.Model(stored).Updates(map[string]interface{}{"revoked_at": &now, "replaced_by_id": nextID}).Error
+	if err != nil {
+		return "", err
+	}
+	return next, nil
+}
+
+// RevokeRefreshTokens revokes every refresh token of ownerID
+func RevokeRefreshTokens(tx *gorm.DB, ownerID uint) error {
+	return tx.Model(&RefreshToken{}).
+		Where("owner_id = ? AND revoked_at IS NULL", ownerID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// DeleteRefreshTokens forgets every refresh token of ownerID, for an account
+// that is deleted
+func DeleteRefreshTokens(tx *gorm.DB, ownerID uint) error {
+	return tx.Where("owner_id = ?", ownerID).Delete(&RefreshToken{}).Error
+}
+
+// Logout revokes the access token identified by jti and, when given, the
+// refresh token of the same session as long as it belongs to ownerID
+func Logout(tx *gorm.DB, ownerID uint, jti string, expiresAt time.Time, refreshToken string) error {
+	err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&RevokedToken{JTI: jti, ExpiresAt: expiresAt}).Error
+	if err != nil {
+		return err
+	}
+	if refreshToken == "" {
+		return nil
+	}
+	return tx.Model(&RefreshToken{}).
+		Where("token_hash = ? AND owner_id = ? AND revoked_at IS NULL", HashToken(refreshToken), ownerID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// AccessTokenRevoked reports whether the access token identified by jti was logged out
+func AccessTokenRevoked(db *gorm.DB, jti string) (bool, error) {
+	var revoked int64
+	if err := db.Model(&RevokedToken{}).Where("jti = ?", jti).Count(&revoked).Error; err != nil {
+		return false, err
+	}
+	return revoked > 0, nil
+}
+
+// PurgeExpired forgets revoked access tokens and refresh tokens that have
+// expired and can no longer be used anyway
+func PurgeExpired(db *gorm.DB, now time.Time) error {
+	if err := db.Where("expires_at < ?", now).Delete(&RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return db.Where("expires_at < ?", now).Delete(&RefreshToken{}).Error
+}
+
+// TTL reads a token lifetime from envVar as a Go duration
+func TTL(envVar string, fallback time.Duration) time.Duration {
+	if parsed, err := time.ParseDuration(os.Getenv(envVar)); err == nil && parsed > 0 {
+		return parsed
+	}
+	return fallback
+}
+
+// RandomToken returns size random bytes encoded for use in URLs
+func RandomToken(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// HashToken is how tokens are stored, so a leaked table cannot be used to log in
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,192 @@
+// Package signing signs and verifies the Ed25519 (EdDSA) access tokens the
+// library-server and order-server issue, and publishes and fetches their
+// public keys as JSON Web Key Sets.
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is an Ed25519 key identified by its RFC 7638 thumbprint. Retired keys
+// have no private half; they only verify tokens issued before a rotation.
+type Key struct {
+	ID         string
+	PrivateKey ed25519.PrivateKey
+	PublicKey  ed25519.PublicKey
+}
+
+// JWK is the public half of a signing key in JSON Web Key form
+type JWK struct {
+	KeyType   string `json:"kty"`
+	Curve     string `json:"crv"`
+	X         string `json:"x"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet holds the key a server signs new tokens with and the retired keys
+// whose tokens it still accepts. It is not modified after loading and is safe
+// for concurrent use.
+type KeySet struct {
+	issuer  string
+	current *Key
+	keys    map[string]*Key
+}
+
+// LoadKeySet reads the key new tokens are signed with from the PEM file at
+// JWT_SIGNING_KEY and the keys it replaced from the comma-separated PEM files
+// in JWT_RETIRED_KEYS. To rotate, point JWT_SIGNING_KEY at a new key and move
+// the old one to JWT_RETIRED_KEYS until its tokens have expired. Without
+// JWT_SIGNING_KEY a throwaway key is generated, which suits development only.
+// Tokens are only accepted with issuer as their iss claim.
+func LoadKeySet(issuer string) (*KeySet, error) {
+	set := &KeySet{issuer: issuer, keys: map[string]*Key{}}
+
+	if path := os.Getenv("JWT_SIGNING_KEY"); path != "" {
+		key, err := readKey(path)
+		if err != nil {
+			return nil, err
+		}
+		if key.PrivateKey == nil {
+			return nil, fmt.Errorf("%s holds a public key, JWT_SIGNING_KEY needs a private key", path)
+		}
+		set.current = key
+	} else {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		set.current = newKey(private, public)
+		log.Println("JWT_SIGNING_KEY is not set, signing tokens with a temporary key that is lost on restart")
+	}
+	set.keys[set.current.ID] = set.current
+
+	for _, path := range strings.Split(os.Getenv("JWT_RETIRED_KEYS"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		key, err := readKey(path)
+		if err != nil {
+			return nil, err
+		}
+		// Retired keys never sign again
+		key.PrivateKey = nil
+		set.keys[key.ID] = key
+	}
+	return set, nil
+}
+
+// Issuer returns the iss claim of the tokens the set signs
+func (s *KeySet) Issuer() string {
+	return s.issuer
+}
+
+// JWKS returns every key that tokens of the set may be signed with
+func (s *KeySet) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range s.keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+	return set
+}
+
+// Sign signs claims with the current key and names the key in the kid header
+func (s *KeySet) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = s.current.ID
+	return token.SignedString(s.current.PrivateKey)
+}
+
+// Parse verifies a token signed with the current or a retired key, issued by
+// the set's issuer and carrying an expiry, and decodes it into claims
+func (s *KeySet) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, s.verificationKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(s.issuer),
+		jwt.WithExpirationRequired())
+}
+
+func (s *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key.PublicKey, nil
+}
+
+// JWK returns the public half of the key
+func (k *Key) JWK() JWK {
+	return JWK{
+		KeyType:   "OKP",
+		Curve:     "Ed25519",
+		X:         base64.RawURLEncoding.EncodeToString(k.PublicKey),
+		KeyID:     k.ID,
+		Use:       "sig",
+		Algorithm: jwt.SigningMethodEdDSA.Alg(),
+	}
+}
+
+func readKey(path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s is not a PEM file", path)
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+		}
+		return newKey(private, private.Public().(ed25519.PublicKey)), nil
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		public, ok := parsed.(ed25519.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("%s is not an Ed25519 key", path)
+		}
+		return newKey(nil, public), nil
+	default:
+		return nil, fmt.Errorf("%s holds an unsupported %s block", path, block.Type)
+	}
+}
+
+func newKey(private ed25519.PrivateKey, public ed25519.PublicKey) *Key {
+	// RFC 7638 thumbprint: the hash of the required members in lexical order
+	x := base64.RawURLEncoding.EncodeToString(public)
+	sum := sha256.Sum256([]byte(`{"crv":"Ed25519","kty":"OKP","x":"` + x + `"}`))
+	return &Key{
+		ID:         base64.RawURLEncoding.EncodeToString(sum[:]),
+		PrivateKey: private,
+		PublicKey:  public,
+	}
+}
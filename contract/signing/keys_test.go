@@ -0,0 +1,114 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// writeKey stores a new Ed25519 private key as PKCS #8 PEM and returns its path
+func writeKey(t *testing.T, name string) string {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func claims(issuer string) jwt.RegisteredClaims {
+	return jwt.RegisteredClaims{
+		Issuer:    issuer,
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey, newKey := writeKey(t, "old.pem"), writeKey(t, "new.pem")
+
+	t.Setenv("JWT_SIGNING_KEY", oldKey)
+	before, err := LoadKeySet("test-issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldToken, err := before.Sign(claims("test-issuer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("JWT_SIGNING_KEY", newKey)
+	t.Setenv("JWT_RETIRED_KEYS", oldKey)
+	after, err := LoadKeySet("test-issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := len(after.JWKS().Keys); got != 2 {
+		t.Fatalf("got %d published keys, want the current and the retired one", got)
+	}
+	if _, err := after.Parse(oldToken, &jwt.RegisteredClaims{}); err != nil {
+		t.Errorf("token signed before the rotation was refused: %v", err)
+	}
+
+	newToken, err := after.Sign(claims("test-issuer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := before.Parse(newToken, &jwt.RegisteredClaims{}); err == nil {
+		t.Error("token signed with the new key verified against the old key set only")
+	}
+
+	otherIssuer, err := after.Sign(claims("someone-else"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := after.Parse(otherIssuer, &jwt.RegisteredClaims{}); !errors.Is(err, jwt.ErrTokenInvalidIssuer) {
+		t.Errorf("token of another issuer returned %v, want ErrTokenInvalidIssuer", err)
+	}
+}
+
+func TestRemoteKeys(t *testing.T) {
+	t.Setenv("JWT_SIGNING_KEY", writeKey(t, "key.pem"))
+	t.Setenv("JWT_RETIRED_KEYS", "")
+	keys, err := LoadKeySet("test-issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(keys.JWKS())
+	}))
+	defer server.Close()
+	token, err := keys.Sign(claims("test-issuer"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := NewRemoteKeys("test-issuer", "TEST_JWKS_URL")
+	if _, err := remote.Parse(token, &jwt.RegisteredClaims{}); !errors.Is(err, ErrNoKeySetURL) {
+		t.Fatalf("got %v without a key set URL, want ErrNoKeySetURL", err)
+	}
+
+	t.Setenv("TEST_JWKS_URL", server.URL)
+	remote = NewRemoteKeys("test-issuer", "TEST_JWKS_URL")
+	if _, err := remote.Parse(token, &jwt.RegisteredClaims{}); err != nil {
+		t.Fatalf("token verified against the published keys was refused: %v", err)
+	}
+}
@@ -0,0 +1,116 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// remoteKeysMaxAge is how long fetched keys are trusted before the key set is
+// fetched again. A token signed with an unknown key triggers an earlier fetch,
+// at most once per remoteKeysMinRefresh.
+const (
+	remoteKeysMaxAge     = time.Hour
+	remoteKeysMinRefresh = time.Minute
+)
+
+// ErrNoKeySetURL is returned for every token while the environment variable
+// naming the remote key set URL is unset
+var ErrNoKeySetURL = errors.New("key set URL is not set")
+
+var jwksClient = &http.Client{Timeout: 5 * time.Second}
+
+// RemoteKeys verifies tokens another server signs against the keys it
+// publishes as a JWK set. Revocations recorded by that server are not visible
+// here; the short lifetime of access tokens bounds that window. It is safe for
+// concurrent use.
+type RemoteKeys struct {
+	issuer string
+	urlEnv string
+
+	mu        sync.Mutex
+	keys      map[string]ed25519.PublicKey
+	fetchedAt time.Time
+}
+
+// NewRemoteKeys accepts tokens of issuer signed with the keys published at the
+// URL in the environment variable urlEnv. The variable is read on every fetch,
+// so it may be set after the RemoteKeys is created.
+func NewRemoteKeys(issuer, urlEnv string) *RemoteKeys {
+	return &RemoteKeys{issuer: issuer, urlEnv: urlEnv}
+}
+
+// Parse verifies a token of the remote issuer carrying an expiry and decodes
+// it into claims
+func (r *RemoteKeys) Parse(tokenString string, claims jwt.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, r.verificationKey,
+		jwt.WithValidMethods([]string{jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(r.issuer),
+		jwt.WithExpirationRequired())
+}
+
+func (r *RemoteKeys) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[kid]
+	stale := time.Since(r.fetchedAt) > remoteKeysMaxAge
+	if (!ok || stale) && time.Since(r.fetchedAt) > remoteKeysMinRefresh {
+		keys, err := r.fetch()
+		switch {
+		case err == nil:
+			r.keys, r.fetchedAt = keys, time.Now()
+			key, ok = keys[kid]
+		case !ok:
+			return nil, err
+		}
+		// A stale key that is still known keeps working while the issuer is unreachable
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (r *RemoteKeys) fetch() (map[string]ed25519.PublicKey, error) {
+	url := os.Getenv(r.urlEnv)
+	if url == "" {
+		return nil, fmt.Errorf("%w: %s tokens are not accepted without %s", ErrNoKeySetURL, r.issuer, r.urlEnv)
+	}
+
+	resp, err := jwksClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: unexpected status code %d", url, resp.StatusCode)
+	}
+
+	var set JWKSet
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+	keys := map[string]ed25519.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.KeyType != "OKP" || jwk.Curve != "Ed25519" {
+			continue
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			continue
+		}
+		keys[jwk.KeyID] = ed25519.PublicKey(x)
+	}
+	return keys, nil
+}
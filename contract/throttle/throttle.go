@@ -0,0 +1,173 @@
+// Package throttle protects login endpoints against password guessing. It
+// counts failed logins per account and per client address, locks a subject
+// out once it reaches its threshold and records every lockout.
+package throttle
+
+import (
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Failed logins lock a subject once they reach its threshold. The lock starts
+// at baseLockout and doubles with every further failure up to maxLockout.
+// Failures older than failureWindow are forgotten.
+const (
+	accountLockThreshold = 5
+	ipLockThreshold      = 20
+	baseLockout          = time.Minute
+	maxLockout           = time.Hour
+	failureWindow        = time.Hour
+)
+
+// LoginThrottle counts recent failed logins for one subject, either an
+// account ("account:<username>") or a client address ("ip:<address>")
+type LoginThrottle struct {
+	Subject       string     `gorm:"primaryKey" json:"subject"`
+	Failures      int        `gorm:"not null;default:0" json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until,omitempty"`
+}
+
+type LockoutAction string
+
+const (
+	LockoutActionLocked   LockoutAction = "locked"
+	LockoutActionUnlocked LockoutAction = "unlocked"
+)
+
+// LockoutEvent records a subject being locked out after repeated failed
+// logins, or a library admin lifting the lock
+type LockoutEvent struct {
+	ID          uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	Subject     string        `gorm:"not null;index" json:"subject"`
+	Action      LockoutAction `gorm:"not null" json:"action"`
+	Failures    int           `json:"failures"`
+	LockedUntil *time.Time    `json:"locked_until,omitempty"`
+	IP          string        `json:"ip"`
+	ActorID     *uint         `json:"actor_id,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
+
+// LockedError is returned while the account or address a login comes from is
+// locked out
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return "too many failed login attempts, try again later"
+}
+
+// AccountSubject is the subject failed logins to username are counted against
+func AccountSubject(username string) string {
+	return "account:" + username
+}
+
+// IPSubject is the subject failed logins from ip are counted against
+func IPSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a *LockedError when any of the subjects is locked
+func Check(db *gorm.DB, subjects ...string) error {
+	var throttles []LoginThrottle
+	if err := db.Where("subject IN ? AND locked_until > ?", subjects, time.Now()).Find(&throttles).Error; err != nil {
+		return err
+	}
+	var longest time.Duration
+	for _, throttle := range throttles {
+		if wait := time.Until(*throttle.LockedUntil); wait > longest {
+			longest = wait
+		}
+	}
+	if longest > 0 {
+		return &LockedError{RetryAfter: longest}
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login against the account and the address it
+// came from, locking whichever reaches its threshold. Errors are logged rather
+// than returned so they never change the answer to the login.
+func RecordFailure(db *gorm.DB, username, ip string) {
+	if err := countFailure(db, AccountSubject(username), accountLockThreshold, ip); err != nil {
+		log.Printf("Failed to record login failure for account %q: %v", username, err)
+	}
+	if err := countFailure(db, IPSubject(ip), ipLockThreshold, ip); err != nil {
+		log.Printf("Failed to record login failure for %s: %v", ip, err)
+	}
+}
+
+func countFailure(db *gorm.DB, subject string, threshold int, ip string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&LoginThrottle{Subject: subject}).Error
+		if err != nil {
+			return err
+		}
+		var throttle LoginThrottle
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("subject = ?", subject).Take(&throttle).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if now.Sub(throttle.LastFailureAt) > failureWindow {
+			throttle.Failures = 0
+		}
+		throttle.Failures++
+		throttle.LastFailureAt = now
+
+		if throttle.Failures >= threshold {
+			lockout := maxLockout
+			if shift := throttle.Failures - threshold; shift < 16 && baseLockout<<shift < maxLockout {
+				lockout = baseLockout << shift
+			}
+			until := now.Add(lockout)
+			throttle.LockedUntil = &until
+			log.Printf("Locked out %s for %s after %d failed logins", subject, lockout, throttle.Failures)
+			err := tx.Create(&LockoutEvent{
+				Subject:     subject,
+				Action:      LockoutActionLocked,
+				Failures:    throttle.Failures,
+				LockedUntil: &until,
+				IP:          ip,
+			}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return tx.Save(&throttle).Error
+	})
+}
+
+// Clear forgets the failures of a subject after a successful login
+func Clear(db *gorm.DB, subject string) {
+	if err := db.Where("subject = ?", subject).Delete(&LoginThrottle{}).Error; err != nil {
+		log.Printf("Failed to clear login failures for %s: %v", subject, err)
+	}
+}
+
+// Unlock lifts a lockout on subject and records the admin who lifted it
+func Unlock(db *gorm.DB, subject string, actorID *uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subject = ?", subject).Delete(&LoginThrottle{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&LockoutEvent{
+			Subject: subject,
+			Action:  LockoutActionUnlocked,
+			ActorID: actorID,
+		}).Error
+	})
+}
+
+// Forget deletes the failures and the lockout history of subject, for an
+// account that is deleted
+func Forget(tx *gorm.DB, subject string) error {
+	if err := tx.Where("subject = ?", subject).Delete(&LoginThrottle{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("subject = ?", subject).Delete(&LockoutEvent{}).Error
+}
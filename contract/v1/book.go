@@ -0,0 +1,50 @@
+package v1
+
+import "time"
+
+// Copy statuses
+const (
+	CopyStatusAvailable = "available"
+	CopyStatusPlaced    = "placed"
+	CopyStatusTaken     = "taken"
+	CopyStatusLost      = "lost"
+)
+
+// Book is a title in the library, with its category and copies when they
+// were loaded
+type Book struct {
+	ID              uint      `json:"id"`
+	Title           string    `json:"title"`
+	Author          string    `json:"author"`
+	CategoryID      uint      `json:"category_id"`
+	Category        *Category `json:"category,omitempty"`
+	Copies          []Copy    `json:"copies,omitempty"`
+	TotalCopies     int64     `json:"total_copies"`
+	AvailableCopies int64     `json:"available_copies"`
+}
+
+// Category is the category a book belongs to
+type Category struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// Copy is a physical copy of a book
+type Copy struct {
+	ID        uint      `json:"id"`
+	BookID    uint      `json:"book_id"`
+	Barcode   string    `json:"barcode"`
+	Location  string    `json:"location"`
+	Condition string    `json:"condition"`
+	ItemType  string    `json:"item_type"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// BookPage is one page of book search results
+type BookPage struct {
+	Books []Book `json:"books"`
+	Total int64  `json:"total"`
+	Pages int    `json:"pages"`
+}
@@ -0,0 +1,13 @@
+// Package v1 is version 1 of the API contract between the library-server and
+// the order-server: the bodies the library-server accepts and returns, the
+// error codes it answers with, the messages the two exchange over RabbitMQ and
+// the domain events the library-server publishes. Both servers build their
+// requests and responses from these types, so a change to either side that
+// breaks the other fails to compile instead of silently dropping fields.
+//
+// Fields may be added to a version, but never renamed, retyped or removed;
+// that takes a new version.
+package v1
+
+// Version names this version of the contract
+const Version = "v1"
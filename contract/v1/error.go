@@ -0,0 +1,47 @@
+package v1
+
+// ErrorResponse is the body of every error response. Code is one of the Code
+// constants; callers branch on it rather than on the message.
+type ErrorResponse struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+// MessageResponse is the body of a successful request that returns nothing else
+type MessageResponse struct {
+	Message string `json:"message"`
+}
+
+// Error codes. The first four can be returned by any endpoint.
+const (
+	CodeInvalidRequest           = "invalid_request"
+	CodeUnauthorized             = "unauthorized"
+	CodeForbidden                = "forbidden"
+	CodeInternalError            = "internal_error"
+	CodeBookNotFound             = "book_not_found"
+	CodeBookNotAvailable         = "book_not_available"
+	CodeBookInUse                = "book_in_use"
+	CodeBookHasHistory           = "book_has_history"
+	CodeCopyNotFound             = "copy_not_found"
+	CodeUnknownCopyStatus        = "unknown_copy_status"
+	CodeCopyStatusNotSettable    = "copy_status_not_settable"
+	CodeCopyOnLoan               = "copy_on_loan"
+	CodeCopyInUse                = "copy_in_use"
+	CodeCopyHasHistory           = "copy_has_history"
+	CodeReceiptNotFound          = "receipt_not_found"
+	CodeReceiptNotPending        = "receipt_not_pending"
+	CodeReceiptNotDeletable      = "receipt_not_deletable"
+	CodeUnknownReceiptStatus     = "unknown_receipt_status"
+	CodeInvalidReceiptTransition = "invalid_receipt_transition"
+	CodeReceiptNotOwned          = "receipt_not_owned"
+	CodeRenewalLimitReached      = "renewal_limit_reached"
+	CodeBookHasWaiters           = "book_has_waiters"
+	CodeHoldNotFound             = "hold_not_found"
+	CodeBookAvailable            = "book_available"
+	CodeHoldExists               = "hold_exists"
+	CodeHoldNotWaiting           = "hold_not_waiting"
+	CodePatronHasLoans           = "patron_has_loans"
+	CodePatronOwesFines          = "patron_owes_fines"
+	CodeInvalidAmount            = "invalid_amount"
+	CodeAmountExceedsBalance     = "amount_exceeds_balance"
+)
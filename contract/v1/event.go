@@ -0,0 +1,78 @@
+package v1
+
+import "time"
+
+// Domain event types, published on LibraryEventExchange whenever the library's
+// books or receipts change. Events are delivered at least once; consumers
+// recognise repeats by the message ID.
+const (
+	MessageBookCreated          = "BookCreated"
+	MessageBookDeleted          = "BookDeleted"
+	MessageBookStatusChanged    = "BookStatusChanged"
+	MessageCopyCreated          = "CopyCreated"
+	MessageReceiptCreated       = "ReceiptCreated"
+	MessageReceiptStatusChanged = "ReceiptStatusChanged"
+	MessageReceiptDeleted       = "ReceiptDeleted"
+)
+
+// BookCreated announces a new book and how many copies it came with
+type BookCreated struct {
+	BookID     uint   `json:"book_id"`
+	Title      string `json:"title"`
+	Author     string `json:"author"`
+	CategoryID uint   `json:"category_id"`
+	Copies     int    `json:"copies"`
+}
+
+// BookDeleted announces that a book and all of its copies were removed
+type BookDeleted struct {
+	BookID uint `json:"book_id"`
+}
+
+// BookStatusChanged announces that a copy of a book changed status
+type BookStatusChanged struct {
+	BookID uint   `json:"book_id"`
+	CopyID uint   `json:"copy_id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+}
+
+// CopyCreated announces a new copy of a book. Status is the status it starts
+// in: placed when it went straight to a patron waiting for the book, and
+// available otherwise.
+type CopyCreated struct {
+	BookID uint   `json:"book_id"`
+	CopyID uint   `json:"copy_id"`
+	Status string `json:"status"`
+}
+
+// ReceiptCreated announces a new pending receipt, placed directly or by
+// promoting a hold
+type ReceiptCreated struct {
+	ReceiptID      uint       `json:"receipt_id"`
+	UserID         uint       `json:"user_id"`
+	BookID         uint       `json:"book_id"`
+	CopyID         uint       `json:"copy_id"`
+	Status         string     `json:"status"`
+	PickupDeadline *time.Time `json:"pickup_deadline,omitempty"`
+}
+
+// ReceiptStatusChanged announces that a receipt moved along its lifecycle
+type ReceiptStatusChanged struct {
+	ReceiptID uint   `json:"receipt_id"`
+	UserID    uint   `json:"user_id"`
+	BookID    uint   `json:"book_id"`
+	CopyID    uint   `json:"copy_id"`
+	From      string `json:"from"`
+	To        string `json:"to"`
+}
+
+// ReceiptDeleted announces that a receipt was removed; Status is the status
+// it had
+type ReceiptDeleted struct {
+	ReceiptID uint   `json:"receipt_id"`
+	UserID    uint   `json:"user_id"`
+	BookID    uint   `json:"book_id"`
+	CopyID    uint   `json:"copy_id"`
+	Status    string `json:"status"`
+}
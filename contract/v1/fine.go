@@ -0,0 +1,30 @@
+package v1
+
+import "time"
+
+// Fine ledger entry types
+const (
+	FineEntryFine    = "fine"
+	FineEntryPayment = "payment"
+	FineEntryWaiver  = "waiver"
+)
+
+// FineBalance is what a user owes in fines and the ledger entries behind it
+type FineBalance struct {
+	UserID       uint        `json:"user_id"`
+	BalanceCents int64       `json:"balance_cents"`
+	Entries      []FineEntry `json:"entries"`
+}
+
+// FineEntry is a fine, payment or waiver; payments and waivers have negative
+// amounts. CreatedBy is the admin who recorded a payment or waiver.
+type FineEntry struct {
+	ID          uint      `json:"id"`
+	UserID      uint      `json:"user_id"`
+	ReceiptID   *uint     `json:"receipt_id,omitempty"`
+	Type        string    `json:"type"`
+	AmountCents int64     `json:"amount_cents"`
+	Note        string    `json:"note,omitempty"`
+	CreatedBy   *uint     `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
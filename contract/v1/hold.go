@@ -0,0 +1,30 @@
+package v1
+
+import "time"
+
+// Hold statuses
+const (
+	HoldStatusWaiting   = "waiting"
+	HoldStatusFulfilled = "fulfilled"
+	HoldStatusCanceled  = "canceled"
+)
+
+// PlaceHoldRequest queues a user for the next copy of a book
+type PlaceHoldRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+	BookID uint `json:"book_id" binding:"required"`
+}
+
+// Hold is a user's place in the queue for a book. Position is only set while
+// the hold is waiting, and ReceiptID once it was fulfilled.
+type Hold struct {
+	ID        uint      `json:"id"`
+	UserID    uint      `json:"user_id"`
+	BookID    uint      `json:"book_id"`
+	Book      *Book     `json:"book,omitempty"`
+	Status    string    `json:"status"`
+	Position  int64     `json:"position,omitempty"`
+	ReceiptID *uint     `json:"receipt_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
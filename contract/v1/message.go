@@ -0,0 +1,103 @@
+package v1
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Queues and exchanges the servers exchange messages on
+const (
+	// LibraryCommandQueue carries commands from the order-server to the library-server
+	LibraryCommandQueue = "library.commands"
+	// OrderEventQueue carries the library-server's results back to the order-server
+	OrderEventQueue = "order-server.events"
+	// LibraryEventExchange is the fanout exchange the library-server publishes
+	// its domain events on. Each consumer binds a durable queue of its own to
+	// it, so every consumer sees every event.
+	LibraryEventExchange = "library.events"
+)
+
+// Message types
+const (
+	MessagePlaceReceiptRequested     = "PlaceReceiptRequested"
+	MessageCancelReceiptRequested    = "CancelReceiptRequested"
+	MessageReceiptPlaced             = "ReceiptPlaced"
+	MessageReceiptPlacementFailed    = "ReceiptPlacementFailed"
+	MessageReceiptCanceled           = "ReceiptCanceled"
+	MessageReceiptCancellationFailed = "ReceiptCancellationFailed"
+)
+
+// Message is the envelope of every message sent over RabbitMQ. Payload holds
+// the body named by Type.
+type Message struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Version string          `json:"version"`
+	SentAt  time.Time       `json:"sent_at"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// NewMessage wraps payload in an envelope of messageType with a fresh ID
+func NewMessage(messageType string, payload interface{}) (*Message, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &Message{
+		ID:      hex.EncodeToString(id),
+		Type:    messageType,
+		Version: Version,
+		SentAt:  time.Now().UTC(),
+		Payload: body,
+	}, nil
+}
+
+// PlaceReceiptRequested asks the library-server to reserve a copy of a book.
+// Commands are delivered at least once, so the library-server carries out
+// each RequestID only once and answers repeats with the first result.
+type PlaceReceiptRequested struct {
+	RequestID string `json:"request_id"`
+	UserID    uint   `json:"user_id"`
+	BookID    uint   `json:"book_id"`
+}
+
+// CancelReceiptRequested asks the library-server to cancel one of a user's
+// pending receipts, once per RequestID
+type CancelReceiptRequested struct {
+	RequestID string `json:"request_id"`
+	UserID    uint   `json:"user_id"`
+	ReceiptID uint   `json:"receipt_id"`
+}
+
+// ReceiptPlaced answers a PlaceReceiptRequested that reserved a copy
+type ReceiptPlaced struct {
+	RequestID string  `json:"request_id"`
+	Receipt   Receipt `json:"receipt"`
+}
+
+// ReceiptPlacementFailed answers a PlaceReceiptRequested that was refused
+type ReceiptPlacementFailed struct {
+	RequestID string `json:"request_id"`
+	Error     string `json:"error"`
+	Code      string `json:"code,omitempty"`
+}
+
+// ReceiptCanceled answers a CancelReceiptRequested whose receipt is now canceled
+type ReceiptCanceled struct {
+	RequestID string `json:"request_id"`
+	ReceiptID uint   `json:"receipt_id"`
+}
+
+// ReceiptCancellationFailed answers a CancelReceiptRequested that was refused
+type ReceiptCancellationFailed struct {
+	RequestID string `json:"request_id"`
+	ReceiptID uint   `json:"receipt_id"`
+	Error     string `json:"error"`
+	Code      string `json:"code,omitempty"`
+}
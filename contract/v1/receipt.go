@@ -0,0 +1,50 @@
+package v1
+
+import "time"
+
+// Receipt statuses
+const (
+	ReceiptStatusPending  = "pending"
+	ReceiptStatusOwned    = "owned"
+	ReceiptStatusReturned = "returned"
+	ReceiptStatusCanceled = "canceled"
+	ReceiptStatusLost     = "lost"
+	ReceiptStatusOverdue  = "overdue"
+)
+
+// CreateReceiptRequest reserves an available copy of a book for a user
+type CreateReceiptRequest struct {
+	UserID uint `json:"user_id" binding:"required"`
+	BookID uint `json:"book_id" binding:"required"`
+}
+
+// UpdateReceiptStatusRequest moves a receipt along its lifecycle
+type UpdateReceiptStatusRequest struct {
+	Status string `json:"status" binding:"required"`
+}
+
+// Receipt is a user's reservation or loan of a copy of a book, with the book
+// and copy when they were loaded
+type Receipt struct {
+	ID             uint       `json:"id"`
+	UserID         uint       `json:"user_id"`
+	BookID         uint       `json:"book_id"`
+	Book           *Book      `json:"book,omitempty"`
+	CopyID         uint       `json:"copy_id"`
+	Copy           *Copy      `json:"copy,omitempty"`
+	Status         string     `json:"status"`
+	DueDate        time.Time  `json:"due_date"`
+	Renewals       int        `json:"renewals"`
+	PickupDeadline *time.Time `json:"pickup_deadline,omitempty"`
+	CancelReason   string     `json:"cancel_reason,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+}
+
+// ReceiptPage is one page of all receipts
+type ReceiptPage struct {
+	Receipts   []Receipt `json:"receipts"`
+	TotalCount int64     `json:"total_count"`
+	Page       int       `json:"page"`
+	PageSize   int       `json:"page_size"`
+}
@@ -1,10 +1,13 @@
 package db
 
 import (
+	"errors"
+	"fmt"
+	"library-contract/session"
+	"library-contract/throttle"
 	"library-server/model"
 	"os"
 
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
@@ -24,16 +27,16 @@ func GenerateInitialData() {
 		}
 
 		books := []model.Book{
-			{Title: "The Great Gatsby", Author: "F. Scott Fitzgerald", CategoryID: 1, Location: "A1", Status: model.BookStatusAvailable},
-			{Title: "To Kill a Mockingbird", Author: "Harper Lee", CategoryID: 1, Location: "A2", Status: model.BookStatusAvailable},
-			{Title: "1984", Author: "George Orwell", CategoryID: 1, Location: "A3", Status: model.BookStatusAvailable},
-			{Title: "The Catcher in the Rye", Author: "J.D. Salinger", CategoryID: 1, Location: "A4", Status: model.BookStatusAvailable},
-			{Title: "Sapiens", Author: "Yuval Noah Harari", CategoryID: 2, Location: "B1", Status: model.BookStatusAvailable},
-			{Title: "A Brief History of Time", Author: "Stephen Hawking", CategoryID: 3, Location: "C1", Status: model.BookStatusAvailable},
-			{Title: "The Guns of August", Author: "Barbara Tuchman", CategoryID: 4, Location: "D1", Status: model.BookStatusAvailable},
-			{Title: "Clean Code", Author: "Robert C. Martin", CategoryID: 5, Location: "E1", Status: model.BookStatusAvailable},
-			{Title: "The Pragmatic Programmer", Author: "Andrew Hunt", CategoryID: 5, Location: "E2", Status: model.BookStatusAvailable},
-			{Title: "Design Patterns", Author: "Erich Gamma", CategoryID: 5, Location: "E3", Status: model.BookStatusAvailable},
+			{Title: "The Great Gatsby", Author: "F. Scott Fitzgerald", CategoryID: 1, Copies: seedCopies("A1", 2)},
+			{Title: "To Kill a Mockingbird", Author: "Harper Lee", CategoryID: 1, Copies: seedCopies("A2", 1)},
+			{Title: "1984", Author: "George Orwell", CategoryID: 1, Copies: seedCopies("A3", 3)},
+			{Title: "The Catcher in the Rye", Author: "J.D. Salinger", CategoryID: 1, Copies: seedCopies("A4", 1)},
+			{Title: "Sapiens", Author: "Yuval Noah Harari", CategoryID: 2, Copies: seedCopies("B1", 2)},
+			{Title: "A Brief History of Time", Author: "Stephen Hawking", CategoryID: 3, Copies: seedCopies("C1", 1)},
+			{Title: "The Guns of August", Author: "Barbara Tuchman", CategoryID: 4, Copies: seedCopies("D1", 1)},
+			{Title: "Clean Code", Author: "Robert C. Martin", CategoryID: 5, Copies: seedCopies("E1", 5)},
+			{Title: "The Pragmatic Programmer", Author: "Andrew Hunt", CategoryID: 5, Copies: seedCopies("E2", 2)},
+			{Title: "Design Patterns", Author: "Erich Gamma", CategoryID: 5, Copies: seedCopies("E3", 1)},
 		}
 
 		for _, book := range books {
@@ -42,6 +45,20 @@ func GenerateInitialData() {
 	}
 }
 
+// seedCopies builds n available copies shelved at location, barcoded after it
+func seedCopies(location string, n int) []model.BookCopy {
+	copies := make([]model.BookCopy, 0, n)
+	for i := 1; i <= n; i++ {
+		copies = append(copies, model.BookCopy{
+			Barcode:   fmt.Sprintf("%s-%03d", location, i),
+			Location:  location,
+			Condition: model.CopyConditionGood,
+			Status:    model.BookStatusAvailable,
+		})
+	}
+	return copies
+}
+
 // Call this function after establishing the database connection
 func InitializeDatabase() {
 	Connect()
@@ -49,20 +66,129 @@ func InitializeDatabase() {
 }
 
 func Connect() {
-	db, err := gorm.Open(postgres.Open(os.Getenv("DB_URL")), &gorm.Config{})
+	db, err := Open(os.Getenv("DB_URL"))
 	if err != nil {
 		panic(err)
 	}
-	var adminCount int64
-	db.Raw("SELECT COUNT(*) FROM admins").Scan(&adminCount)
-	if adminCount == 0 {
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte("admin123"), bcrypt.DefaultCost)
-		if err != nil {
-			panic(err)
+	DB = db
+}
+
+// Open connects to the database at url and brings its schema up to date
+func Open(url string) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(url), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+
+	dropLegacyChecks(db)
+	renameRefreshTokenOwner(db, "admin_id")
+	db.AutoMigrate(&model.Role{}, &model.Admin{}, &model.Category{}, &model.Book{}, &model.BookCopy{}, &model.Receipt{}, &model.LoanPolicy{}, &model.Hold{}, &model.FineLedger{}, &session.RefreshToken{}, &session.RevokedToken{}, &throttle.LoginThrottle{}, &throttle.LockoutEvent{}, &model.RecoveryCode{}, &model.ProcessedCommand{}, &model.OutboxEvent{})
+	if err := migrateLegacyBooks(db); err != nil {
+		return nil, err
+	}
+	if err := seedRoles(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// seedRoles creates the built-in staff roles on first start and makes admins
+// that predate roles superadmins, so they keep the access they had. The
+// superadmin role is kept in step with any permissions added since.
+func seedRoles(db *gorm.DB) error {
+	var roleCount int64
+	if err := db.Model(&model.Role{}).Count(&roleCount).Error; err != nil {
+		return err
+	}
+	if roleCount == 0 {
+		roles := []model.Role{
+			{Name: model.RoleSuperadmin, Permissions: model.AllPermissions},
+			{Name: model.RoleLibrarian, Permissions: []string{
+				model.PermissionBooksRead, model.PermissionBooksWrite, model.PermissionCategoriesWrite,
+				model.PermissionLoanPoliciesWrite, model.PermissionReceiptsRead, model.PermissionReceiptsWrite,
+				model.PermissionReceiptsDelete, model.PermissionHoldsRead, model.PermissionHoldsWrite,
+				model.PermissionFinesRead, model.PermissionFinesWrite, model.PermissionPatronsManage,
+			}},
+			{Name: model.RoleCataloguer, Permissions: []string{
+				model.PermissionBooksRead, model.PermissionBooksWrite, model.PermissionCategoriesWrite,
+			}},
+			{Name: model.RoleCirculationDesk, Permissions: []string{
+				model.PermissionBooksRead, model.PermissionReceiptsRead, model.PermissionReceiptsWrite,
+				model.PermissionHoldsRead, model.PermissionHoldsWrite, model.PermissionFinesRead,
+				model.PermissionFinesWrite,
+			}},
+		}
+		if err := db.Create(&roles).Error; err != nil {
+			return err
 		}
-		db.Exec("INSERT INTO admins (username, password) VALUES (?, ?)", "admin", string(hashedPassword))
 	}
 
-	db.AutoMigrate(&model.Admin{}, &model.Book{}, &model.Category{}, &model.Receipt{})
-	DB = db
+	var superadmin model.Role
+	if err := db.Where("name = ?", model.RoleSuperadmin).First(&superadmin).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+	if err := db.Model(&superadmin).Select("Permissions").Updates(model.Role{Permissions: model.AllPermissions}).Error; err != nil {
+		return err
+	}
+	return db.Model(&model.Admin{}).Where("role_id IS NULL").Update("role_id", superadmin.ID).Error
+}
+
+// dropLegacyChecks removes the receipt status check that predates the
+// overdue, canceled and lost statuses, so AutoMigrate can add the wider one
+func dropLegacyChecks(db *gorm.DB) {
+	if db.Migrator().HasConstraint(&model.Receipt{}, "chk_receipts_status") {
+		db.Migrator().DropConstraint(&model.Receipt{}, "chk_receipts_status")
+	}
+}
+
+// renameRefreshTokenOwner renames the column refresh tokens named their admin
+// by before the token store was shared with the order-server
+func renameRefreshTokenOwner(db *gorm.DB, column string) {
+	if db.Migrator().HasColumn(&session.RefreshToken{}, column) {
+		db.Migrator().RenameColumn(&session.RefreshToken{}, column, "owner_id")
+	}
+}
+
+// migrateLegacyBooks converts books created before copies existed, where each
+// row carried its own location and status, into a title with a single copy.
+// Receipts of those books are pointed at the new copy and the old columns dropped.
+func migrateLegacyBooks(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&model.Book{}, "status") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		var legacy []struct {
+			ID       uint
+			Location string
+			Status   model.BookStatus
+		}
+		if err := tx.Raw("SELECT id, location, status FROM books").Scan(&legacy).Error; err != nil {
+			return err
+		}
+
+		for _, book := range legacy {
+			bookCopy := model.BookCopy{
+				BookID:    book.ID,
+				Barcode:   fmt.Sprintf("LEGACY-%d", book.ID),
+				Location:  book.Location,
+				Condition: model.CopyConditionGood,
+				Status:    book.Status,
+			}
+			if err := tx.Create(&bookCopy).Error; err != nil {
+				return err
+			}
+			if err := tx.Exec("UPDATE receipts SET copy_id = ? WHERE book_id = ?", bookCopy.ID, book.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Migrator().DropColumn(&model.Book{}, "location"); err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&model.Book{}, "status")
+	})
 }
@@ -1,109 +0,0 @@
-package adapter
-
-import (
-	"encoding/json"
-	"fmt"
-	"log"
-
-	"github.com/streadway/amqp"
-)
-
-type RabbitMQ struct {
-	conn    *amqp.Connection
-	channel *amqp.Channel
-}
-
-func NewRabbitMQ(url string) (*RabbitMQ, error) {
-	conn, err := amqp.Dial(url)
-	if err != nil {
-		return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
-	}
-
-	ch, err := conn.Channel()
-	if err != nil {
-		return nil, fmt.Errorf("failed to open a channel: %v", err)
-	}
-
-	return &RabbitMQ{
-		conn:    conn,
-		channel: ch,
-	}, nil
-}
-
-func (r *RabbitMQ) Close() {
-	r.channel.Close()
-	r.conn.Close()
-}
-
-func (r *RabbitMQ) PublishMessage(queueName string, message interface{}) error {
-	q, err := r.channel.QueueDeclare(
-		queueName, // name
-		false,     // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare a queue: %v", err)
-	}
-
-	body, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %v", err)
-	}
-
-	err = r.channel.Publish(
-		"",     // exchange
-		q.Name, // routing key
-		false,  // mandatory
-		false,  // immediate
-		amqp.Publishing{
-			ContentType: "application/json",
-			Body:        body,
-		})
-	if err != nil {
-		return fmt.Errorf("failed to publish a message: %v", err)
-	}
-
-	log.Printf("Sent message to queue %s", queueName)
-	return nil
-}
-
-func (r *RabbitMQ) ConsumeMessages(queueName string, handler func([]byte) error) error {
-	q, err := r.channel.QueueDeclare(
-		queueName, // name
-		false,     // durable
-		false,     // delete when unused
-		false,     // exclusive
-		false,     // no-wait
-		nil,       // arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare a queue: %v", err)
-	}
-
-	msgs, err := r.channel.Consume(
-		q.Name, // queue
-		"",     // consumer
-		true,   // auto-ack
-		false,  // exclusive
-		false,  // no-local
-		false,  // no-wait
-		nil,    // args
-	)
-	if err != nil {
-		return fmt.Errorf("failed to register a consumer: %v", err)
-	}
-
-	go func() {
-		for d := range msgs {
-			if err := handler(d.Body); err != nil {
-				log.Printf("Error processing message: %v", err)
-			}
-		}
-	}()
-
-	log.Printf("Waiting for messages in queue %s", queueName)
-	return nil
-}
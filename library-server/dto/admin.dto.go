@@ -0,0 +1,56 @@
+package dto
+
+import (
+	"library-server/model"
+	"time"
+)
+
+// AdminResponse is how an admin account is shown through the API. Passwords,
+// TOTP secrets and token versions never leave the server.
+type AdminResponse struct {
+	ID          uint          `json:"id"`
+	Username    string        `json:"username"`
+	RoleID      *uint         `json:"role_id"`
+	Role        *RoleResponse `json:"role,omitempty"`
+	Disabled    bool          `json:"disabled"`
+	TOTPEnabled bool          `json:"totp_enabled"`
+	CreatedAt   time.Time     `json:"created_at"`
+	UpdatedAt   time.Time     `json:"updated_at"`
+}
+
+// RoleResponse is the role an admin holds together with its permissions
+type RoleResponse struct {
+	ID          uint     `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
+}
+
+// NewAdminResponse converts an admin for the API
+func NewAdminResponse(admin *model.Admin) AdminResponse {
+	response := AdminResponse{
+		ID:          admin.ID,
+		Username:    admin.Username,
+		RoleID:      admin.RoleID,
+		Disabled:    admin.Disabled,
+		TOTPEnabled: admin.TOTPEnabled,
+		CreatedAt:   admin.CreatedAt,
+		UpdatedAt:   admin.UpdatedAt,
+	}
+	if admin.Role != nil {
+		response.Role = &RoleResponse{
+			ID:          admin.Role.ID,
+			Name:        admin.Role.Name,
+			Permissions: admin.Role.Permissions,
+		}
+	}
+	return response
+}
+
+// NewAdminResponses converts a list of admins for the API
+func NewAdminResponses(admins []model.Admin) []AdminResponse {
+	responses := make([]AdminResponse, len(admins))
+	for i := range admins {
+		responses[i] = NewAdminResponse(&admins[i])
+	}
+	return responses
+}
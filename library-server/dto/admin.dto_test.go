@@ -0,0 +1,72 @@
+package dto
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"library-contract/session"
+	"library-server/model"
+)
+
+// secretKeys are parts of JSON keys that would carry a credential
+var secretKeys = []string{"password", "hash", "secret", "token", "code"}
+
+// assertNoSecrets marshals value and fails when any key, at any depth,
+// contains one of secretKeys
+func assertNoSecrets(t *testing.T, name string, value interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshalling %s: %v", name, err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("decoding %s: %v", name, err)
+	}
+	var walk func(path string, node interface{})
+	walk = func(path string, node interface{}) {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			for key, child := range node {
+				for _, secret := range secretKeys {
+					if strings.Contains(strings.ToLower(key), secret) {
+						t.Errorf("%s exposes %s%s", name, path, key)
+					}
+				}
+				walk(path+key+".", child)
+			}
+		case []interface{}:
+			for _, child := range node {
+				walk(path, child)
+			}
+		}
+	}
+	walk("", decoded)
+}
+
+func TestSecretsAreNotSerialised(t *testing.T) {
+	now := time.Now()
+	roleID := uint(1)
+	admin := model.Admin{
+		ID:           1,
+		Username:     "admin",
+		Password:     "$2a$10$hash",
+		RoleID:       &roleID,
+		Role:         &model.Role{ID: roleID, Name: model.RoleSuperadmin, Permissions: model.AllPermissions},
+		TokenVersion: 3,
+		TOTPSecret:   "JBSWY3DPEHPK3PXP",
+		TOTPEnabled:  true,
+		TOTPLastStep: 55000000,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	replacedBy := uint(2)
+
+	assertNoSecrets(t, "model.Admin", admin)
+	assertNoSecrets(t, "model.RecoveryCode", model.RecoveryCode{ID: 1, AdminID: admin.ID, CodeHash: "abc", UsedAt: &now, CreatedAt: now})
+	assertNoSecrets(t, "session.RefreshToken", session.RefreshToken{ID: 1, OwnerID: admin.ID, TokenHash: "abc", ExpiresAt: now, RevokedAt: &now, ReplacedByID: &replacedBy, CreatedAt: now})
+	assertNoSecrets(t, "AdminResponse", NewAdminResponse(&admin))
+	assertNoSecrets(t, "[]AdminResponse", NewAdminResponses([]model.Admin{admin}))
+}
@@ -0,0 +1,64 @@
+package dto
+
+import (
+	"library-server/model"
+
+	apiv1 "library-contract/v1"
+)
+
+// NewBookResponse converts a book, with its category and copies when loaded, for the API
+func NewBookResponse(book *model.Book) apiv1.Book {
+	response := apiv1.Book{
+		ID:              book.ID,
+		Title:           book.Title,
+		Author:          book.Author,
+		CategoryID:      book.CategoryID,
+		TotalCopies:     book.TotalCopies,
+		AvailableCopies: book.AvailableCopies,
+	}
+	if book.Category.ID != 0 {
+		response.Category = &apiv1.Category{ID: book.Category.ID, Name: book.Category.Name}
+	}
+	for i := range book.Copies {
+		response.Copies = append(response.Copies, NewCopyResponse(&book.Copies[i]))
+	}
+	return response
+}
+
+// NewBookPageResponse converts one page of book search results for the API
+func NewBookPageResponse(books []model.Book, total int64, pages int) apiv1.BookPage {
+	return apiv1.BookPage{Books: NewBookResponses(books), Total: total, Pages: pages}
+}
+
+// NewBookResponses converts a list of books for the API
+func NewBookResponses(books []model.Book) []apiv1.Book {
+	responses := make([]apiv1.Book, len(books))
+	for i := range books {
+		responses[i] = NewBookResponse(&books[i])
+	}
+	return responses
+}
+
+// NewCopyResponses converts a list of copies for the API
+func NewCopyResponses(copies []model.BookCopy) []apiv1.Copy {
+	responses := make([]apiv1.Copy, len(copies))
+	for i := range copies {
+		responses[i] = NewCopyResponse(&copies[i])
+	}
+	return responses
+}
+
+// NewCopyResponse converts a copy for the API
+func NewCopyResponse(bookCopy *model.BookCopy) apiv1.Copy {
+	return apiv1.Copy{
+		ID:        bookCopy.ID,
+		BookID:    bookCopy.BookID,
+		Barcode:   bookCopy.Barcode,
+		Location:  bookCopy.Location,
+		Condition: string(bookCopy.Condition),
+		ItemType:  bookCopy.ItemType,
+		Status:    string(bookCopy.Status),
+		CreatedAt: bookCopy.CreatedAt,
+		UpdatedAt: bookCopy.UpdatedAt,
+	}
+}
@@ -0,0 +1,43 @@
+package dto
+
+import (
+	"library-server/model"
+	"library-server/service"
+
+	apiv1 "library-contract/v1"
+)
+
+// NewFineBalanceResponse converts a user's balance and ledger for the API
+func NewFineBalanceResponse(balance *service.FineBalance) apiv1.FineBalance {
+	response := apiv1.FineBalance{
+		UserID:       balance.UserID,
+		BalanceCents: balance.BalanceCents,
+	}
+	for i := range balance.Entries {
+		response.Entries = append(response.Entries, NewFineEntryResponse(&balance.Entries[i]))
+	}
+	return response
+}
+
+// NewFineBalanceResponses converts a list of balances for the API
+func NewFineBalanceResponses(balances []service.FineBalance) []apiv1.FineBalance {
+	responses := make([]apiv1.FineBalance, len(balances))
+	for i := range balances {
+		responses[i] = NewFineBalanceResponse(&balances[i])
+	}
+	return responses
+}
+
+// NewFineEntryResponse converts a ledger entry for the API
+func NewFineEntryResponse(entry *model.FineLedger) apiv1.FineEntry {
+	return apiv1.FineEntry{
+		ID:          entry.ID,
+		UserID:      entry.UserID,
+		ReceiptID:   entry.ReceiptID,
+		Type:        string(entry.Type),
+		AmountCents: entry.AmountCents,
+		Note:        entry.Note,
+		CreatedBy:   entry.CreatedBy,
+		CreatedAt:   entry.CreatedAt,
+	}
+}
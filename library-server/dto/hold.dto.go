@@ -0,0 +1,35 @@
+package dto
+
+import (
+	"library-server/model"
+
+	apiv1 "library-contract/v1"
+)
+
+// NewHoldResponse converts a hold, with its book when loaded, for the API
+func NewHoldResponse(hold *model.Hold) apiv1.Hold {
+	response := apiv1.Hold{
+		ID:        hold.ID,
+		UserID:    hold.UserID,
+		BookID:    hold.BookID,
+		Status:    string(hold.Status),
+		Position:  hold.Position,
+		ReceiptID: hold.ReceiptID,
+		CreatedAt: hold.CreatedAt,
+		UpdatedAt: hold.UpdatedAt,
+	}
+	if hold.Book.ID != 0 {
+		book := NewBookResponse(&hold.Book)
+		response.Book = &book
+	}
+	return response
+}
+
+// NewHoldResponses converts a list of holds for the API
+func NewHoldResponses(holds []model.Hold) []apiv1.Hold {
+	responses := make([]apiv1.Hold, len(holds))
+	for i := range holds {
+		responses[i] = NewHoldResponse(&holds[i])
+	}
+	return responses
+}
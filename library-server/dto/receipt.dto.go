@@ -0,0 +1,52 @@
+package dto
+
+import (
+	"library-server/model"
+
+	apiv1 "library-contract/v1"
+)
+
+// NewReceiptResponse converts a receipt for the API
+func NewReceiptResponse(receipt *model.Receipt) apiv1.Receipt {
+	response := apiv1.Receipt{
+		ID:             receipt.ID,
+		UserID:         receipt.UserID,
+		BookID:         receipt.BookID,
+		CopyID:         receipt.CopyID,
+		Status:         string(receipt.Status),
+		DueDate:        receipt.DueDate,
+		Renewals:       receipt.Renewals,
+		PickupDeadline: receipt.PickupDeadline,
+		CancelReason:   receipt.CancelReason,
+		CreatedAt:      receipt.CreatedAt,
+		UpdatedAt:      receipt.UpdatedAt,
+	}
+	if receipt.Book.ID != 0 {
+		book := NewBookResponse(&receipt.Book)
+		response.Book = &book
+	}
+	if receipt.Copy.ID != 0 {
+		bookCopy := NewCopyResponse(&receipt.Copy)
+		response.Copy = &bookCopy
+	}
+	return response
+}
+
+// NewReceiptResponses converts a list of receipts for the API
+func NewReceiptResponses(receipts []model.Receipt) []apiv1.Receipt {
+	responses := make([]apiv1.Receipt, len(receipts))
+	for i := range receipts {
+		responses[i] = NewReceiptResponse(&receipts[i])
+	}
+	return responses
+}
+
+// NewReceiptPageResponse converts one page of all receipts for the API
+func NewReceiptPageResponse(receipts []model.Receipt, totalCount int64, page, pageSize int) apiv1.ReceiptPage {
+	return apiv1.ReceiptPage{
+		Receipts:   NewReceiptResponses(receipts),
+		TotalCount: totalCount,
+		Page:       page,
+		PageSize:   pageSize,
+	}
+}
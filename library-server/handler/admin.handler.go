@@ -0,0 +1,425 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"library-server/dto"
+	"library-server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminInput represents the request body for creating an admin account
+type AdminInput struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	RoleID   uint   `json:"role_id" binding:"required"`
+}
+
+// AdminRoleInput represents the request body for assigning a role to an admin
+type AdminRoleInput struct {
+	RoleID uint `json:"role_id" binding:"required"`
+}
+
+// PasswordResetInput represents the request body for setting another admin's password
+type PasswordResetInput struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// PasswordChangeInput represents the request body for changing your own password
+type PasswordChangeInput struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// CreateAdmin godoc
+// @Summary Create an admin account
+// @Description Create a staff account with the given role
+// @Tags admins
+// @Accept json
+// @Produce json
+// @Param admin body AdminInput true "Create admin"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 201 {object} dto.AdminResponse
+// @Failure 400 {object} map[string]string "Invalid input, password too short or unknown role"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 409 {object} map[string]string "Username is already taken"
+// @Security BearerAuth
+// @Router /admins [post]
+func CreateAdmin(c *gin.Context) {
+	var input AdminInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	admin, err := service.CreateAdmin(input.Username, input.Password, input.RoleID)
+	if err != nil {
+		respondAdminError(c, err, "Failed to create admin")
+		return
+	}
+	c.JSON(http.StatusCreated, dto.NewAdminResponse(admin))
+}
+
+// GetAllAdmins godoc
+// @Summary Get all admin accounts
+// @Description Get every staff account with its role
+// @Tags admins
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {array} dto.AdminResponse
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Security BearerAuth
+// @Router /admins [get]
+func GetAllAdmins(c *gin.Context) {
+	admins, err := service.GetAllAdmins()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch admins"})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewAdminResponses(admins))
+}
+
+// GetAdminByID godoc
+// @Summary Get an admin account by ID
+// @Description Get a single staff account with its role
+// @Tags admins
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} dto.AdminResponse
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Security BearerAuth
+// @Router /admins/{id} [get]
+func GetAdminByID(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	admin, err := service.GetAdminByID(uint(id))
+	if err != nil {
+		respondAdminError(c, err, "Failed to fetch admin")
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewAdminResponse(admin))
+}
+
+// DisableAdmin godoc
+// @Summary Disable an admin account
+// @Description Stop an admin from logging in. You cannot disable your own account.
+// @Tags admins
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} dto.AdminResponse
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 409 {object} map[string]string "Cannot disable your own account"
+// @Security BearerAuth
+// @Router /admins/{id}/disable [post]
+func DisableAdmin(c *gin.Context) {
+	setAdminDisabled(c, true)
+}
+
+// EnableAdmin godoc
+// @Summary Re-enable an admin account
+// @Description Allow a disabled admin to log in again
+// @Tags admins
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} dto.AdminResponse
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Security BearerAuth
+// @Router /admins/{id}/enable [post]
+func EnableAdmin(c *gin.Context) {
+	setAdminDisabled(c, false)
+}
+
+func setAdminDisabled(c *gin.Context, disabled bool) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	actorID := currentAdminID(c)
+	if actorID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+	admin, err := service.SetAdminDisabled(uint(id), disabled, *actorID)
+	if err != nil {
+		respondAdminError(c, err, "Failed to update admin")
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewAdminResponse(admin))
+}
+
+// UnlockAdmin godoc
+// @Summary Unlock an admin account
+// @Description Lift the lockout placed on an admin account after repeated failed logins
+// @Tags admins
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Security BearerAuth
+// @Router /admins/{id}/unlock [post]
+func UnlockAdmin(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := service.UnlockAdmin(uint(id), currentAdminID(c)); err != nil {
+		respondAdminError(c, err, "Failed to unlock admin")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Admin unlocked successfully"})
+}
+
+// SetAdminRole godoc
+// @Summary Assign a role to an admin
+// @Description Replace the role of a staff account. The admin is logged out of every session.
+// @Tags admins
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Param role body AdminRoleInput true "Role to assign"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} dto.AdminResponse
+// @Failure 400 {object} map[string]string "Unknown role"
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Security BearerAuth
+// @Router /admins/{id}/role [put]
+func SetAdminRole(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var input AdminRoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	admin, err := service.SetAdminRole(uint(id), input.RoleID)
+	if err != nil {
+		respondAdminError(c, err, "Failed to update admin")
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewAdminResponse(admin))
+}
+
+// ResetAdminPassword godoc
+// @Summary Reset an admin's password
+// @Description Set a new password for another staff account
+// @Tags admins
+// @Accept json
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Param password body PasswordResetInput true "New password"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Password too short"
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Security BearerAuth
+// @Router /admins/{id}/password [put]
+func ResetAdminPassword(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var input PasswordResetInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := service.ResetAdminPassword(uint(id), input.Password); err != nil {
+		respondAdminError(c, err, "Failed to reset password")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// ChangeOwnPassword godoc
+// @Summary Change your own password
+// @Description Replace the password of the logged-in admin after checking the current one
+// @Tags admins
+// @Accept json
+// @Produce json
+// @Param password body PasswordChangeInput true "Current and new password"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Current password is incorrect or new password too short"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Security BearerAuth
+// @Router /admins/me/password [put]
+func ChangeOwnPassword(c *gin.Context) {
+	var input PasswordChangeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adminID := currentAdminID(c)
+	if adminID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+	if err := service.ChangeOwnPassword(*adminID, input.CurrentPassword, input.NewPassword); err != nil {
+		respondAdminError(c, err, "Failed to change password")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
+}
+
+// TOTPCodeInput represents a request body carrying a TOTP or recovery code
+type TOTPCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// BeginTOTPEnrollment godoc
+// @Summary Start two-factor enrollment
+// @Description Generate a TOTP secret for the logged-in admin and return it as an otpauth URI and a base64 QR code PNG. It is not used until confirmed.
+// @Tags admins
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} service.TOTPEnrollment
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Already enabled"
+// @Security BearerAuth
+// @Router /admins/me/totp [post]
+func BeginTOTPEnrollment(c *gin.Context) {
+	adminID := currentAdminID(c)
+	if adminID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+	enrollment, err := service.BeginTOTPEnrollment(*adminID)
+	if err != nil {
+		respondAdminError(c, err, "Failed to start enrollment")
+		return
+	}
+	c.JSON(http.StatusOK, enrollment)
+}
+
+// ConfirmTOTPEnrollment godoc
+// @Summary Confirm two-factor enrollment
+// @Description Enable two-factor authentication with a code from the authenticator app and return one-time recovery codes, which are only shown once. Every session is logged out.
+// @Tags admins
+// @Accept json
+// @Produce json
+// @Param code body TOTPCodeInput true "Code from the authenticator app"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} map[string][]string
+// @Failure 400 {object} map[string]string "Invalid code or enrollment not started"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Already enabled"
+// @Security BearerAuth
+// @Router /admins/me/totp/confirm [post]
+func ConfirmTOTPEnrollment(c *gin.Context) {
+	withTOTPCode(c, func(adminID uint, code string) {
+		codes, err := service.ConfirmTOTPEnrollment(adminID, code)
+		if err != nil {
+			respondAdminError(c, err, "Failed to confirm enrollment")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	})
+}
+
+// DisableTOTP godoc
+// @Summary Disable two-factor authentication
+// @Description Turn two-factor authentication off for the logged-in admin, confirmed with a TOTP or recovery code
+// @Tags admins
+// @Accept json
+// @Produce json
+// @Param code body TOTPCodeInput true "TOTP or recovery code"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid code or not enabled"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Security BearerAuth
+// @Router /admins/me/totp/disable [post]
+func DisableTOTP(c *gin.Context) {
+	withTOTPCode(c, func(adminID uint, code string) {
+		if err := service.DisableTOTP(adminID, code); err != nil {
+			respondAdminError(c, err, "Failed to disable two-factor authentication")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+	})
+}
+
+// RegenerateRecoveryCodes godoc
+// @Summary Replace recovery codes
+// @Description Discard the logged-in admin's recovery codes and return new ones, confirmed with a TOTP or recovery code
+// @Tags admins
+// @Accept json
+// @Produce json
+// @Param code body TOTPCodeInput true "TOTP or recovery code"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} map[string][]string
+// @Failure 400 {object} map[string]string "Invalid code or not enabled"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Security BearerAuth
+// @Router /admins/me/totp/recovery-codes [post]
+func RegenerateRecoveryCodes(c *gin.Context) {
+	withTOTPCode(c, func(adminID uint, code string) {
+		codes, err := service.RegenerateRecoveryCodes(adminID, code)
+		if err != nil {
+			respondAdminError(c, err, "Failed to replace recovery codes")
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	})
+}
+
+// ResetAdminTOTP godoc
+// @Summary Reset an admin's two-factor authentication
+// @Description Turn two-factor authentication off for an admin who lost their authenticator and recovery codes. The admin is logged out of every session.
+// @Tags admins
+// @Produce json
+// @Param id path int true "Admin ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Security BearerAuth
+// @Router /admins/{id}/totp/reset [post]
+func ResetAdminTOTP(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := service.ResetAdminTOTP(uint(id)); err != nil {
+		respondAdminError(c, err, "Failed to reset two-factor authentication")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
+
+// withTOTPCode binds a TOTPCodeInput and calls next with the logged-in admin
+func withTOTPCode(c *gin.Context, next func(adminID uint, code string)) {
+	var input TOTPCodeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	adminID := currentAdminID(c)
+	if adminID == nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+	next(*adminID, input.Code)
+}
+
+func respondAdminError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrAdminNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Admin not found"})
+	case errors.Is(err, service.ErrRoleNotFound), errors.Is(err, service.ErrPasswordTooShort), errors.Is(err, service.ErrInvalidCurrentPassword):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidMFACode), errors.Is(err, service.ErrTOTPNotEnrolling), errors.Is(err, service.ErrTOTPNotEnabled):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrAdminExists), errors.Is(err, service.ErrCannotDisableSelf), errors.Is(err, service.ErrTOTPAlreadyEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -1,30 +1,137 @@
 package handler
 
 import (
+	"errors"
 	"library-server/service"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 )
 
 // Login godoc
 // @Summary Login endpoint
-// @Description Authenticate admin and return JWT token
+// @Description Authenticate admin and return a short-lived JWT access token and a refresh token. Admins with two-factor authentication get an mfa_token instead, to be completed at /auth/login/totp.
 // @Tags auth
 // @Accept x-www-form-urlencoded
 // @Produce json
 // @Param username formData string true "Username"
 // @Param password formData string true "Password"
-// @Success 200 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Success 200 {object} service.TokenPair "Logged in, or service.MFAChallenge when a TOTP code is needed"
+// @Failure 401 {object} map[string]string "Invalid username or password"
+// @Failure 429 {object} map[string]string "Too many failed attempts"
 // @Router /auth/login [post]
 func Login(c *gin.Context) {
 	username := c.PostForm("username")
 	password := c.PostForm("password")
-	token, err := service.Login(username, password)
+	tokens, challenge, err := service.Login(username, password, c.ClientIP())
+	if err != nil {
+		respondLoginError(c, err)
+		return
+	}
+	if challenge != nil {
+		c.JSON(http.StatusOK, challenge)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// LoginTOTP godoc
+// @Summary Complete a two-factor login
+// @Description Exchange the mfa_token returned by /auth/login and a TOTP or recovery code for an access token and a refresh token
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param mfa_token formData string true "Login challenge"
+// @Param code formData string true "TOTP code or recovery code"
+// @Success 200 {object} service.TokenPair
+// @Failure 401 {object} map[string]string "Invalid challenge or code"
+// @Failure 429 {object} map[string]string "Too many failed attempts"
+// @Router /auth/login/totp [post]
+func LoginTOTP(c *gin.Context) {
+	tokens, err := service.VerifyLoginCode(c.PostForm("mfa_token"), c.PostForm("code"), c.ClientIP())
 	if err != nil {
+		respondLoginError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+func respondLoginError(c *gin.Context, err error) {
+	var locked *service.LoginLockedError
+	switch {
+	case errors.As(err, &locked):
+		c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrInvalidCredentials), errors.Is(err, service.ErrInvalidMFAChallenge), errors.Is(err, service.ErrInvalidMFACode):
 		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+	}
+}
+
+// Refresh godoc
+// @Summary Refresh an admin session
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be used once; reusing one revokes every session of the admin.
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param refresh_token formData string true "Refresh token"
+// @Success 200 {object} service.TokenPair
+// @Failure 401 {object} map[string]string
+// @Router /auth/refresh [post]
+func Refresh(c *gin.Context) {
+	tokens, err := service.RefreshSession(c.PostForm("refresh_token"))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary Logout endpoint
+// @Description Revoke the access token used for the request and, when given, the refresh token of the same session
+// @Tags auth
+// @Accept x-www-form-urlencoded
+// @Produce json
+// @Param refresh_token formData string false "Refresh token"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/logout [post]
+func Logout(c *gin.Context) {
+	value, _ := c.Get("user")
+	claims, ok := value.(jwt.MapClaims)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		return
+	}
+	id, _ := claims["id"].(float64)
+	jti, _ := claims["jti"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	if err := service.Logout(uint(id), jti, time.Unix(int64(exp), 0), c.PostForm("refresh_token")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
 		return
 	}
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// JWKS godoc
+// @Summary Token signing keys
+// @Description Public keys that admin access tokens are signed with, current and retired, as a JSON Web Key Set
+// @Tags auth
+// @Produce json
+// @Success 200 {object} signing.JWKSet
+// @Router /.well-known/jwks.json [get]
+func JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, service.SigningKeys.JWKS())
 }
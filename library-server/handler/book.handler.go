@@ -1,10 +1,13 @@
 package handler
 
 import (
+	"errors"
 	"math"
 	"net/http"
 	"strconv"
 
+	apiv1 "library-contract/v1"
+	"library-server/dto"
 	"library-server/model"
 	"library-server/service"
 
@@ -20,22 +23,22 @@ import (
 // @Produce json
 // @Param book body model.Book true "Create book"
 // @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
-// @Success 201 {object} model.Book
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string "Unauthorized"
+// @Success 201 {object} v1.Book
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
 // @Security BearerAuth
 // @Router /books [post]
 func CreateBook(c *gin.Context) {
 	var book model.Book
 	if err := c.ShouldBindJSON(&book); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidRequest})
 		return
 	}
 	if err := service.CreateBook(&book); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create book", "code": apiv1.CodeInternalError})
 		return
 	}
-	c.JSON(http.StatusCreated, book)
+	c.JSON(http.StatusCreated, dto.NewBookResponse(&book))
 }
 
 // GetBookByID godoc
@@ -45,19 +48,19 @@ func CreateBook(c *gin.Context) {
 // @Produce json
 // @Param id path int true "Book ID"
 // @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
-// @Success 200 {object} model.Book
-// @Failure 404 {object} map[string]string
-// @Failure 401 {object} map[string]string "Unauthorized"
+// @Success 200 {object} v1.Book
+// @Failure 404 {object} v1.ErrorResponse "Book not found (code book_not_found)"
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
 // @Security BearerAuth
 // @Router /books/{id} [get]
 func GetBookByID(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
 	book, err := service.GetBookByID(uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "code": apiv1.CodeBookNotFound})
 		return
 	}
-	c.JSON(http.StatusOK, book)
+	c.JSON(http.StatusOK, dto.NewBookResponse(book))
 }
 
 // GetAllBooks godoc
@@ -71,10 +74,10 @@ func GetBookByID(c *gin.Context) {
 // @Param author query string false "Filter by author"
 // @Param category query string false "Filter by category name"
 // @Param title query string false "Filter by book title"
-// @Success 200 {object} map[string]interface{} "Contains 'books' array, 'total' count, and 'pages' count"
-// @Failure 400 {object} map[string]string "Bad Request"
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Success 200 {object} v1.BookPage
+// @Failure 400 {object} v1.ErrorResponse "Bad Request"
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Failure 500 {object} v1.ErrorResponse "Internal Server Error"
 // @Security BearerAuth
 // @Router /books [get]
 func GetAllBooks(c *gin.Context) {
@@ -85,23 +88,19 @@ func GetAllBooks(c *gin.Context) {
 	title := c.Query("title")
 
 	if page < 1 || pageSize < 1 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page or pageSize"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page or pageSize", "code": apiv1.CodeInvalidRequest})
 		return
 	}
 
 	books, totalCount, err := service.GetAllBooks(page, pageSize, author, category, title)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books", "code": apiv1.CodeInternalError})
 		return
 	}
 
 	totalPages := int(math.Ceil(float64(totalCount) / float64(pageSize)))
 
-	c.JSON(http.StatusOK, gin.H{
-		"books": books,
-		"total": totalCount,
-		"pages": totalPages,
-	})
+	c.JSON(http.StatusOK, dto.NewBookPageResponse(books, totalCount, totalPages))
 }
 
 // UpdateBook godoc
@@ -113,43 +112,54 @@ func GetAllBooks(c *gin.Context) {
 // @Param id path int true "Book ID"
 // @Param book body model.Book true "Update book"
 // @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
-// @Success 200 {object} model.Book
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 401 {object} map[string]string "Unauthorized"
+// @Success 200 {object} v1.Book
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 404 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
 // @Security BearerAuth
 // @Router /books/{id} [put]
 func UpdateBook(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
 	var book model.Book
 	if err := c.ShouldBindJSON(&book); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidRequest})
 		return
 	}
 	book.ID = uint(id)
 	if err := service.UpdateBook(&book); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "code": apiv1.CodeBookNotFound})
 		return
 	}
-	c.JSON(http.StatusOK, book)
+	c.JSON(http.StatusOK, dto.NewBookResponse(&book))
 }
 
 // DeleteBook godoc
 // @Summary Delete a book
-// @Description Delete a book by its ID
+// @Description Delete a book and all of its copies by its ID. Books with a copy that is not available, or with patrons waiting for one, cannot be deleted, nor can books that were ever borrowed or held.
 // @Tags books
 // @Produce json
 // @Param id path int true "Book ID"
 // @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
 // @Success 204 "No Content"
-// @Failure 404 {object} map[string]string
-// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 404 {object} v1.ErrorResponse
+// @Failure 409 {object} v1.ErrorResponse "Book has copies in use or waiting holds, or a loan history"
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Failure 500 {object} v1.ErrorResponse "Internal Server Error"
 // @Security BearerAuth
 // @Router /books/{id} [delete]
 func DeleteBook(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err := service.DeleteBook(uint(id)); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
+		switch {
+		case errors.Is(err, service.ErrBookNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "code": apiv1.CodeBookNotFound})
+		case errors.Is(err, service.ErrBookInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeBookInUse})
+		case errors.Is(err, service.ErrBookHasHistory):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeBookHasHistory})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete book", "code": apiv1.CodeInternalError})
+		}
 		return
 	}
 	c.Status(http.StatusNoContent)
@@ -162,50 +172,21 @@ func DeleteBook(c *gin.Context) {
 // @Produce json
 // @Param categoryID path int true "Category ID"
 // @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
-// @Success 200 {array} model.Book
-// @Failure 400 {object} map[string]string
-// @Failure 401 {object} map[string]string "Unauthorized"
+// @Success 200 {array} v1.Book
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
 // @Security BearerAuth
 // @Router /books/category/{categoryID} [get]
 func GetBooksByCategory(c *gin.Context) {
 	categoryID, err := strconv.ParseUint(c.Param("categoryID"), 10, 32)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID", "code": apiv1.CodeInvalidRequest})
 		return
 	}
 	books, err := service.GetBooksByCategory(uint(categoryID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch books", "code": apiv1.CodeInternalError})
 		return
 	}
-	c.JSON(http.StatusOK, books)
-}
-
-// UpdateBookStatus godoc
-// @Summary Update book status
-// @Description Update the status of a book
-// @Tags books
-// @Accept json
-// @Produce json
-// @Param id path int true "Book ID"
-// @Param status body model.BookStatus true "New book status"
-// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
-// @Failure 401 {object} map[string]string "Unauthorized"
-// @Security BearerAuth
-// @Router /books/{id}/status [patch]
-func UpdateBookStatus(c *gin.Context) {
-	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
-	var status model.BookStatus
-	if err := c.ShouldBindJSON(&status); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-		return
-	}
-	if err := service.UpdateBookStatus(uint(id), status); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Book not found"})
-		return
-	}
-	c.JSON(http.StatusOK, gin.H{"message": "Book status updated successfully"})
+	c.JSON(http.StatusOK, dto.NewBookResponses(books))
 }
@@ -0,0 +1,225 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	apiv1 "library-contract/v1"
+	"library-server/dto"
+	"library-server/model"
+	"library-server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CopyInput represents the request body for creating or updating a book copy.
+// ItemType defaults to book.
+type CopyInput struct {
+	Barcode   string              `json:"barcode" binding:"required"`
+	Location  string              `json:"location" binding:"required"`
+	Condition model.CopyCondition `json:"condition" binding:"omitempty,oneof=new good fair poor damaged"`
+	ItemType  string              `json:"item_type" binding:"max=32"`
+}
+
+// CreateCopy godoc
+// @Summary Add a copy to a book
+// @Description Register a new physical copy of a book. New copies start out available.
+// @Tags copies
+// @Accept json
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param copy body CopyInput true "Create copy"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 201 {object} v1.Copy
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 404 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Security BearerAuth
+// @Router /books/{id}/copies [post]
+func CreateCopy(c *gin.Context) {
+	bookID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var input CopyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidRequest})
+		return
+	}
+	bookCopy := model.BookCopy{
+		Barcode:   input.Barcode,
+		Location:  input.Location,
+		Condition: input.Condition,
+		ItemType:  input.ItemType,
+	}
+	if err := service.CreateCopy(uint(bookID), &bookCopy); err != nil {
+		if errors.Is(err, service.ErrBookNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "code": apiv1.CodeBookNotFound})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create copy", "code": apiv1.CodeInternalError})
+		return
+	}
+	c.JSON(http.StatusCreated, dto.NewCopyResponse(&bookCopy))
+}
+
+// GetCopiesByBookID godoc
+// @Summary Get the copies of a book
+// @Description Get every physical copy of a book
+// @Tags copies
+// @Produce json
+// @Param id path int true "Book ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {array} v1.Copy
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Failure 500 {object} v1.ErrorResponse "Internal Server Error"
+// @Security BearerAuth
+// @Router /books/{id}/copies [get]
+func GetCopiesByBookID(c *gin.Context) {
+	bookID, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	copies, err := service.GetCopiesByBookID(uint(bookID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch copies", "code": apiv1.CodeInternalError})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewCopyResponses(copies))
+}
+
+// GetCopyByID godoc
+// @Summary Get a copy by ID
+// @Description Get a single physical copy by its ID
+// @Tags copies
+// @Produce json
+// @Param id path int true "Copy ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} v1.Copy
+// @Failure 404 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Security BearerAuth
+// @Router /copies/{id} [get]
+func GetCopyByID(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	bookCopy, err := service.GetCopyByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found", "code": apiv1.CodeCopyNotFound})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewCopyResponse(bookCopy))
+}
+
+// UpdateCopy godoc
+// @Summary Update a copy
+// @Description Update the barcode, location, condition and item type of a copy
+// @Tags copies
+// @Accept json
+// @Produce json
+// @Param id path int true "Copy ID"
+// @Param copy body CopyInput true "Update copy"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} v1.Copy
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 404 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Security BearerAuth
+// @Router /copies/{id} [put]
+func UpdateCopy(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var input CopyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidRequest})
+		return
+	}
+	bookCopy := model.BookCopy{
+		ID:        uint(id),
+		Barcode:   input.Barcode,
+		Location:  input.Location,
+		Condition: input.Condition,
+		ItemType:  input.ItemType,
+	}
+	if bookCopy.Condition == "" {
+		bookCopy.Condition = model.CopyConditionGood
+	}
+	if bookCopy.ItemType == "" {
+		bookCopy.ItemType = model.DefaultItemType
+	}
+	if err := service.UpdateCopy(&bookCopy); err != nil {
+		if errors.Is(err, service.ErrCopyNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found", "code": apiv1.CodeCopyNotFound})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update copy", "code": apiv1.CodeInternalError})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewCopyResponse(&bookCopy))
+}
+
+// DeleteCopy godoc
+// @Summary Delete a copy
+// @Description Delete a copy by its ID. Only available copies that were never borrowed can be deleted.
+// @Tags copies
+// @Produce json
+// @Param id path int true "Copy ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 204 "No Content"
+// @Failure 404 {object} v1.ErrorResponse
+// @Failure 409 {object} v1.ErrorResponse "Copy is not available (code copy_in_use) or was borrowed before (code copy_has_history)"
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Security BearerAuth
+// @Router /copies/{id} [delete]
+func DeleteCopy(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := service.DeleteCopy(uint(id)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrCopyNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found", "code": apiv1.CodeCopyNotFound})
+		case errors.Is(err, service.ErrCopyInUse):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeCopyInUse})
+		case errors.Is(err, service.ErrCopyHasHistory):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeCopyHasHistory})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete copy", "code": apiv1.CodeInternalError})
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// UpdateCopyStatus godoc
+// @Summary Update copy status
+// @Description Mark a copy that no pending, owned or overdue receipt holds as lost, or as available when it is found again. A copy made available goes to the next hold for its book. Copies are only placed or taken by receipts.
+// @Tags copies
+// @Accept json
+// @Produce json
+// @Param id path int true "Copy ID"
+// @Param status body model.BookStatus true "New copy status"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} v1.MessageResponse
+// @Failure 400 {object} v1.ErrorResponse "Unknown status, or placed or taken"
+// @Failure 404 {object} v1.ErrorResponse
+// @Failure 409 {object} v1.ErrorResponse "Copy is held by an active receipt"
+// @Failure 500 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Security BearerAuth
+// @Router /copies/{id}/status [patch]
+func UpdateCopyStatus(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var status model.BookStatus
+	if err := c.ShouldBindJSON(&status); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidRequest})
+		return
+	}
+	if err := service.UpdateCopyStatus(uint(id), status); err != nil {
+		switch {
+		case errors.Is(err, service.ErrUnknownCopyStatus):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeUnknownCopyStatus})
+		case errors.Is(err, service.ErrCopyStatusNotSet):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeCopyStatusNotSettable})
+		case errors.Is(err, service.ErrCopyNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Copy not found", "code": apiv1.CodeCopyNotFound})
+		case errors.Is(err, service.ErrCopyOnLoan):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeCopyOnLoan})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update copy status", "code": apiv1.CodeInternalError})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Copy status updated successfully"})
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"library-server/model"
+	"library-server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CategoryInput represents the request body for creating or renaming a category
+type CategoryInput struct {
+	Name string `json:"name" binding:"required"`
+}
+
+// CreateCategory godoc
+// @Summary Create a new category
+// @Description Create a new category with the input payload
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param category body CategoryInput true "Create category"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 201 {object} model.Category
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Category already exists"
+// @Security BearerAuth
+// @Router /categories [post]
+func CreateCategory(c *gin.Context) {
+	var input CategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category := model.Category{Name: input.Name}
+	if err := service.CreateCategory(&category); err != nil {
+		if errors.Is(err, service.ErrCategoryExists) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create category"})
+		return
+	}
+	c.JSON(http.StatusCreated, category)
+}
+
+// GetAllCategories godoc
+// @Summary Get all categories
+// @Description Get every category with its book count and a breakdown by book status
+// @Tags categories
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {array} service.CategoryWithStats
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Security BearerAuth
+// @Router /categories [get]
+func GetAllCategories(c *gin.Context) {
+	categories, err := service.GetAllCategories()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch categories"})
+		return
+	}
+	c.JSON(http.StatusOK, categories)
+}
+
+// GetCategoryByID godoc
+// @Summary Get a category by ID
+// @Description Get a single category with its book count and a breakdown by book status
+// @Tags categories
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} service.CategoryWithStats
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Security BearerAuth
+// @Router /categories/{id} [get]
+func GetCategoryByID(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	category, err := service.GetCategoryByID(uint(id))
+	if err != nil {
+		if errors.Is(err, service.ErrCategoryNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch category"})
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// RenameCategory godoc
+// @Summary Rename a category
+// @Description Change the name of an existing category
+// @Tags categories
+// @Accept json
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param category body CategoryInput true "New category name"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} model.Category
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "Category already exists"
+// @Security BearerAuth
+// @Router /categories/{id} [put]
+func RenameCategory(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var input CategoryInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	category, err := service.RenameCategory(uint(id), input.Name)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrCategoryNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		case errors.Is(err, service.ErrCategoryExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename category"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, category)
+}
+
+// DeleteCategory godoc
+// @Summary Delete a category
+// @Description Delete a category by its ID. A category that still has books can only be deleted when reassign_to names another category to move them to.
+// @Tags categories
+// @Produce json
+// @Param id path int true "Category ID"
+// @Param reassign_to query int false "Category ID to move the remaining books to"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 204 "No Content"
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Category still has books"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Security BearerAuth
+// @Router /categories/{id} [delete]
+func DeleteCategory(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+
+	var reassignTo *uint
+	if raw := c.Query("reassign_to"); raw != "" {
+		target, err := strconv.ParseUint(raw, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reassign_to category ID"})
+			return
+		}
+		targetID := uint(target)
+		reassignTo = &targetID
+	}
+
+	if err := service.DeleteCategory(uint(id), reassignTo); err != nil {
+		switch {
+		case errors.Is(err, service.ErrCategoryNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		case errors.Is(err, service.ErrCategoryHasBooks):
+			c.JSON(http.StatusConflict, gin.H{"error": "Category still has books; pass reassign_to to move them"})
+		case errors.Is(err, service.ErrInvalidReassignment):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete category"})
+		}
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
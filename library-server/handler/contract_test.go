@@ -0,0 +1,434 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	apiv1 "library-contract/v1"
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/middleware"
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+// contractRouter serves the handlers the order-server relies on at the paths
+// routes registers them under, without authentication
+func contractRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	router.POST("/books", CreateBook)
+	router.GET("/books", GetAllBooks)
+	router.GET("/books/:id", GetBookByID)
+	router.PUT("/books/:id", UpdateBook)
+	router.DELETE("/books/:id", DeleteBook)
+	router.GET("/books/category/:categoryID", GetBooksByCategory)
+	router.POST("/books/:id/copies", CreateCopy)
+	router.GET("/books/:id/copies", GetCopiesByBookID)
+
+	router.GET("/copies/:id", GetCopyByID)
+	router.PUT("/copies/:id", UpdateCopy)
+	router.DELETE("/copies/:id", DeleteCopy)
+	router.PATCH("/copies/:id/status", UpdateCopyStatus)
+
+	router.POST("/receipts", CreateReceipt)
+	router.GET("/receipts", GetAllReceipts)
+	router.GET("/receipts/:id", GetReceiptByID)
+	router.GET("/receipts/user/:user_id", GetReceiptsByUserID)
+	router.PATCH("/receipts/:id/status", UpdateReceiptStatus)
+	router.POST("/receipts/:id/renew", RenewReceipt)
+	router.DELETE("/receipts/:id", DeleteReceipt)
+
+	router.POST("/holds", PlaceHold)
+	router.GET("/holds/:id", GetHoldByID)
+	router.GET("/holds/user/:user_id", GetHoldsByUserID)
+	router.GET("/holds/book/:book_id", GetHoldsByBookID)
+	router.DELETE("/holds/:id", CancelHold)
+
+	router.GET("/fines", GetOutstandingFineBalances)
+	router.GET("/fines/user/:user_id", GetFineBalance)
+	router.POST("/fines/user/:user_id/payments", RecordFinePayment)
+	router.POST("/fines/user/:user_id/waivers", RecordFineWaiver)
+
+	router.DELETE("/patrons/:user_id", AnonymizePatron)
+	return router
+}
+
+// call sends a request with body encoded as JSON, unless it is nil or already a string
+func call(router *gin.Engine, method, path string, body interface{}) *httptest.ResponseRecorder {
+	var payload []byte
+	switch body := body.(type) {
+	case nil:
+	case string:
+		payload = []byte(body)
+	default:
+		payload, _ = json.Marshal(body)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+// expect checks the status of a response and decodes its body strictly into
+// v: unknown fields are refused and every field without omitempty must be there
+func expect(t *testing.T, rec *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("got status %d, want %d: %s", rec.Code, status, rec.Body)
+	}
+	if v == nil {
+		if rec.Body.Len() != 0 {
+			t.Errorf("want an empty body, got %s", rec.Body)
+		}
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(rec.Body.Bytes()))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		t.Fatalf("body does not match %T: %v: %s", v, err, rec.Body)
+	}
+	var raw interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &raw); err != nil {
+		t.Fatal(err)
+	}
+	requireFields(t, reflect.TypeOf(v).Elem().String(), reflect.TypeOf(v).Elem(), raw)
+}
+
+// expectError checks that a response is an error carrying code
+func expectError(t *testing.T, rec *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var body apiv1.ErrorResponse
+	expect(t, rec, status, &body)
+	if body.Code != code {
+		t.Errorf("got code %q, want %q", body.Code, code)
+	}
+	if body.Error == "" {
+		t.Error("error message is empty")
+	}
+}
+
+func requireFields(t *testing.T, path string, typ reflect.Type, raw interface{}) {
+	t.Helper()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	switch typ.Kind() {
+	case reflect.Slice:
+		items, _ := raw.([]interface{})
+		for i, item := range items {
+			requireFields(t, fmt.Sprintf("%s[%d]", path, i), typ.Elem(), item)
+		}
+	case reflect.Struct:
+		object, ok := raw.(map[string]interface{})
+		if !ok || typ == reflect.TypeOf(time.Time{}) {
+			return
+		}
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" || name == "" {
+				continue
+			}
+			value, present := object[name]
+			if !present {
+				if !strings.Contains(options, "omitempty") {
+					t.Errorf("%s.%s is missing", path, name)
+				}
+				continue
+			}
+			requireFields(t, path+"."+name, field.Type, value)
+		}
+	}
+}
+
+// createBook stores a book in a new category with the given number of
+// available copies
+func createBook(t *testing.T, copies int) model.Book {
+	t.Helper()
+	category := model.Category{Name: fmt.Sprintf("Category for %s", t.Name())}
+	if err := db.DB.Create(&category).Error; err != nil {
+		t.Fatal(err)
+	}
+	book := model.Book{Title: "Dune", Author: "Frank Herbert", CategoryID: category.ID}
+	for i := 1; i <= copies; i++ {
+		book.Copies = append(book.Copies, model.BookCopy{
+			Barcode:   fmt.Sprintf("C%d-%03d", category.ID, i),
+			Location:  "A1",
+			Condition: model.CopyConditionGood,
+			Status:    model.BookStatusAvailable,
+		})
+	}
+	if err := db.DB.Create(&book).Error; err != nil {
+		t.Fatal(err)
+	}
+	return book
+}
+
+// placeReceipt reserves a copy of book for userID through the API
+func placeReceipt(t *testing.T, router *gin.Engine, userID, bookID uint) apiv1.Receipt {
+	t.Helper()
+	var receipt apiv1.Receipt
+	expect(t, call(router, http.MethodPost, "/receipts", apiv1.CreateReceiptRequest{UserID: userID, BookID: bookID}), http.StatusCreated, &receipt)
+	return receipt
+}
+
+func setReceiptStatus(t *testing.T, router *gin.Engine, id uint, status string) {
+	t.Helper()
+	var message apiv1.MessageResponse
+	path := fmt.Sprintf("/receipts/%d/status", id)
+	expect(t, call(router, http.MethodPatch, path, apiv1.UpdateReceiptStatusRequest{Status: status}), http.StatusOK, &message)
+}
+
+func TestBookContract(t *testing.T) {
+	dbtest.Connect(t, "handler_test")
+	router := contractRouter()
+	book := createBook(t, 2)
+
+	t.Run("get", func(t *testing.T) {
+		var body apiv1.Book
+		expect(t, call(router, http.MethodGet, fmt.Sprintf("/books/%d", book.ID), nil), http.StatusOK, &body)
+		if body.TotalCopies != 2 || len(body.Copies) != 2 {
+			t.Errorf("got %d total copies and %d copies, want 2", body.TotalCopies, len(body.Copies))
+		}
+		expectError(t, call(router, http.MethodGet, "/books/999999", nil), http.StatusNotFound, apiv1.CodeBookNotFound)
+	})
+	t.Run("list", func(t *testing.T) {
+		var page apiv1.BookPage
+		expect(t, call(router, http.MethodGet, "/books?page=1&pageSize=5", nil), http.StatusOK, &page)
+		expectError(t, call(router, http.MethodGet, "/books?page=0", nil), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+
+		var books []apiv1.Book
+		expect(t, call(router, http.MethodGet, fmt.Sprintf("/books/category/%d", book.CategoryID), nil), http.StatusOK, &books)
+		expectError(t, call(router, http.MethodGet, "/books/category/abc", nil), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+	})
+	t.Run("create and update", func(t *testing.T) {
+		var created apiv1.Book
+		input := map[string]interface{}{"title": "Emma", "author": "Jane Austen", "category_id": book.CategoryID}
+		expect(t, call(router, http.MethodPost, "/books", input), http.StatusCreated, &created)
+		expectError(t, call(router, http.MethodPost, "/books", "{"), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+
+		var updated apiv1.Book
+		expect(t, call(router, http.MethodPut, fmt.Sprintf("/books/%d", created.ID), input), http.StatusOK, &updated)
+		expectError(t, call(router, http.MethodPut, fmt.Sprintf("/books/%d", created.ID), "{"), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+	})
+	t.Run("delete", func(t *testing.T) {
+		lent := createBook(t, 1)
+		receipt := placeReceipt(t, router, 1, lent.ID)
+		expectError(t, call(router, http.MethodDelete, fmt.Sprintf("/books/%d", lent.ID), nil), http.StatusConflict, apiv1.CodeBookInUse)
+		setReceiptStatus(t, router, receipt.ID, apiv1.ReceiptStatusCanceled)
+		expectError(t, call(router, http.MethodDelete, fmt.Sprintf("/copies/%d", lent.Copies[0].ID), nil), http.StatusConflict, apiv1.CodeCopyHasHistory)
+		expectError(t, call(router, http.MethodDelete, fmt.Sprintf("/books/%d", lent.ID), nil), http.StatusConflict, apiv1.CodeBookHasHistory)
+		expectError(t, call(router, http.MethodDelete, "/books/999999", nil), http.StatusNotFound, apiv1.CodeBookNotFound)
+		expect(t, call(router, http.MethodDelete, fmt.Sprintf("/books/%d", book.ID), nil), http.StatusNoContent, nil)
+	})
+}
+
+func TestCopyContract(t *testing.T) {
+	dbtest.Connect(t, "handler_test")
+	router := contractRouter()
+	book := createBook(t, 1)
+	copyPath := fmt.Sprintf("/copies/%d", book.Copies[0].ID)
+
+	t.Run("create and list", func(t *testing.T) {
+		var created apiv1.Copy
+		input := CopyInput{Barcode: "NEW-001", Location: "B2"}
+		expect(t, call(router, http.MethodPost, fmt.Sprintf("/books/%d/copies", book.ID), input), http.StatusCreated, &created)
+		if created.ItemType != model.DefaultItemType {
+			t.Errorf("got item type %q, want %q", created.ItemType, model.DefaultItemType)
+		}
+		expectError(t, call(router, http.MethodPost, "/books/999999/copies", input), http.StatusNotFound, apiv1.CodeBookNotFound)
+		expectError(t, call(router, http.MethodPost, fmt.Sprintf("/books/%d/copies", book.ID), CopyInput{}), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+
+		var copies []apiv1.Copy
+		expect(t, call(router, http.MethodGet, fmt.Sprintf("/books/%d/copies", book.ID), nil), http.StatusOK, &copies)
+	})
+	t.Run("get and update", func(t *testing.T) {
+		var got apiv1.Copy
+		expect(t, call(router, http.MethodGet, copyPath, nil), http.StatusOK, &got)
+		expectError(t, call(router, http.MethodGet, "/copies/999999", nil), http.StatusNotFound, apiv1.CodeCopyNotFound)
+
+		var updated apiv1.Copy
+		input := CopyInput{Barcode: got.Barcode, Location: "Z9", ItemType: "dvd"}
+		expect(t, call(router, http.MethodPut, copyPath, input), http.StatusOK, &updated)
+		expectError(t, call(router, http.MethodPut, "/copies/999999", input), http.StatusNotFound, apiv1.CodeCopyNotFound)
+		expectError(t, call(router, http.MethodPut, copyPath, CopyInput{}), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+	})
+	t.Run("status", func(t *testing.T) {
+		var message apiv1.MessageResponse
+		expect(t, call(router, http.MethodPatch, copyPath+"/status", `"lost"`), http.StatusOK, &message)
+		expectError(t, call(router, http.MethodPatch, copyPath+"/status", `"shredded"`), http.StatusBadRequest, apiv1.CodeUnknownCopyStatus)
+		expectError(t, call(router, http.MethodPatch, copyPath+"/status", `{`), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+		expectError(t, call(router, http.MethodPatch, "/copies/999999/status", `"lost"`), http.StatusNotFound, apiv1.CodeCopyNotFound)
+
+		lent := createBook(t, 1)
+		placeReceipt(t, router, 1, lent.ID)
+		lentPath := fmt.Sprintf("/copies/%d", lent.Copies[0].ID)
+		expectError(t, call(router, http.MethodPatch, lentPath+"/status", `"available"`), http.StatusConflict, apiv1.CodeCopyOnLoan)
+		expectError(t, call(router, http.MethodDelete, lentPath, nil), http.StatusConflict, apiv1.CodeCopyInUse)
+	})
+	t.Run("delete", func(t *testing.T) {
+		var message apiv1.MessageResponse
+		expect(t, call(router, http.MethodPatch, copyPath+"/status", `"available"`), http.StatusOK, &message)
+		expect(t, call(router, http.MethodDelete, copyPath, nil), http.StatusNoContent, nil)
+		expectError(t, call(router, http.MethodDelete, copyPath, nil), http.StatusNotFound, apiv1.CodeCopyNotFound)
+	})
+}
+
+func TestReceiptContract(t *testing.T) {
+	dbtest.Connect(t, "handler_test")
+	router := contractRouter()
+	book := createBook(t, 1)
+
+	receipt := placeReceipt(t, router, 1, book.ID)
+	if receipt.Status != apiv1.ReceiptStatusPending {
+		t.Errorf("got a %s receipt, want a pending one", receipt.Status)
+	}
+	path := fmt.Sprintf("/receipts/%d", receipt.ID)
+
+	t.Run("create", func(t *testing.T) {
+		expectError(t, call(router, http.MethodPost, "/receipts", apiv1.CreateReceiptRequest{UserID: 2, BookID: book.ID}), http.StatusConflict, apiv1.CodeBookNotAvailable)
+		expectError(t, call(router, http.MethodPost, "/receipts", apiv1.CreateReceiptRequest{UserID: 2, BookID: 999999}), http.StatusNotFound, apiv1.CodeBookNotFound)
+		expectError(t, call(router, http.MethodPost, "/receipts", apiv1.CreateReceiptRequest{}), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+	})
+	t.Run("get and list", func(t *testing.T) {
+		var got apiv1.Receipt
+		expect(t, call(router, http.MethodGet, path, nil), http.StatusOK, &got)
+		expectError(t, call(router, http.MethodGet, "/receipts/999999", nil), http.StatusNotFound, apiv1.CodeReceiptNotFound)
+
+		var receipts []apiv1.Receipt
+		expect(t, call(router, http.MethodGet, "/receipts/user/1", nil), http.StatusOK, &receipts)
+		if len(receipts) != 1 {
+			t.Errorf("got %d receipts of user 1, want 1", len(receipts))
+		}
+
+		var page apiv1.ReceiptPage
+		expect(t, call(router, http.MethodGet, "/receipts?page=1&page_size=5", nil), http.StatusOK, &page)
+		if page.TotalCount != 1 || len(page.Receipts) != 1 {
+			t.Errorf("got %d of %d receipts, want 1 of 1", len(page.Receipts), page.TotalCount)
+		}
+	})
+	t.Run("status", func(t *testing.T) {
+		expectError(t, call(router, http.MethodPatch, path+"/status", apiv1.UpdateReceiptStatusRequest{Status: "misplaced"}), http.StatusBadRequest, apiv1.CodeUnknownReceiptStatus)
+		expectError(t, call(router, http.MethodPatch, path+"/status", apiv1.UpdateReceiptStatusRequest{}), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+		expectError(t, call(router, http.MethodPatch, path+"/status", apiv1.UpdateReceiptStatusRequest{Status: apiv1.ReceiptStatusReturned}), http.StatusConflict, apiv1.CodeInvalidReceiptTransition)
+		expectError(t, call(router, http.MethodPatch, "/receipts/999999/status", apiv1.UpdateReceiptStatusRequest{Status: apiv1.ReceiptStatusOwned}), http.StatusNotFound, apiv1.CodeReceiptNotFound)
+	})
+	t.Run("renew", func(t *testing.T) {
+		expectError(t, call(router, http.MethodPost, path+"/renew", nil), http.StatusConflict, apiv1.CodeReceiptNotOwned)
+		expectError(t, call(router, http.MethodPost, "/receipts/999999/renew", nil), http.StatusNotFound, apiv1.CodeReceiptNotFound)
+
+		setReceiptStatus(t, router, receipt.ID, apiv1.ReceiptStatusOwned)
+		var renewed apiv1.Receipt
+		expect(t, call(router, http.MethodPost, path+"/renew", nil), http.StatusOK, &renewed)
+		if renewed.Renewals != 1 {
+			t.Errorf("got %d renewals, want 1", renewed.Renewals)
+		}
+	})
+	t.Run("delete", func(t *testing.T) {
+		expectError(t, call(router, http.MethodDelete, path, nil), http.StatusConflict, apiv1.CodeReceiptNotDeletable)
+		setReceiptStatus(t, router, receipt.ID, apiv1.ReceiptStatusOverdue)
+		expectError(t, call(router, http.MethodDelete, path, nil), http.StatusConflict, apiv1.CodeReceiptNotDeletable)
+		setReceiptStatus(t, router, receipt.ID, apiv1.ReceiptStatusReturned)
+
+		var message apiv1.MessageResponse
+		expect(t, call(router, http.MethodDelete, path, nil), http.StatusOK, &message)
+		expectError(t, call(router, http.MethodDelete, path, nil), http.StatusNotFound, apiv1.CodeReceiptNotFound)
+	})
+}
+
+func TestHoldContract(t *testing.T) {
+	dbtest.Connect(t, "handler_test")
+	router := contractRouter()
+	book := createBook(t, 1)
+
+	expectError(t, call(router, http.MethodPost, "/holds", apiv1.PlaceHoldRequest{UserID: 2, BookID: book.ID}), http.StatusConflict, apiv1.CodeBookAvailable)
+	placeReceipt(t, router, 1, book.ID)
+
+	var hold apiv1.Hold
+	expect(t, call(router, http.MethodPost, "/holds", apiv1.PlaceHoldRequest{UserID: 2, BookID: book.ID}), http.StatusCreated, &hold)
+	if hold.Status != apiv1.HoldStatusWaiting || hold.Position != 1 {
+		t.Errorf("got a %s hold at position %d, want waiting at 1", hold.Status, hold.Position)
+	}
+	path := fmt.Sprintf("/holds/%d", hold.ID)
+
+	t.Run("place", func(t *testing.T) {
+		expectError(t, call(router, http.MethodPost, "/holds", apiv1.PlaceHoldRequest{UserID: 2, BookID: book.ID}), http.StatusConflict, apiv1.CodeHoldExists)
+		expectError(t, call(router, http.MethodPost, "/holds", apiv1.PlaceHoldRequest{UserID: 2, BookID: 999999}), http.StatusNotFound, apiv1.CodeBookNotFound)
+		expectError(t, call(router, http.MethodPost, "/holds", apiv1.PlaceHoldRequest{}), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+	})
+	t.Run("get and list", func(t *testing.T) {
+		var got apiv1.Hold
+		expect(t, call(router, http.MethodGet, path, nil), http.StatusOK, &got)
+		expectError(t, call(router, http.MethodGet, "/holds/999999", nil), http.StatusNotFound, apiv1.CodeHoldNotFound)
+
+		var holds []apiv1.Hold
+		expect(t, call(router, http.MethodGet, "/holds/user/2", nil), http.StatusOK, &holds)
+		expect(t, call(router, http.MethodGet, fmt.Sprintf("/holds/book/%d", book.ID), nil), http.StatusOK, &holds)
+		if len(holds) != 1 {
+			t.Errorf("got %d holds in the queue, want 1", len(holds))
+		}
+	})
+	t.Run("cancel", func(t *testing.T) {
+		var message apiv1.MessageResponse
+		expect(t, call(router, http.MethodDelete, path, nil), http.StatusOK, &message)
+		expectError(t, call(router, http.MethodDelete, path, nil), http.StatusConflict, apiv1.CodeHoldNotWaiting)
+		expectError(t, call(router, http.MethodDelete, "/holds/999999", nil), http.StatusNotFound, apiv1.CodeHoldNotFound)
+	})
+}
+
+func TestFineAndPatronContract(t *testing.T) {
+	dbtest.Connect(t, "handler_test")
+	router := contractRouter()
+	const debtor, borrower, leaver = 3, 4, 5
+	if err := db.DB.Create(&model.FineLedger{UserID: debtor, Type: model.FineEntryFine, AmountCents: 500}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("fines", func(t *testing.T) {
+		var balance apiv1.FineBalance
+		expect(t, call(router, http.MethodGet, fmt.Sprintf("/fines/user/%d", debtor), nil), http.StatusOK, &balance)
+		if balance.BalanceCents != 500 {
+			t.Errorf("got a balance of %d, want 500", balance.BalanceCents)
+		}
+		var balances []apiv1.FineBalance
+		expect(t, call(router, http.MethodGet, "/fines", nil), http.StatusOK, &balances)
+
+		payments := fmt.Sprintf("/fines/user/%d/payments", debtor)
+		expectError(t, call(router, http.MethodPost, payments, FineCreditInput{AmountCents: 900}), http.StatusConflict, apiv1.CodeAmountExceedsBalance)
+		expectError(t, call(router, http.MethodPost, payments, FineCreditInput{}), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+		var entry apiv1.FineEntry
+		expect(t, call(router, http.MethodPost, payments, FineCreditInput{AmountCents: 200}), http.StatusCreated, &entry)
+		expect(t, call(router, http.MethodPost, fmt.Sprintf("/fines/user/%d/waivers", debtor), FineCreditInput{AmountCents: 100}), http.StatusCreated, &entry)
+	})
+	t.Run("patrons", func(t *testing.T) {
+		book := createBook(t, 1)
+		placeReceipt(t, router, borrower, book.ID)
+
+		expectError(t, call(router, http.MethodDelete, fmt.Sprintf("/patrons/%d", borrower), nil), http.StatusConflict, apiv1.CodePatronHasLoans)
+		expectError(t, call(router, http.MethodDelete, fmt.Sprintf("/patrons/%d", debtor), nil), http.StatusConflict, apiv1.CodePatronOwesFines)
+		expectError(t, call(router, http.MethodDelete, "/patrons/abc", nil), http.StatusBadRequest, apiv1.CodeInvalidRequest)
+		var message apiv1.MessageResponse
+		expect(t, call(router, http.MethodDelete, fmt.Sprintf("/patrons/%d", leaver), nil), http.StatusOK, &message)
+	})
+}
+
+func TestUnauthenticatedRequestsCarryCode(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/receipts/:id", middleware.AuthenticateServiceOrAdmin(), GetReceiptByID)
+	router.GET("/fines", middleware.Authenticate(), GetOutstandingFineBalances)
+
+	expectError(t, call(router, http.MethodGet, "/receipts/1", nil), http.StatusUnauthorized, apiv1.CodeUnauthorized)
+	expectError(t, call(router, http.MethodGet, "/fines", nil), http.StatusUnauthorized, apiv1.CodeUnauthorized)
+}
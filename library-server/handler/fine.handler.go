@@ -0,0 +1,135 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	apiv1 "library-contract/v1"
+	"library-server/dto"
+	"library-server/model"
+	"library-server/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// FineCreditInput represents the request body for recording a payment or waiver
+type FineCreditInput struct {
+	AmountCents int64  `json:"amount_cents" binding:"required,gt=0"`
+	Note        string `json:"note"`
+}
+
+// GetFineBalance godoc
+// @Summary Get a user's fine balance
+// @Description Get the outstanding fines of a user along with every ledger entry
+// @Tags fines
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {object} v1.FineBalance
+// @Failure 500 {object} v1.ErrorResponse
+// @Router /fines/user/{user_id} [get]
+func GetFineBalance(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	balance, err := service.GetFineBalance(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch fine balance", "code": apiv1.CodeInternalError})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewFineBalanceResponse(balance))
+}
+
+// GetOutstandingFineBalances godoc
+// @Summary Get outstanding fine balances
+// @Description Get the balance of every user that currently owes fines
+// @Tags fines
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {array} v1.FineBalance
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Failure 500 {object} v1.ErrorResponse
+// @Security BearerAuth
+// @Router /fines [get]
+func GetOutstandingFineBalances(c *gin.Context) {
+	balances, err := service.GetOutstandingFineBalances()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch fine balances", "code": apiv1.CodeInternalError})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewFineBalanceResponses(balances))
+}
+
+// RecordFinePayment godoc
+// @Summary Record a fine payment
+// @Description Record a full or partial payment against a user's outstanding fines
+// @Tags fines
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param payment body FineCreditInput true "Payment"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 201 {object} v1.FineEntry
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Failure 409 {object} v1.ErrorResponse "Amount exceeds the outstanding balance (code amount_exceeds_balance)"
+// @Security BearerAuth
+// @Router /fines/user/{user_id}/payments [post]
+func RecordFinePayment(c *gin.Context) {
+	recordFineCredit(c, model.FineEntryPayment)
+}
+
+// RecordFineWaiver godoc
+// @Summary Waive fines
+// @Description Waive all or part of a user's outstanding fines
+// @Tags fines
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param waiver body FineCreditInput true "Waiver"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 201 {object} v1.FineEntry
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Failure 409 {object} v1.ErrorResponse "Amount exceeds the outstanding balance (code amount_exceeds_balance)"
+// @Security BearerAuth
+// @Router /fines/user/{user_id}/waivers [post]
+func RecordFineWaiver(c *gin.Context) {
+	recordFineCredit(c, model.FineEntryWaiver)
+}
+
+func recordFineCredit(c *gin.Context, entryType model.FineEntryType) {
+	userID, _ := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	var input FineCreditInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidRequest})
+		return
+	}
+	entry, err := service.RecordFineCredit(uint(userID), entryType, input.AmountCents, input.Note, currentAdminID(c))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidAmount):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidAmount})
+		case errors.Is(err, service.ErrAmountExceedsBalance):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeAmountExceedsBalance})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record " + string(entryType), "code": apiv1.CodeInternalError})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, dto.NewFineEntryResponse(entry))
+}
+
+// currentAdminID returns the ID of the admin whose token authenticated the request
+func currentAdminID(c *gin.Context) *uint {
+	value, _ := c.Get("user")
+	claims, ok := value.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+	id, ok := claims["id"].(float64)
+	if !ok {
+		return nil
+	}
+	adminID := uint(id)
+	return &adminID
+}
@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	apiv1 "library-contract/v1"
+	"library-server/dto"
+	"library-server/model"
+	"library-server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaceHold godoc
+// @Summary Join the hold queue for a book
+// @Description Add a user to the FIFO queue for a book with no available copies. When a copy is released the first hold in line is turned into a pending receipt with a pickup deadline.
+// @Tags holds
+// @Accept json
+// @Produce json
+// @Param hold body v1.PlaceHoldRequest true "Place hold"
+// @Success 201 {object} v1.Hold
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 404 {object} v1.ErrorResponse "Book not found (code book_not_found)"
+// @Failure 409 {object} v1.ErrorResponse "Book is available or the user is already queued (code book_available or hold_exists)"
+// @Router /holds [post]
+func PlaceHold(c *gin.Context) {
+	var input apiv1.PlaceHoldRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidRequest})
+		return
+	}
+	hold := model.Hold{UserID: input.UserID, BookID: input.BookID}
+	if err := service.PlaceHold(&hold); err != nil {
+		switch {
+		case errors.Is(err, service.ErrBookNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "code": apiv1.CodeBookNotFound})
+		case errors.Is(err, service.ErrBookAvailable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeBookAvailable})
+		case errors.Is(err, service.ErrHoldExists):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeHoldExists})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to place hold", "code": apiv1.CodeInternalError})
+		}
+		return
+	}
+	c.JSON(http.StatusCreated, dto.NewHoldResponse(&hold))
+}
+
+// GetHoldByID godoc
+// @Summary Get a hold by ID
+// @Description Get a single hold, including its queue position while it is waiting
+// @Tags holds
+// @Produce json
+// @Param id path int true "Hold ID"
+// @Success 200 {object} v1.Hold
+// @Failure 404 {object} v1.ErrorResponse "Hold not found (code hold_not_found)"
+// @Router /holds/{id} [get]
+func GetHoldByID(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	hold, err := service.GetHoldByID(uint(id))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Hold not found", "code": apiv1.CodeHoldNotFound})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewHoldResponse(hold))
+}
+
+// GetHoldsByUserID godoc
+// @Summary Get holds by user ID
+// @Description Get all holds of a user with the queue position of those still waiting
+// @Tags holds
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {array} v1.Hold
+// @Failure 500 {object} v1.ErrorResponse
+// @Router /holds/user/{user_id} [get]
+func GetHoldsByUserID(c *gin.Context) {
+	userID, _ := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	holds, err := service.GetHoldsByUserID(uint(userID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch holds", "code": apiv1.CodeInternalError})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewHoldResponses(holds))
+}
+
+// GetHoldsByBookID godoc
+// @Summary Get the hold queue of a book
+// @Description Get the waiting holds of a book in queue order
+// @Tags holds
+// @Produce json
+// @Param book_id path int true "Book ID"
+// @Success 200 {array} v1.Hold
+// @Failure 500 {object} v1.ErrorResponse
+// @Router /holds/book/{book_id} [get]
+func GetHoldsByBookID(c *gin.Context) {
+	bookID, _ := strconv.ParseUint(c.Param("book_id"), 10, 32)
+	holds, err := service.GetHoldsByBookID(uint(bookID))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch holds", "code": apiv1.CodeInternalError})
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewHoldResponses(holds))
+}
+
+// CancelHold godoc
+// @Summary Leave the hold queue
+// @Description Cancel a waiting hold
+// @Tags holds
+// @Produce json
+// @Param id path int true "Hold ID"
+// @Success 200 {object} v1.MessageResponse
+// @Failure 404 {object} v1.ErrorResponse "Hold not found (code hold_not_found)"
+// @Failure 409 {object} v1.ErrorResponse "Hold is no longer waiting (code hold_not_waiting)"
+// @Router /holds/{id} [delete]
+func CancelHold(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := service.CancelHold(uint(id)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrHoldNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Hold not found", "code": apiv1.CodeHoldNotFound})
+		case errors.Is(err, service.ErrHoldNotWaiting):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeHoldNotWaiting})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel hold", "code": apiv1.CodeInternalError})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Hold canceled successfully"})
+}
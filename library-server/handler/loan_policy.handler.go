@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"library-server/model"
+	"library-server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LoanPolicyInput represents the request body for creating or updating a loan policy.
+// Set category_id, item_type or both to scope the policy; a copy is lent under
+// the policy for its category and item type, else its item type, else its
+// category. Leave both empty to configure the library-wide default policy, and
+// max_fine_cents at 0 for no cap on fines.
+type LoanPolicyInput struct {
+	Name            string  `json:"name" binding:"required"`
+	CategoryID      *uint   `json:"category_id"`
+	ItemType        *string `json:"item_type" binding:"omitempty,max=32"`
+	LoanPeriodDays  int     `json:"loan_period_days" binding:"required,min=1"`
+	MaxRenewals     int     `json:"max_renewals" binding:"min=0"`
+	GracePeriodDays int     `json:"grace_period_days" binding:"min=0"`
+	FinePerDayCents int64   `json:"fine_per_day_cents" binding:"min=0"`
+	MaxFineCents    int64   `json:"max_fine_cents" binding:"min=0"`
+}
+
+func (in LoanPolicyInput) toModel(id uint) model.LoanPolicy {
+	itemType := in.ItemType
+	if itemType != nil && *itemType == "" {
+		itemType = nil
+	}
+	return model.LoanPolicy{
+		ID:              id,
+		Name:            in.Name,
+		CategoryID:      in.CategoryID,
+		ItemType:        itemType,
+		LoanPeriodDays:  in.LoanPeriodDays,
+		MaxRenewals:     in.MaxRenewals,
+		GracePeriodDays: in.GracePeriodDays,
+		FinePerDayCents: in.FinePerDayCents,
+		MaxFineCents:    in.MaxFineCents,
+	}
+}
+
+// CreateLoanPolicy godoc
+// @Summary Create a loan policy
+// @Description Create a loan policy for a category, an item type or both, or the library-wide default when both are omitted
+// @Tags loan-policies
+// @Accept json
+// @Produce json
+// @Param policy body LoanPolicyInput true "Create loan policy"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 201 {object} model.LoanPolicy
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "A policy already exists for this category"
+// @Security BearerAuth
+// @Router /loan-policies [post]
+func CreateLoanPolicy(c *gin.Context) {
+	var input LoanPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	policy := input.toModel(0)
+	if err := service.CreateLoanPolicy(&policy); err != nil {
+		respondLoanPolicyError(c, err, "Failed to create loan policy")
+		return
+	}
+	c.JSON(http.StatusCreated, policy)
+}
+
+// GetAllLoanPolicies godoc
+// @Summary Get all loan policies
+// @Description Get every configured loan policy
+// @Tags loan-policies
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {array} model.LoanPolicy
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Security BearerAuth
+// @Router /loan-policies [get]
+func GetAllLoanPolicies(c *gin.Context) {
+	policies, err := service.GetAllLoanPolicies()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch loan policies"})
+		return
+	}
+	c.JSON(http.StatusOK, policies)
+}
+
+// GetLoanPolicyByID godoc
+// @Summary Get a loan policy by ID
+// @Description Get a single loan policy by its ID
+// @Tags loan-policies
+// @Produce json
+// @Param id path int true "Loan policy ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} model.LoanPolicy
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Security BearerAuth
+// @Router /loan-policies/{id} [get]
+func GetLoanPolicyByID(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	policy, err := service.GetLoanPolicyByID(uint(id))
+	if err != nil {
+		respondLoanPolicyError(c, err, "Failed to fetch loan policy")
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdateLoanPolicy godoc
+// @Summary Update a loan policy
+// @Description Update a loan policy with the input payload
+// @Tags loan-policies
+// @Accept json
+// @Produce json
+// @Param id path int true "Loan policy ID"
+// @Param policy body LoanPolicyInput true "Update loan policy"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} model.LoanPolicy
+// @Failure 400 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 409 {object} map[string]string "A policy already exists for this category"
+// @Security BearerAuth
+// @Router /loan-policies/{id} [put]
+func UpdateLoanPolicy(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var input LoanPolicyInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	policy := input.toModel(uint(id))
+	if err := service.UpdateLoanPolicy(&policy); err != nil {
+		respondLoanPolicyError(c, err, "Failed to update loan policy")
+		return
+	}
+	c.JSON(http.StatusOK, policy)
+}
+
+// DeleteLoanPolicy godoc
+// @Summary Delete a loan policy
+// @Description Delete a loan policy by its ID
+// @Tags loan-policies
+// @Produce json
+// @Param id path int true "Loan policy ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 204 "No Content"
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Security BearerAuth
+// @Router /loan-policies/{id} [delete]
+func DeleteLoanPolicy(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := service.DeleteLoanPolicy(uint(id)); err != nil {
+		respondLoanPolicyError(c, err, "Failed to delete loan policy")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondLoanPolicyError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrLoanPolicyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Loan policy not found"})
+	case errors.Is(err, service.ErrCategoryNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrLoanPolicyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
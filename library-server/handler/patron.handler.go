@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	apiv1 "library-contract/v1"
+	"library-server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AnonymizePatron godoc
+// @Summary Anonymize a patron's records
+// @Description Detach a patron's receipts, holds and fines from their user ID once their account is deleted, canceling waiting holds. Patrons with reserved or borrowed books or outstanding fines are refused.
+// @Tags patrons
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} v1.MessageResponse
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 401 {object} v1.ErrorResponse "Unauthorized"
+// @Failure 403 {object} v1.ErrorResponse "Forbidden"
+// @Failure 409 {object} v1.ErrorResponse "Patron has loans or owes fines (code patron_has_loans or patron_owes_fines)"
+// @Security BearerAuth
+// @Router /patrons/{user_id} [delete]
+func AnonymizePatron(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("user_id"), 10, 32)
+	if err != nil || userID == service.AnonymousUserID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID", "code": apiv1.CodeInvalidRequest})
+		return
+	}
+	if err := service.AnonymizePatron(uint(userID)); err != nil {
+		switch {
+		case errors.Is(err, service.ErrPatronHasLoans):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodePatronHasLoans})
+		case errors.Is(err, service.ErrPatronOwesFines):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodePatronOwesFines})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to anonymize patron", "code": apiv1.CodeInternalError})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Patron records anonymized"})
+}
@@ -1,9 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
 
+	apiv1 "library-contract/v1"
+	"library-server/dto"
 	"library-server/model"
 	"library-server/service"
 
@@ -12,25 +15,36 @@ import (
 
 // CreateReceipt godoc
 // @Summary Create a new receipt
-// @Description Create a new receipt with the input payload
+// @Description Reserve an available copy of a book for a user. The receipt always starts out pending.
 // @Tags receipts
 // @Accept json
 // @Produce json
-// @Param receipt body model.receipt true "Create receipt"
-// @Success 201 {object} model.Receipt
-// @Failure 400 {object} map[string]string
+// @Param receipt body v1.CreateReceiptRequest true "Create receipt"
+// @Success 201 {object} v1.Receipt
+// @Failure 400 {object} v1.ErrorResponse
+// @Failure 404 {object} v1.ErrorResponse "Book not found (code book_not_found)"
+// @Failure 409 {object} v1.ErrorResponse "Book is not available (code book_not_available)"
+// @Failure 500 {object} v1.ErrorResponse "Internal Server Error"
 // @Router /receipts [post]
 func CreateReceipt(c *gin.Context) {
-	var receipt model.Receipt
-	if err := c.ShouldBindJSON(&receipt); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var input apiv1.CreateReceiptRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidRequest})
 		return
 	}
+	receipt := model.Receipt{UserID: input.UserID, BookID: input.BookID}
 	if err := service.CreateReceipt(&receipt); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create receipt"})
+		switch {
+		case errors.Is(err, service.ErrBookNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Book not found", "code": apiv1.CodeBookNotFound})
+		case errors.Is(err, service.ErrBookNotAvailable):
+			c.JSON(http.StatusConflict, gin.H{"error": "Book is not available", "code": apiv1.CodeBookNotAvailable})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create receipt", "code": apiv1.CodeInternalError})
+		}
 		return
 	}
-	c.JSON(http.StatusCreated, receipt)
+	c.JSON(http.StatusCreated, dto.NewReceiptResponse(&receipt))
 }
 
 // GetReceiptByID godoc
@@ -39,17 +53,17 @@ func CreateReceipt(c *gin.Context) {
 // @Tags receipts
 // @Produce json
 // @Param id path int true "Receipt ID"
-// @Success 200 {object} model.Receipt
-// @Failure 404 {object} map[string]string
+// @Success 200 {object} v1.Receipt
+// @Failure 404 {object} v1.ErrorResponse "Receipt not found (code receipt_not_found)"
 // @Router /receipts/{id} [get]
 func GetReceiptByID(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
 	receipt, err := service.GetReceiptByID(uint(id))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found"})
+		c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found", "code": apiv1.CodeReceiptNotFound})
 		return
 	}
-	c.JSON(http.StatusOK, receipt)
+	c.JSON(http.StatusOK, dto.NewReceiptResponse(receipt))
 }
 
 // GetReceiptsByUserID godoc
@@ -58,58 +72,109 @@ func GetReceiptByID(c *gin.Context) {
 // @Tags receipts
 // @Produce json
 // @Param user_id path int true "User ID"
-// @Success 200 {array} model.Receipt
-// @Failure 404 {object} map[string]string
+// @Success 200 {array} v1.Receipt
+// @Failure 500 {object} v1.ErrorResponse
 // @Router /receipts/user/{user_id} [get]
 func GetReceiptsByUserID(c *gin.Context) {
 	userID, _ := strconv.ParseUint(c.Param("user_id"), 10, 32)
 	receipts, err := service.GetReceiptByUserID(uint(userID))
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Receipts not found"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch receipts", "code": apiv1.CodeInternalError})
 		return
 	}
-	c.JSON(http.StatusOK, receipts)
+	c.JSON(http.StatusOK, dto.NewReceiptResponses(receipts))
 }
 
 // UpdateReceiptStatus godoc
 // @Summary Update a receipt's status
-// @Description Update the status of an existing receipt
+// @Description Move a receipt along its lifecycle: pending to owned or canceled, owned to overdue, returned or lost, overdue to returned or lost. The copy's status is updated to match.
 // @Tags receipts
 // @Accept json
 // @Produce json
 // @Param id path int true "Receipt ID"
-// @Param status body model.ReceiptStatus true "New receipt status"
-// @Success 200 {object} map[string]string
-// @Failure 400 {object} map[string]string
-// @Failure 404 {object} map[string]string
+// @Param status body v1.UpdateReceiptStatusRequest true "New receipt status"
+// @Success 200 {object} v1.MessageResponse
+// @Failure 400 {object} v1.ErrorResponse "Unknown status (code unknown_receipt_status)"
+// @Failure 404 {object} v1.ErrorResponse "Receipt not found (code receipt_not_found)"
+// @Failure 409 {object} v1.ErrorResponse "Transition not allowed (code invalid_receipt_transition)"
 // @Router /receipts/{id}/status [patch]
 func UpdateReceiptStatus(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
-	var newStatus model.ReceiptStatus
-	if err := c.ShouldBindJSON(&newStatus); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	var input apiv1.UpdateReceiptStatusRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidRequest})
 		return
 	}
-	if err := service.UpdateReceiptStatus(uint(id), newStatus); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to update receipt status"})
+	if err := service.UpdateReceiptStatus(uint(id), model.ReceiptStatus(input.Status)); err != nil {
+		var transitionErr *service.ReceiptTransitionError
+		switch {
+		case errors.Is(err, service.ErrUnknownReceiptStatus):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": apiv1.CodeUnknownReceiptStatus})
+		case errors.Is(err, service.ErrReceiptNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found", "code": apiv1.CodeReceiptNotFound})
+		case errors.As(err, &transitionErr):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeInvalidReceiptTransition})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update receipt status", "code": apiv1.CodeInternalError})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Receipt status updated successfully"})
 }
 
+// RenewReceipt godoc
+// @Summary Renew a receipt
+// @Description Extend the due date of an owned receipt by another loan period. Refused once the loan policy's renewal limit is reached or while another patron is waiting for the book.
+// @Tags receipts
+// @Produce json
+// @Param id path int true "Receipt ID"
+// @Success 200 {object} v1.Receipt
+// @Failure 404 {object} v1.ErrorResponse "Receipt not found (code receipt_not_found)"
+// @Failure 409 {object} v1.ErrorResponse "Renewal refused (code receipt_not_owned, renewal_limit_reached or book_has_waiters)"
+// @Router /receipts/{id}/renew [post]
+func RenewReceipt(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	receipt, err := service.RenewReceipt(uint(id))
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrReceiptNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found", "code": apiv1.CodeReceiptNotFound})
+		case errors.Is(err, service.ErrReceiptNotOwned):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeReceiptNotOwned})
+		case errors.Is(err, service.ErrRenewalLimitReached):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeRenewalLimitReached})
+		case errors.Is(err, service.ErrBookHasWaiters):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeBookHasWaiters})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to renew receipt", "code": apiv1.CodeInternalError})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, dto.NewReceiptResponse(receipt))
+}
+
 // DeleteReceipt godoc
 // @Summary Delete a receipt
-// @Description Delete a receipt by its ID
+// @Description Delete a receipt by its ID. The copy of a pending receipt is released to the next hold or back to the shelf; owned and overdue receipts must be returned or marked lost first.
 // @Tags receipts
 // @Produce json
 // @Param id path int true "Receipt ID"
-// @Success 200 {object} map[string]string
-// @Failure 404 {object} map[string]string
+// @Success 200 {object} v1.MessageResponse
+// @Failure 404 {object} v1.ErrorResponse
+// @Failure 409 {object} v1.ErrorResponse "Receipt is on loan"
+// @Failure 500 {object} v1.ErrorResponse
 // @Router /receipts/{id} [delete]
 func DeleteReceipt(c *gin.Context) {
 	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
 	if err := service.DeleteReceipt(uint(id)); err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Failed to delete receipt"})
+		switch {
+		case errors.Is(err, service.ErrReceiptNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Receipt not found", "code": apiv1.CodeReceiptNotFound})
+		case errors.Is(err, service.ErrReceiptNotDeletable):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": apiv1.CodeReceiptNotDeletable})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete receipt", "code": apiv1.CodeInternalError})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, gin.H{"message": "Receipt deleted successfully"})
@@ -122,8 +187,8 @@ func DeleteReceipt(c *gin.Context) {
 // @Produce json
 // @Param page query int false "Page number"
 // @Param page_size query int false "Page size"
-// @Success 200 {object} map[string]interface{}
-// @Failure 400 {object} map[string]string
+// @Success 200 {object} v1.ReceiptPage
+// @Failure 500 {object} v1.ErrorResponse
 // @Router /receipts [get]
 func GetAllReceipts(c *gin.Context) {
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -131,14 +196,9 @@ func GetAllReceipts(c *gin.Context) {
 
 	receipts, totalCount, err := service.GetAllReceipts(page, pageSize)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch receipts"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch receipts", "code": apiv1.CodeInternalError})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"receipts":    receipts,
-		"total_count": totalCount,
-		"page":        page,
-		"page_size":   pageSize,
-	})
+	c.JSON(http.StatusOK, dto.NewReceiptPageResponse(receipts, totalCount, page, pageSize))
 }
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"library-server/model"
+	"library-server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RoleInput represents the request body for creating or updating a role
+type RoleInput struct {
+	Name        string   `json:"name" binding:"required"`
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// CreateRole godoc
+// @Summary Create a role
+// @Description Create a staff role with a set of permissions
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param role body RoleInput true "Create role"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 201 {object} model.Role
+// @Failure 400 {object} map[string]string "Unknown permission"
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 409 {object} map[string]string "Role already exists"
+// @Security BearerAuth
+// @Router /roles [post]
+func CreateRole(c *gin.Context) {
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role := model.Role{Name: input.Name, Permissions: input.Permissions}
+	if err := service.CreateRole(&role); err != nil {
+		respondRoleError(c, err, "Failed to create role")
+		return
+	}
+	c.JSON(http.StatusCreated, role)
+}
+
+// GetAllRoles godoc
+// @Summary Get all roles
+// @Description Get every staff role and its permissions
+// @Tags roles
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {array} model.Role
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Security BearerAuth
+// @Router /roles [get]
+func GetAllRoles(c *gin.Context) {
+	roles, err := service.GetAllRoles()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+	c.JSON(http.StatusOK, roles)
+}
+
+// GetRoleByID godoc
+// @Summary Get a role by ID
+// @Description Get a single staff role by its ID
+// @Tags roles
+// @Produce json
+// @Param id path int true "Role ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} model.Role
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Security BearerAuth
+// @Router /roles/{id} [get]
+func GetRoleByID(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	role, err := service.GetRoleByID(uint(id))
+	if err != nil {
+		respondRoleError(c, err, "Failed to fetch role")
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// UpdateRole godoc
+// @Summary Update a role
+// @Description Rename a role and replace its permissions. The superadmin role cannot be changed.
+// @Tags roles
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Param role body RoleInput true "Update role"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} model.Role
+// @Failure 400 {object} map[string]string "Unknown permission"
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 409 {object} map[string]string "Role already exists or is protected"
+// @Security BearerAuth
+// @Router /roles/{id} [put]
+func UpdateRole(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	var input RoleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	role := model.Role{ID: uint(id), Name: input.Name, Permissions: input.Permissions}
+	if err := service.UpdateRole(&role); err != nil {
+		respondRoleError(c, err, "Failed to update role")
+		return
+	}
+	c.JSON(http.StatusOK, role)
+}
+
+// DeleteRole godoc
+// @Summary Delete a role
+// @Description Delete a role that is not assigned to any admin. The superadmin role cannot be deleted.
+// @Tags roles
+// @Produce json
+// @Param id path int true "Role ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 204 "No Content"
+// @Failure 404 {object} map[string]string
+// @Failure 401 {object} map[string]string "Unauthorized"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 409 {object} map[string]string "Role is in use or protected"
+// @Security BearerAuth
+// @Router /roles/{id} [delete]
+func DeleteRole(c *gin.Context) {
+	id, _ := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err := service.DeleteRole(uint(id)); err != nil {
+		respondRoleError(c, err, "Failed to delete role")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func respondRoleError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrRoleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+	case errors.Is(err, service.ErrUnknownPermission):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, service.ErrRoleExists), errors.Is(err, service.ErrRoleInUse), errors.Is(err, service.ErrRoleProtected):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fallback})
+	}
+}
@@ -0,0 +1,92 @@
+// Package messaging carries out the commands the order-server sends over
+// RabbitMQ and answers each with a result event
+package messaging
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"library-contract/broker"
+	apiv1 "library-contract/v1"
+	"library-server/dto"
+	"library-server/service"
+)
+
+// StartCommandConsumer handles the commands arriving on the library's command queue
+func StartCommandConsumer(rabbitmq *broker.RabbitMQ) error {
+	return rabbitmq.ConsumeMessages(apiv1.LibraryCommandQueue, func(body []byte) error {
+		return handleCommand(rabbitmq, body)
+	})
+}
+
+// handleCommand carries out one command and publishes its result. Errors are
+// only returned when trying again later may help; the message is then
+// delivered again.
+func handleCommand(rabbitmq *broker.RabbitMQ, body []byte) error {
+	var message apiv1.Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		log.Printf("Dropping malformed command: %v", err)
+		return nil
+	}
+
+	var resultType string
+	var result interface{}
+	var err error
+	switch message.Type {
+	case apiv1.MessagePlaceReceiptRequested:
+		var command apiv1.PlaceReceiptRequested
+		if err := json.Unmarshal(message.Payload, &command); err != nil {
+			log.Printf("Dropping malformed %s %s: %v", message.Type, message.ID, err)
+			return nil
+		}
+		resultType, result, err = placeReceipt(command)
+	case apiv1.MessageCancelReceiptRequested:
+		var command apiv1.CancelReceiptRequested
+		if err := json.Unmarshal(message.Payload, &command); err != nil {
+			log.Printf("Dropping malformed %s %s: %v", message.Type, message.ID, err)
+			return nil
+		}
+		resultType, result, err = cancelReceipt(command)
+	default:
+		log.Printf("Dropping command %s of unknown type %q", message.ID, message.Type)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	reply, err := apiv1.NewMessage(resultType, result)
+	if err != nil {
+		return err
+	}
+	return rabbitmq.PublishMessage(apiv1.OrderEventQueue, reply)
+}
+
+func placeReceipt(command apiv1.PlaceReceiptRequested) (string, interface{}, error) {
+	receipt, err := service.PlaceReceiptOnce(command.RequestID, command.UserID, command.BookID)
+	switch {
+	case err == nil:
+		return apiv1.MessageReceiptPlaced, apiv1.ReceiptPlaced{RequestID: command.RequestID, Receipt: dto.NewReceiptResponse(receipt)}, nil
+	case errors.Is(err, service.ErrBookNotFound):
+		return apiv1.MessageReceiptPlacementFailed, apiv1.ReceiptPlacementFailed{RequestID: command.RequestID, Error: "Book not found", Code: apiv1.CodeBookNotFound}, nil
+	case errors.Is(err, service.ErrBookNotAvailable):
+		return apiv1.MessageReceiptPlacementFailed, apiv1.ReceiptPlacementFailed{RequestID: command.RequestID, Error: "Book is not available", Code: apiv1.CodeBookNotAvailable}, nil
+	default:
+		return "", nil, err
+	}
+}
+
+func cancelReceipt(command apiv1.CancelReceiptRequested) (string, interface{}, error) {
+	err := service.CancelReceiptOnce(command.RequestID, command.UserID, command.ReceiptID)
+	switch {
+	case err == nil:
+		return apiv1.MessageReceiptCanceled, apiv1.ReceiptCanceled{RequestID: command.RequestID, ReceiptID: command.ReceiptID}, nil
+	case errors.Is(err, service.ErrReceiptNotFound):
+		return apiv1.MessageReceiptCancellationFailed, apiv1.ReceiptCancellationFailed{RequestID: command.RequestID, ReceiptID: command.ReceiptID, Error: "Receipt not found", Code: apiv1.CodeReceiptNotFound}, nil
+	case errors.Is(err, service.ErrReceiptNotPending):
+		return apiv1.MessageReceiptCancellationFailed, apiv1.ReceiptCancellationFailed{RequestID: command.RequestID, ReceiptID: command.ReceiptID, Error: err.Error(), Code: apiv1.CodeReceiptNotPending}, nil
+	default:
+		return "", nil, err
+	}
+}
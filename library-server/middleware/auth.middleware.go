@@ -1,8 +1,9 @@
 package middleware
 import (
-	"fmt"
+	"errors"
+	apiv1 "library-contract/v1"
+	"library-server/service"
 	"net/http"
-	"os"
 	"strings"
 
 	"github.com/gin-gonic/gin"
@@ -13,37 +14,45 @@ func Authenticate() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required", "code": apiv1.CodeUnauthorized})
 			c.Abort()
 			return
 		}
 
 		bearerToken := strings.Split(authHeader, " ")
 		if len(bearerToken) != 2 || strings.ToLower(bearerToken[0]) != "bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format", "code": apiv1.CodeUnauthorized})
 			c.Abort()
 			return
 		}
 
 		tokenString := bearerToken[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		token, err := service.SigningKeys.Parse(tokenString, jwt.MapClaims{})
 
 		if err != nil {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token", "code": apiv1.CodeUnauthorized})
 			c.Abort()
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		// Login challenges are signed with the same keys but are not access tokens
+		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims["typ"] == nil {
+			id, _ := claims["id"].(float64)
+			version, _ := claims["ver"].(float64)
+			jti, _ := claims["jti"].(string)
+			if err := service.ValidateAdminToken(uint(id), int(version), jti); err != nil {
+				if errors.Is(err, service.ErrTokenRevoked) {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked", "code": apiv1.CodeUnauthorized})
+				} else {
+					c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token", "code": apiv1.CodeInternalError})
+				}
+				c.Abort()
+				return
+			}
 			c.Set("user", claims)
 			c.Next()
 		} else {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims", "code": apiv1.CodeUnauthorized})
 			c.Abort()
 			return
 		}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRequirePermission(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	// caller stands in for the authentication middleware
+	route := func(caller func(c *gin.Context), permission string) *gin.Engine {
+		router := gin.New()
+		router.GET("/users/:user_id/receipts", func(c *gin.Context) {
+			caller(c)
+			c.Next()
+		}, RequirePermission(permission), func(c *gin.Context) {
+			c.Status(http.StatusOK)
+		})
+		return router
+	}
+	admin := func(permissions ...interface{}) func(c *gin.Context) {
+		return func(c *gin.Context) {
+			c.Set("user", jwt.MapClaims{"id": float64(1), "permissions": permissions})
+		}
+	}
+	patron := func(c *gin.Context) { c.Set("patron", uint(7)) }
+
+	cases := []struct {
+		name       string
+		caller     func(c *gin.Context)
+		permission string
+		target     string
+		status     int
+	}{
+		{"admin granted the permission", admin(model.PermissionReceiptsRead), model.PermissionReceiptsRead, "/users/1/receipts", http.StatusOK},
+		{"admin granted another permission", admin(model.PermissionBooksWrite), model.PermissionReceiptsRead, "/users/1/receipts", http.StatusForbidden},
+		{"admin without permissions", admin(), model.PermissionReceiptsRead, "/users/1/receipts", http.StatusForbidden},
+		{"no claims", func(c *gin.Context) {}, model.PermissionReceiptsRead, "/users/1/receipts", http.StatusUnauthorized},
+		{"patron reading their own", patron, model.PermissionReceiptsRead, "/users/7/receipts", http.StatusOK},
+		{"patron reading someone else's", patron, model.PermissionReceiptsRead, "/users/8/receipts", http.StatusForbidden},
+		{"patron writing their own", patron, model.PermissionReceiptsWrite, "/users/7/receipts", http.StatusForbidden},
+		{"trusted service", func(c *gin.Context) { c.Set("service", "order-server") }, model.PermissionReceiptsDelete, "/users/1/receipts", http.StatusOK},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			route(tc.caller, tc.permission).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.target, nil))
+			if rec.Code != tc.status {
+				t.Errorf("got status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+			}
+		})
+	}
+}
@@ -1,7 +1,18 @@
 package model
 
+import "time"
+
 type Admin struct {
-	ID       uint   `gorm:"primaryKey;autoIncrement" json:"id"`
-	Username string `gorm:"not null;unique" json:"username"`
-	Password string `gorm:"not null" json:"password"`
+	ID           uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username     string    `gorm:"not null;unique" json:"username"`
+	Password     string    `gorm:"not null" json:"-"`
+	RoleID       *uint     `json:"role_id"`
+	Role         *Role     `gorm:"foreignKey:RoleID" json:"role,omitempty"`
+	Disabled     bool      `gorm:"not null;default:false" json:"disabled"`
+	TokenVersion int       `gorm:"not null;default:0" json:"-"`
+	TOTPSecret   string    `json:"-"`
+	TOTPEnabled  bool      `gorm:"not null;default:false" json:"totp_enabled"`
+	TOTPLastStep int64     `gorm:"not null;default:0" json:"-"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
 }
@@ -6,14 +6,17 @@ const (
 	BookStatusAvailable BookStatus = "available"
 	BookStatusPlaced    BookStatus = "placed"
 	BookStatusTaken     BookStatus = "taken"
+	BookStatusLost      BookStatus = "lost"
 )
 
+// Book is the bibliographic record of a title; the physical items are its Copies
 type Book struct {
-	ID         uint       `gorm:"primaryKey;autoIncrement" json:"id"`
-	Title      string     `gorm:"not null" json:"title"`
-	Author     string     `gorm:"not null" json:"author"`
-	CategoryID uint       `gorm:"not null" json:"category_id"`
-	Category   Category   `gorm:"foreignKey:CategoryID" json:"category"`
-	Location   string     `gorm:"not null" json:"location"`
-	Status     BookStatus `gorm:"not null;type:varchar(10);check:status IN ('available', 'placed', 'taken')" json:"status"`
+	ID              uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Title           string     `gorm:"not null" json:"title"`
+	Author          string     `gorm:"not null" json:"author"`
+	CategoryID      uint       `gorm:"not null" json:"category_id"`
+	Category        Category   `gorm:"foreignKey:CategoryID" json:"category"`
+	Copies          []BookCopy `gorm:"foreignKey:BookID" json:"copies,omitempty"`
+	TotalCopies     int64      `gorm:"-" json:"total_copies"`
+	AvailableCopies int64      `gorm:"-" json:"available_copies"`
 }
@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type CopyCondition string
+
+const (
+	CopyConditionNew     CopyCondition = "new"
+	CopyConditionGood    CopyCondition = "good"
+	CopyConditionFair    CopyCondition = "fair"
+	CopyConditionPoor    CopyCondition = "poor"
+	CopyConditionDamaged CopyCondition = "damaged"
+)
+
+// DefaultItemType is the item type of copies registered without one
+const DefaultItemType = "book"
+
+// BookCopy is a single physical item of a Book that can be shelved and lent out.
+// ItemType (book, dvd, reference, ...) picks the loan policy together with the
+// book's category.
+type BookCopy struct {
+	ID        uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	BookID    uint          `gorm:"not null;index" json:"book_id"`
+	Barcode   string        `gorm:"not null;unique" json:"barcode"`
+	Location  string        `gorm:"not null" json:"location"`
+	Condition CopyCondition `gorm:"not null;type:varchar(10);default:'good';check:condition IN ('new', 'good', 'fair', 'poor', 'damaged')" json:"condition"`
+	ItemType  string        `gorm:"not null;type:varchar(32);default:'book'" json:"item_type"`
+	Status    BookStatus    `gorm:"not null;type:varchar(10);default:'available';check:chk_book_copies_status,status IN ('available', 'placed', 'taken', 'lost')" json:"status"`
+	CreatedAt time.Time     `json:"created_at"`
+	UpdatedAt time.Time     `json:"updated_at"`
+}
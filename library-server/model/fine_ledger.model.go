@@ -0,0 +1,25 @@
+package model
+
+import "time"
+
+type FineEntryType string
+
+const (
+	FineEntryFine    FineEntryType = "fine"
+	FineEntryPayment FineEntryType = "payment"
+	FineEntryWaiver  FineEntryType = "waiver"
+)
+
+// FineLedger is one entry in a user's fines account. Fines are recorded with a
+// positive amount and payments and waivers with a negative one, so the balance
+// is the sum of all of a user's entries.
+type FineLedger struct {
+	ID          uint          `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      uint          `gorm:"not null;index" json:"user_id"`
+	ReceiptID   *uint         `gorm:"index" json:"receipt_id,omitempty"`
+	Type        FineEntryType `gorm:"not null;type:varchar(10);check:type IN ('fine', 'payment', 'waiver')" json:"type"`
+	AmountCents int64         `gorm:"not null" json:"amount_cents"`
+	Note        string        `json:"note,omitempty"`
+	CreatedBy   *uint         `json:"created_by,omitempty"`
+	CreatedAt   time.Time     `json:"created_at"`
+}
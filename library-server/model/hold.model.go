@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+type HoldStatus string
+
+const (
+	HoldStatusWaiting   HoldStatus = "waiting"
+	HoldStatusFulfilled HoldStatus = "fulfilled"
+	HoldStatusCanceled  HoldStatus = "canceled"
+)
+
+// Hold is a patron's place in the FIFO queue for the next copy of a book
+type Hold struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint       `gorm:"not null;index" json:"user_id"`
+	BookID    uint       `gorm:"not null;index" json:"book_id"`
+	Book      Book       `gorm:"foreignKey:BookID" json:"book"`
+	Status    HoldStatus `gorm:"not null;type:varchar(10);check:status IN ('waiting', 'fulfilled', 'canceled')" json:"status"`
+	Position  int64      `gorm:"-" json:"position,omitempty"`
+	ReceiptID *uint      `json:"receipt_id,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
@@ -0,0 +1,21 @@
+package model
+
+// LoanPolicy sets how long copies may be borrowed and renewed and what returning
+// them late costs. A policy is scoped by category, by item type, by both or by
+// neither. The most specific policy matching a copy applies, in this order:
+//  1. its book's category and its item type
+//  2. its item type
+//  3. its book's category
+//  4. the library-wide default with neither set
+type LoanPolicy struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name            string    `gorm:"not null" json:"name"`
+	CategoryID      *uint     `gorm:"uniqueIndex:idx_loan_policies_scope" json:"category_id"`
+	Category        *Category `gorm:"foreignKey:CategoryID" json:"category,omitempty"`
+	ItemType        *string   `gorm:"type:varchar(32);uniqueIndex:idx_loan_policies_scope" json:"item_type"`
+	LoanPeriodDays  int       `gorm:"not null;check:loan_period_days > 0" json:"loan_period_days"`
+	MaxRenewals     int       `gorm:"not null;check:max_renewals >= 0" json:"max_renewals"`
+	GracePeriodDays int       `gorm:"not null;check:grace_period_days >= 0" json:"grace_period_days"`
+	FinePerDayCents int64     `gorm:"not null;default:0;check:fine_per_day_cents >= 0" json:"fine_per_day_cents"`
+	MaxFineCents    int64     `gorm:"not null;default:0;check:max_fine_cents >= 0" json:"max_fine_cents"`
+}
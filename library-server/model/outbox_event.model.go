@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// OutboxEvent is a domain event waiting to be published. It is written in the
+// same transaction as the change it describes and published by the relay
+// afterwards, so no committed change goes unannounced and no rolled back one
+// is announced. MessageID stays the same however often the event is sent.
+type OutboxEvent struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	MessageID   string     `gorm:"not null;uniqueIndex" json:"message_id"`
+	Type        string     `gorm:"not null" json:"type"`
+	Payload     string     `gorm:"not null;type:jsonb" json:"payload"`
+	CreatedAt   time.Time  `json:"created_at"`
+	PublishedAt *time.Time `gorm:"index" json:"published_at,omitempty"`
+}
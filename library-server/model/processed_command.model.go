@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// ProcessedCommand remembers the outcome of a command received over the
+// message queue, so that a command delivered again is not carried out twice.
+// Failure names the error the command failed with; ReceiptID is the receipt
+// it created or canceled.
+type ProcessedCommand struct {
+	RequestID string    `gorm:"primaryKey" json:"request_id"`
+	ReceiptID *uint     `json:"receipt_id,omitempty"`
+	Failure   string    `json:"failure,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -13,16 +13,23 @@ const (
 	ReceiptStatusOwned    ReceiptStatus = "owned"
 	ReceiptStatusReturned ReceiptStatus = "returned"
 	ReceiptStatusCanceled ReceiptStatus = "canceled"
+	ReceiptStatusLost     ReceiptStatus = "lost"
+	ReceiptStatusOverdue  ReceiptStatus = "overdue"
 )
 
 type Receipt struct {
-	ID        uint           `gorm:"primaryKey;autoIncrement" json:"id"`
-	UserID    uint           `json:"user_id"`
-	BookID    uint           `json:"book_id"`
-	Book      Book           `gorm:"foreignKey:BookID" json:"book"`
-	Status    ReceiptStatus  `gorm:"not null;type:varchar(10);check:status IN ('pending', 'owned', 'returned')" json:"status"`
-	DueDate   time.Time      `json:"due_date"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+	ID             uint           `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID         uint           `json:"user_id"`
+	BookID         uint           `json:"book_id"`
+	Book           Book           `gorm:"foreignKey:BookID" json:"book"`
+	CopyID         uint           `json:"copy_id"`
+	Copy           BookCopy       `gorm:"foreignKey:CopyID" json:"copy"`
+	Status         ReceiptStatus  `gorm:"not null;type:varchar(10);check:chk_receipts_status_v2,status IN ('pending', 'owned', 'overdue', 'returned', 'canceled', 'lost')" json:"status"`
+	DueDate        time.Time      `json:"due_date"`
+	Renewals       int            `gorm:"not null;default:0" json:"renewals"`
+	PickupDeadline *time.Time     `json:"pickup_deadline,omitempty"`
+	CancelReason   string         `json:"cancel_reason,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 }
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+// RecoveryCode is a one-time code that stands in for a TOTP code when an
+// admin has lost their authenticator. Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	AdminID   uint       `gorm:"not null;index" json:"admin_id"`
+	CodeHash  string     `gorm:"not null" json:"-"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
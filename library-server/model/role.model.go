@@ -0,0 +1,60 @@
+package model
+
+// Permissions that can be granted to staff roles
+const (
+	PermissionBooksRead         = "books:read"
+	PermissionBooksWrite        = "books:write"
+	PermissionCategoriesWrite   = "categories:write"
+	PermissionLoanPoliciesWrite = "loan_policies:write"
+	PermissionReceiptsRead      = "receipts:read"
+	PermissionReceiptsWrite     = "receipts:write"
+	PermissionReceiptsDelete    = "receipts:delete"
+	PermissionHoldsRead         = "holds:read"
+	PermissionHoldsWrite        = "holds:write"
+	PermissionFinesRead         = "fines:read"
+	PermissionFinesWrite        = "fines:write"
+	PermissionAdminsManage      = "admins:manage"
+	PermissionPatronsManage     = "patrons:manage"
+)
+
+// AllPermissions lists every permission a role can hold
+var AllPermissions = []string{
+	PermissionBooksRead,
+	PermissionBooksWrite,
+	PermissionCategoriesWrite,
+	PermissionLoanPoliciesWrite,
+	PermissionReceiptsRead,
+	PermissionReceiptsWrite,
+	PermissionReceiptsDelete,
+	PermissionHoldsRead,
+	PermissionHoldsWrite,
+	PermissionFinesRead,
+	PermissionFinesWrite,
+	PermissionAdminsManage,
+	PermissionPatronsManage,
+}
+
+// Names of the roles created on first start
+const (
+	RoleSuperadmin      = "superadmin"
+	RoleLibrarian       = "librarian"
+	RoleCataloguer      = "cataloguer"
+	RoleCirculationDesk = "circulation_desk"
+)
+
+// Role is a named set of permissions assigned to admins
+type Role struct {
+	ID          uint     `gorm:"primaryKey;autoIncrement" json:"id"`
+	Name        string   `gorm:"not null;unique" json:"name"`
+	Permissions []string `gorm:"not null;type:jsonb;serializer:json" json:"permissions"`
+}
+
+// HasPermission reports whether the role grants permission
+func (r Role) HasPermission(permission string) bool {
+	for _, p := range r.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package routes
+
+import (
+	"library-server/handler"
+	"library-server/middleware"
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func AdminRoutes(router *gin.RouterGroup) {
+	router.Use(middleware.Authenticate())
+	router.PUT("/me/password", handler.ChangeOwnPassword)
+	router.POST("/me/totp", handler.BeginTOTPEnrollment)
+	router.POST("/me/totp/confirm", handler.ConfirmTOTPEnrollment)
+	router.POST("/me/totp/disable", handler.DisableTOTP)
+	router.POST("/me/totp/recovery-codes", handler.RegenerateRecoveryCodes)
+
+	manage := router.Group("/", middleware.RequirePermission(model.PermissionAdminsManage))
+	manage.POST("/", handler.CreateAdmin)
+	manage.GET("/", handler.GetAllAdmins)
+	manage.GET("/:id", handler.GetAdminByID)
+	manage.POST("/:id/disable", handler.DisableAdmin)
+	manage.POST("/:id/enable", handler.EnableAdmin)
+	manage.POST("/:id/unlock", handler.UnlockAdmin)
+	manage.POST("/:id/totp/reset", handler.ResetAdminTOTP)
+	manage.PUT("/:id/role", handler.SetAdminRole)
+	manage.PUT("/:id/password", handler.ResetAdminPassword)
+}
@@ -2,10 +2,14 @@ package routes
 
 import (
 	"library-server/handler"
+	"library-server/middleware"
 
 	"github.com/gin-gonic/gin"
 )
 
 func AuthRoutes(r *gin.RouterGroup) {
 	r.POST("/login", handler.Login)
+	r.POST("/login/totp", handler.LoginTOTP)
+	r.POST("/refresh", handler.Refresh)
+	r.POST("/logout", middleware.Authenticate(), handler.Logout)
 }
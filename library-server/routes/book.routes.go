@@ -3,17 +3,22 @@ package routes
 import (
 	"library-server/handler"
 	"library-server/middleware"
+	"library-server/model"
 
 	"github.com/gin-gonic/gin"
 )
 
 func BookRoutes(router *gin.RouterGroup) {
-	router.Use(middleware.Authenticate())
-	router.POST("/", handler.CreateBook)
-	router.GET("/:id", handler.GetBookByID)
-	router.GET("/", handler.GetAllBooks)
-	router.PUT("/:id", handler.UpdateBook)
-	router.DELETE("/:id", handler.DeleteBook)
-	router.GET("/category/:categoryID", handler.GetBooksByCategory)
-	router.PATCH("/:id/status", handler.UpdateBookStatus)
+	router.Use(middleware.AuthenticateServiceOrAdmin())
+	read := middleware.RequirePermission(model.PermissionBooksRead)
+	write := middleware.RequirePermission(model.PermissionBooksWrite)
+
+	router.POST("/", write, handler.CreateBook)
+	router.GET("/:id", read, handler.GetBookByID)
+	router.GET("/", read, handler.GetAllBooks)
+	router.PUT("/:id", write, handler.UpdateBook)
+	router.DELETE("/:id", write, handler.DeleteBook)
+	router.GET("/category/:categoryID", read, handler.GetBooksByCategory)
+	router.GET("/:id/copies", read, handler.GetCopiesByBookID)
+	router.POST("/:id/copies", write, handler.CreateCopy)
 }
@@ -0,0 +1,20 @@
+package routes
+
+import (
+	"library-server/handler"
+	"library-server/middleware"
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CopyRoutes(router *gin.RouterGroup) {
+	router.Use(middleware.Authenticate())
+	read := middleware.RequirePermission(model.PermissionBooksRead)
+	write := middleware.RequirePermission(model.PermissionBooksWrite)
+
+	router.GET("/:id", read, handler.GetCopyByID)
+	router.PUT("/:id", write, handler.UpdateCopy)
+	router.DELETE("/:id", write, handler.DeleteCopy)
+	router.PATCH("/:id/status", write, handler.UpdateCopyStatus)
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"library-server/handler"
+	"library-server/middleware"
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CategoryRoutes(router *gin.RouterGroup) {
+	router.Use(middleware.Authenticate())
+	read := middleware.RequirePermission(model.PermissionBooksRead)
+	write := middleware.RequirePermission(model.PermissionCategoriesWrite)
+
+	router.POST("/", write, handler.CreateCategory)
+	router.GET("/", read, handler.GetAllCategories)
+	router.GET("/:id", read, handler.GetCategoryByID)
+	router.PUT("/:id", write, handler.RenameCategory)
+	router.DELETE("/:id", write, handler.DeleteCategory)
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"library-server/handler"
+	"library-server/middleware"
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func FineRoutes(router *gin.RouterGroup) {
+	read := middleware.RequirePermission(model.PermissionFinesRead)
+	write := middleware.RequirePermission(model.PermissionFinesWrite)
+
+	router.GET("/user/:user_id", middleware.AuthenticateServiceOrAdmin(), read, handler.GetFineBalance)
+
+	admin := router.Group("/", middleware.Authenticate())
+	admin.GET("/", read, handler.GetOutstandingFineBalances)
+	admin.POST("/user/:user_id/payments", write, handler.RecordFinePayment)
+	admin.POST("/user/:user_id/waivers", write, handler.RecordFineWaiver)
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"library-server/handler"
+	"library-server/middleware"
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func HoldRoutes(router *gin.RouterGroup) {
+	router.Use(middleware.AuthenticateServiceOrAdmin())
+	read := middleware.RequirePermission(model.PermissionHoldsRead)
+	write := middleware.RequirePermission(model.PermissionHoldsWrite)
+
+	router.POST("/", write, handler.PlaceHold)
+	router.GET("/:id", read, handler.GetHoldByID)
+	router.GET("/user/:user_id", read, handler.GetHoldsByUserID)
+	router.GET("/book/:book_id", read, handler.GetHoldsByBookID)
+	router.DELETE("/:id", write, handler.CancelHold)
+}
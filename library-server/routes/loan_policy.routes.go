@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"library-server/handler"
+	"library-server/middleware"
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func LoanPolicyRoutes(router *gin.RouterGroup) {
+	router.Use(middleware.Authenticate())
+	read := middleware.RequirePermission(model.PermissionBooksRead)
+	write := middleware.RequirePermission(model.PermissionLoanPoliciesWrite)
+
+	router.POST("/", write, handler.CreateLoanPolicy)
+	router.GET("/", read, handler.GetAllLoanPolicies)
+	router.GET("/:id", read, handler.GetLoanPolicyByID)
+	router.PUT("/:id", write, handler.UpdateLoanPolicy)
+	router.DELETE("/:id", write, handler.DeleteLoanPolicy)
+}
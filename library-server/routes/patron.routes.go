@@ -0,0 +1,15 @@
+package routes
+
+import (
+	"library-server/handler"
+	"library-server/middleware"
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func PatronRoutes(router *gin.RouterGroup) {
+	router.Use(middleware.AuthenticateServiceOrAdmin())
+
+	router.DELETE("/:user_id", middleware.RequirePermission(model.PermissionPatronsManage), handler.AnonymizePatron)
+}
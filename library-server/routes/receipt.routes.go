@@ -2,15 +2,22 @@ package routes
 
 import (
 	"library-server/handler"
+	"library-server/middleware"
+	"library-server/model"
 
 	"github.com/gin-gonic/gin"
 )
 
 func ReceiptRoutes(router *gin.RouterGroup) {
-	router.POST("/", handler.CreateReceipt)
-	router.GET("/:id", handler.GetReceiptByID)
-	router.GET("/user/:user_id", handler.GetReceiptsByUserID)
-	router.PATCH("/:id/status", handler.UpdateReceiptStatus)
-	router.DELETE("/:id", handler.DeleteReceipt)
-	router.GET("/", handler.GetAllReceipts)
+	router.Use(middleware.AuthenticateServiceOrAdmin())
+	read := middleware.RequirePermission(model.PermissionReceiptsRead)
+	write := middleware.RequirePermission(model.PermissionReceiptsWrite)
+
+	router.POST("/", write, handler.CreateReceipt)
+	router.GET("/:id", read, handler.GetReceiptByID)
+	router.GET("/user/:user_id", read, handler.GetReceiptsByUserID)
+	router.PATCH("/:id/status", write, handler.UpdateReceiptStatus)
+	router.POST("/:id/renew", write, handler.RenewReceipt)
+	router.DELETE("/:id", middleware.RequirePermission(model.PermissionReceiptsDelete), handler.DeleteReceipt)
+	router.GET("/", read, handler.GetAllReceipts)
 }
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"library-server/handler"
+	"library-server/middleware"
+	"library-server/model"
+
+	"github.com/gin-gonic/gin"
+)
+
+func RoleRoutes(router *gin.RouterGroup) {
+	router.Use(middleware.Authenticate(), middleware.RequirePermission(model.PermissionAdminsManage))
+
+	router.POST("/", handler.CreateRole)
+	router.GET("/", handler.GetAllRoles)
+	router.GET("/:id", handler.GetRoleByID)
+	router.PUT("/:id", handler.UpdateRole)
+	router.DELETE("/:id", handler.DeleteRole)
+}
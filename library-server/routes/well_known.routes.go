@@ -0,0 +1,11 @@
+package routes
+
+import (
+	"library-server/handler"
+
+	"github.com/gin-gonic/gin"
+)
+
+func WellKnownRoutes(router *gin.RouterGroup) {
+	router.GET("/jwks.json", handler.JWKS)
+}
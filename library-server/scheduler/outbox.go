@@ -0,0 +1,27 @@
+package scheduler
+
+import (
+	"library-contract/broker"
+	apiv1 "library-contract/v1"
+	"library-server/service"
+	"log"
+	"time"
+)
+
+// StartOutboxRelay periodically publishes the domain events recorded in the
+// outbox on the library's event exchange, and purges those published long ago.
+// The interval is set by OUTBOX_RELAY_INTERVAL.
+func StartOutboxRelay(rabbitmq *broker.RabbitMQ) {
+	every("outbox relay", "OUTBOX_RELAY_INTERVAL", 5*time.Second, func(now time.Time) error {
+		relayed, err := service.RelayOutboxEvents(func(message *apiv1.Message) error {
+			return rabbitmq.PublishEvent(apiv1.LibraryEventExchange, message)
+		})
+		if relayed > 0 {
+			log.Printf("Published %d domain events", relayed)
+		}
+		if err != nil {
+			return err
+		}
+		return service.PurgePublishedEvents(now)
+	})
+}
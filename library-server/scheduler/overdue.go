@@ -0,0 +1,12 @@
+package scheduler
+
+import (
+	"library-server/service"
+	"time"
+)
+
+// StartOverdueScanner periodically marks receipts past their due date as
+// overdue and accrues their fines. The interval is set by OVERDUE_SCAN_INTERVAL.
+func StartOverdueScanner() {
+	every("overdue scan", "OVERDUE_SCAN_INTERVAL", time.Hour, service.ProcessOverdueReceipts)
+}
@@ -0,0 +1,19 @@
+package scheduler
+
+import (
+	"library-server/service"
+	"log"
+	"time"
+)
+
+// StartPickupExpiry periodically cancels pending receipts that were not
+// collected within the pickup window. The interval is set by PICKUP_EXPIRY_INTERVAL.
+func StartPickupExpiry() {
+	every("pickup expiry", "PICKUP_EXPIRY_INTERVAL", 15*time.Minute, func(now time.Time) error {
+		expired, err := service.ExpirePendingReceipts(now)
+		if expired > 0 {
+			log.Printf("Canceled %d uncollected receipts", expired)
+		}
+		return err
+	})
+}
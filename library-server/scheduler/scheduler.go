@@ -0,0 +1,34 @@
+package scheduler
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// every runs job immediately and then once per interval until the process
+// exits. The interval is read from envVar as a Go duration, falling back to
+// fallback when it is unset or invalid.
+func every(name, envVar string, fallback time.Duration, job func(now time.Time) error) {
+	interval := fallback
+	if raw := os.Getenv(envVar); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			log.Printf("Invalid %s %q, using %s", envVar, raw, fallback)
+		} else {
+			interval = parsed
+		}
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := job(time.Now()); err != nil {
+				log.Printf("%s failed: %v", name, err)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("Running %s every %s", name, interval)
+}
@@ -0,0 +1,12 @@
+package scheduler
+
+import (
+	"library-server/service"
+	"time"
+)
+
+// StartTokenCleanup periodically deletes expired refresh tokens and revoked
+// access tokens. The interval is set by TOKEN_CLEANUP_INTERVAL.
+func StartTokenCleanup() {
+	every("token cleanup", "TOKEN_CLEANUP_INTERVAL", time.Hour, service.PurgeExpiredTokens)
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"errors"
+	db "library-server/DB"
+	"library-server/model"
+	"log"
+	"os"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// MinPasswordLength is the shortest password accepted for an admin account
+const MinPasswordLength = 8
+
+var (
+	ErrAdminNotFound          = errors.New("admin not found")
+	ErrAdminExists            = errors.New("username is already taken")
+	ErrPasswordTooShort       = errors.New("password must be at least 8 characters")
+	ErrInvalidCurrentPassword = errors.New("current password is incorrect")
+	ErrCannotDisableSelf      = errors.New("you cannot disable your own account")
+)
+
+// CreateAdmin creates an enabled admin account with the given role
+func CreateAdmin(username, password string, roleID uint) (*model.Admin, error) {
+	if _, err := GetRoleByID(roleID); err != nil {
+		return nil, err
+	}
+	hash, err := hashPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int64
+	if err := db.DB.Model(&model.Admin{}).Where("username = ?", username).Count(&count).Error; err != nil {
+		return nil, err
+	}
+	if count > 0 {
+		return nil, ErrAdminExists
+	}
+
+	admin := model.Admin{Username: username, Password: hash, RoleID: &roleID}
+	if err := db.DB.Omit("Role").Create(&admin).Error; err != nil {
+		return nil, err
+	}
+	return GetAdminByID(admin.ID)
+}
+
+// GetAllAdmins retrieves every admin account with its role
+func GetAllAdmins() ([]model.Admin, error) {
+	var admins []model.Admin
+	result := db.DB.Preload("Role").Order("id").Find(&admins)
+	return admins, result.Error
+}
+
+// GetAdminByID retrieves an admin account and its role by ID
+func GetAdminByID(id uint) (*model.Admin, error) {
+	var admin model.Admin
+	if err := db.DB.Preload("Role").First(&admin, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAdminNotFound
+		}
+		return nil, err
+	}
+	return &admin, nil
+}
+
+// SetAdminDisabled disables or re-enables an admin account. Disabled admins
+// cannot log in. actorID is the admin making the change, who may not lock
+// themselves out.
+func SetAdminDisabled(id uint, disabled bool, actorID uint) (*model.Admin, error) {
+	if disabled && id == actorID {
+		return nil, ErrCannotDisableSelf
+	}
+	if err := updateAdmin(id, "disabled", disabled); err != nil {
+		return nil, err
+	}
+	return GetAdminByID(id)
+}
+
+// SetAdminRole assigns a different role to an admin account
+func SetAdminRole(id, roleID uint) (*model.Admin, error) {
+	if _, err := GetRoleByID(roleID); err != nil {
+		return nil, err
+	}
+	if err := updateAdmin(id, "role_id", roleID); err != nil {
+		return nil, err
+	}
+	return GetAdminByID(id)
+}
+
+// ResetAdminPassword sets a new password for an admin account without
+// requiring the current one
+func ResetAdminPassword(id uint, password string) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	return updateAdmin(id, "password", hash)
+}
+
+// ChangeOwnPassword replaces an admin's password after checking the current one
+func ChangeOwnPassword(id uint, currentPassword, newPassword string) error {
+	admin, err := GetAdminByID(id)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(currentPassword)) != nil {
+		return ErrInvalidCurrentPassword
+	}
+	return ResetAdminPassword(id, newPassword)
+}
+
+// BootstrapAdmin creates the first superadmin from BOOTSTRAP_ADMIN_USERNAME and
+// BOOTSTRAP_ADMIN_PASSWORD when no admin account exists yet. Once an account
+// exists the variables are ignored and should be removed.
+func BootstrapAdmin() error {
+	var count int64
+	if err := db.DB.Model(&model.Admin{}).Count(&count).Error; err != nil {
+		return err
+	}
+
+	username, password := os.Getenv("BOOTSTRAP_ADMIN_USERNAME"), os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	if count > 0 {
+		if password != "" {
+			log.Println("Admin accounts already exist, ignoring BOOTSTRAP_ADMIN_PASSWORD; remove it from the environment")
+		}
+		return nil
+	}
+	if username == "" || password == "" {
+		log.Println("No admin accounts exist; set BOOTSTRAP_ADMIN_USERNAME and BOOTSTRAP_ADMIN_PASSWORD or run `create-admin` to create one")
+		return nil
+	}
+
+	admin, err := CreateSuperadmin(username, password)
+	if err != nil {
+		return err
+	}
+	log.Printf("Created superadmin %q", admin.Username)
+	return nil
+}
+
+// CreateSuperadmin creates an admin account holding the superadmin role
+func CreateSuperadmin(username, password string) (*model.Admin, error) {
+	var role model.Role
+	if err := db.DB.Where("name = ?", model.RoleSuperadmin).First(&role).Error; err != nil {
+		return nil, err
+	}
+	return CreateAdmin(username, password, role.ID)
+}
+
+// updateAdmin changes one column of an admin account and revokes the admin's
+// sessions, so tokens carrying the old role or password stop working at once
+func updateAdmin(id uint, column string, value interface{}) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Admin{}).Where("id = ?", id).Update(column, value)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrAdminNotFound
+		}
+		return revokeAdminSessions(tx, id)
+	})
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", ErrPasswordTooShort
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
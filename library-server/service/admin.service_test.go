@@ -0,0 +1,154 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+)
+
+// createTestAdmin creates an admin holding a fresh librarian role
+func createTestAdmin(t *testing.T, username string) *model.Admin {
+	t.Helper()
+	var role model.Role
+	if err := db.DB.Where(model.Role{Name: model.RoleLibrarian}).FirstOrCreate(&role).Error; err != nil {
+		t.Fatal(err)
+	}
+	admin, err := CreateAdmin(username, "correct horse", role.ID)
+	if err != nil {
+		t.Fatalf("creating admin %s: %v", username, err)
+	}
+	return admin
+}
+
+func TestCreateAdmin(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	admin := createTestAdmin(t, "librarian")
+
+	if admin.Disabled || admin.Role == nil || admin.Role.Name != model.RoleLibrarian {
+		t.Errorf("got admin %+v, want an enabled librarian", admin)
+	}
+	if admin.Password == "correct horse" {
+		t.Error("the password was stored in plain text")
+	}
+	if _, err := CreateAdmin("librarian", "correct horse", *admin.RoleID); !errors.Is(err, ErrAdminExists) {
+		t.Errorf("taken username: got %v, want %v", err, ErrAdminExists)
+	}
+	if _, err := CreateAdmin("cataloguer", "short", *admin.RoleID); !errors.Is(err, ErrPasswordTooShort) {
+		t.Errorf("short password: got %v, want %v", err, ErrPasswordTooShort)
+	}
+	if _, err := CreateAdmin("cataloguer", "correct horse", 9999); !errors.Is(err, ErrRoleNotFound) {
+		t.Errorf("missing role: got %v, want %v", err, ErrRoleNotFound)
+	}
+}
+
+func TestDisabledAdminsCannotLogIn(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	t.Setenv("REQUIRE_ADMIN_TOTP", "")
+	actor := createTestAdmin(t, "head")
+	admin := createTestAdmin(t, "librarian")
+
+	if _, err := SetAdminDisabled(actor.ID, true, actor.ID); !errors.Is(err, ErrCannotDisableSelf) {
+		t.Errorf("disabling oneself: got %v, want %v", err, ErrCannotDisableSelf)
+	}
+	if _, err := SetAdminDisabled(9999, true, actor.ID); !errors.Is(err, ErrAdminNotFound) {
+		t.Errorf("disabling a missing admin: got %v, want %v", err, ErrAdminNotFound)
+	}
+
+	if _, _, err := Login("librarian", "correct horse", "192.0.2.1"); err != nil {
+		t.Fatal(err)
+	}
+	disabled, err := SetAdminDisabled(admin.ID, true, actor.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !disabled.Disabled {
+		t.Error("the admin was not disabled")
+	}
+	if err := ValidateAdminToken(admin.ID, disabled.TokenVersion, "any"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("token of a disabled admin: got %v, want %v", err, ErrTokenRevoked)
+	}
+	if _, _, err := Login("librarian", "correct horse", "192.0.2.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("logging in while disabled: got %v, want %v", err, ErrInvalidCredentials)
+	}
+
+	if _, err := SetAdminDisabled(admin.ID, false, actor.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Login("librarian", "correct horse", "192.0.2.1"); err != nil {
+		t.Errorf("logging in after being enabled again: %v", err)
+	}
+}
+
+func TestPasswordChanges(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	t.Setenv("REQUIRE_ADMIN_TOTP", "")
+	admin := createTestAdmin(t, "librarian")
+
+	if err := ChangeOwnPassword(admin.ID, "wrong horse", "battery staple"); !errors.Is(err, ErrInvalidCurrentPassword) {
+		t.Errorf("wrong current password: got %v, want %v", err, ErrInvalidCurrentPassword)
+	}
+	if err := ChangeOwnPassword(admin.ID, "correct horse", "short"); !errors.Is(err, ErrPasswordTooShort) {
+		t.Errorf("short new password: got %v, want %v", err, ErrPasswordTooShort)
+	}
+	if err := ChangeOwnPassword(admin.ID, "correct horse", "battery staple"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := Login("librarian", "correct horse", "192.0.2.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("old password: got %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, _, err := Login("librarian", "battery staple", "192.0.2.1"); err != nil {
+		t.Errorf("new password: %v", err)
+	}
+
+	if err := ResetAdminPassword(admin.ID, "tr0ub4dor&3"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateAdminToken(admin.ID, admin.TokenVersion, "any"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("token from before the reset: got %v, want %v", err, ErrTokenRevoked)
+	}
+	if err := ResetAdminPassword(9999, "tr0ub4dor&3"); !errors.Is(err, ErrAdminNotFound) {
+		t.Errorf("resetting a missing admin: got %v, want %v", err, ErrAdminNotFound)
+	}
+}
+
+func TestBootstrapAdmin(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	createTestRole(t, model.RoleSuperadmin, model.AllPermissions...)
+	count := func() int64 {
+		t.Helper()
+		var count int64
+		if err := db.DB.Model(&model.Admin{}).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		return count
+	}
+
+	t.Setenv("BOOTSTRAP_ADMIN_USERNAME", "root")
+	t.Setenv("BOOTSTRAP_ADMIN_PASSWORD", "")
+	if err := BootstrapAdmin(); err != nil || count() != 0 {
+		t.Fatalf("without a password: got %v and %d admins, want none", err, count())
+	}
+
+	t.Setenv("BOOTSTRAP_ADMIN_PASSWORD", "correct horse")
+	if err := BootstrapAdmin(); err != nil {
+		t.Fatal(err)
+	}
+	var admin model.Admin
+	if err := db.DB.Preload("Role").Where("username = ?", "root").First(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	if admin.Role == nil || admin.Role.Name != model.RoleSuperadmin {
+		t.Errorf("got role %+v, want %s", admin.Role, model.RoleSuperadmin)
+	}
+
+	// Once an admin exists the variables are ignored
+	t.Setenv("BOOTSTRAP_ADMIN_USERNAME", "another")
+	if err := BootstrapAdmin(); err != nil || count() != 1 {
+		t.Errorf("with an admin present: got %v and %d admins, want only the first", err, count())
+	}
+}
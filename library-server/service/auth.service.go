@@ -2,31 +2,274 @@ package service
 
 import (
 	"errors"
+	"library-contract/session"
+	"library-contract/signing"
+	"library-contract/throttle"
 	db "library-server/DB"
 	"library-server/model"
-	"os"
+	"log"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
-func Login(username, password string) (string, error) {
+var (
+	ErrInvalidRefreshToken = session.ErrInvalidRefreshToken
+	ErrTokenRevoked        = errors.New("token has been revoked")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired login challenge")
+	ErrInvalidMFACode      = errors.New("invalid authentication code")
+)
+
+// TokenIssuer is the iss claim of the access tokens this server signs
+const TokenIssuer = "library-server"
+
+// SigningKeys signs and verifies this server's tokens once LoadSigningKeys has run
+var SigningKeys *signing.KeySet
+
+// LoadSigningKeys loads the keys configured with JWT_SIGNING_KEY and
+// JWT_RETIRED_KEYS; see signing.LoadKeySet for how to rotate them
+func LoadSigningKeys() error {
+	keys, err := signing.LoadKeySet(TokenIssuer)
+	if err != nil {
+		return err
+	}
+	SigningKeys = keys
+	return nil
+}
+
+// TokenPair is what a successful login or refresh hands back to the admin
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// dummyPasswordHash is compared against when the username is unknown, so that
+// a failed login takes as long whether or not the account exists
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// mfaChallengeTTL is how long an admin has to enter their second factor after
+// the password was accepted
+const mfaChallengeTTL = 5 * time.Minute
+
+// mfaChallengeType is the typ claim of challenge tokens, which only
+// VerifyLoginCode accepts
+const mfaChallengeType = "mfa_challenge"
+
+// MFAChallenge is handed back instead of a TokenPair when the admin has TOTP
+// enabled; the token is exchanged for a session by VerifyLoginCode
+type MFAChallenge struct {
+	MFARequired bool   `json:"mfa_required"`
+	Token       string `json:"mfa_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+// Login checks an admin's credentials. Admins without TOTP get a session right
+// away; admins with TOTP get a challenge to complete with VerifyLoginCode.
+// Failed attempts are counted per account and per client address ip, and
+// either gets locked out after too many of them.
+func Login(username, password, ip string) (*TokenPair, *MFAChallenge, error) {
+	if err := throttle.Check(db.DB, throttle.AccountSubject(username), throttle.IPSubject(ip)); err != nil {
+		return nil, nil, err
+	}
+
+	var admin model.Admin
+	db.DB.Preload("Role").Where("username = ?", username).First(&admin)
+	hash := dummyPasswordHash
+	if admin.ID != 0 {
+		hash = []byte(admin.Password)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || admin.ID == 0 || admin.Disabled {
+		throttle.RecordFailure(db.DB, username, ip)
+		return nil, nil, ErrInvalidCredentials
+	}
+
+	if admin.TOTPEnabled {
+		token, err := SigningKeys.Sign(jwt.MapClaims{
+			"iss": TokenIssuer,
+			"typ": mfaChallengeType,
+			"id":  admin.ID,
+			"exp": time.Now().Add(mfaChallengeTTL).Unix(),
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, &MFAChallenge{MFARequired: true, Token: token, ExpiresIn: int64(mfaChallengeTTL.Seconds())}, nil
+	}
+
+	throttle.Clear(db.DB, throttle.AccountSubject(username))
+	tokens, err := startSession(&admin)
+	return tokens, nil, err
+}
+
+// VerifyLoginCode completes a login challenged for a second factor. code is
+// either the current TOTP code or an unused recovery code. Wrong codes count
+// as failed logins.
+func VerifyLoginCode(challenge, code, ip string) (*TokenPair, error) {
+	claims := jwt.MapClaims{}
+	_, err := SigningKeys.Parse(challenge, claims)
+	if err != nil || claims["typ"] != mfaChallengeType {
+		return nil, ErrInvalidMFAChallenge
+	}
+	id, _ := claims["id"].(float64)
+
 	var admin model.Admin
-	db.DB.Where("username = ?", username).First(&admin)
-	if admin.ID == 0 {
-		return "", errors.New("admin not found")
+	if err := db.DB.Preload("Role").First(&admin, uint(id)).Error; err != nil {
+		return nil, ErrInvalidMFAChallenge
+	}
+	if err := throttle.Check(db.DB, throttle.AccountSubject(admin.Username), throttle.IPSubject(ip)); err != nil {
+		return nil, err
+	}
+	if admin.Disabled || !admin.TOTPEnabled {
+		return nil, ErrInvalidMFAChallenge
+	}
+
+	ok, err := verifySecondFactor(db.DB, &admin, code)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		throttle.RecordFailure(db.DB, admin.Username, ip)
+		return nil, ErrInvalidMFACode
+	}
+	throttle.Clear(db.DB, throttle.AccountSubject(admin.Username))
+	return startSession(&admin)
+}
+
+// startSession issues the first access and refresh token of a new session
+func startSession(admin *model.Admin) (*TokenPair, error) {
+	var tokens *TokenPair
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		refreshToken, _, err := session.IssueRefreshToken(tx, admin.ID)
+		if err != nil {
+			return err
+		}
+		tokens, err = issueAccessToken(admin, refreshToken)
+		return err
+	})
+	return tokens, err
+}
+
+// RefreshSession exchanges a refresh token for a new access token and a new
+// refresh token. Presenting a refresh token that was already used means it
+// leaked, so every session of its admin is revoked.
+func RefreshSession(refreshToken string) (*TokenPair, error) {
+	var tokens *TokenPair
+	var reused bool
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		stored, err := session.UseRefreshToken(tx, refreshToken)
+		if errors.Is(err, session.ErrRefreshTokenReused) {
+			reused = true
+			return revokeAdminSessions(tx, stored.OwnerID)
+		}
+		if err != nil {
+			return err
+		}
+
+		var admin model.Admin
+		if err := tx.Preload("Role").First(&admin, stored.OwnerID).Error; err != nil {
+			return err
+		}
+		if admin.Disabled {
+			return ErrInvalidRefreshToken
+		}
+
+		next, err := session.RotateRefreshToken(tx, stored)
+		if err != nil {
+			return err
+		}
+		tokens, err = issueAccessToken(&admin, next)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		log.Printf("Refresh token reuse detected, all sessions revoked")
+		return nil, ErrInvalidRefreshToken
+	}
+	return tokens, nil
+}
+
+// Logout revokes the access token identified by jti and, when given, the
+// refresh token of the same session
+func Logout(adminID uint, jti string, expiresAt time.Time, refreshToken string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return session.Logout(tx, adminID, jti, expiresAt, refreshToken)
+	})
+}
+
+// ValidateAdminToken checks that an access token has not been revoked, either
+// by logging out or by a change to the admin's account since it was issued
+func ValidateAdminToken(adminID uint, version int, jti string) error {
+	var admin model.Admin
+	if err := db.DB.Select("id", "disabled", "token_version").First(&admin, adminID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTokenRevoked
+		}
+		return err
+	}
+	if admin.Disabled || admin.TokenVersion != version {
+		return ErrTokenRevoked
+	}
+
+	revoked, err := session.AccessTokenRevoked(db.DB, jti)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// PurgeExpiredTokens forgets revoked access tokens and refresh tokens that
+// have expired and can no longer be used anyway
+func PurgeExpiredTokens(now time.Time) error {
+	return session.PurgeExpired(db.DB, now)
+}
+
+// revokeAdminSessions invalidates every access and refresh token of an admin
+func revokeAdminSessions(tx *gorm.DB, adminID uint) error {
+	err := tx.Model(&model.Admin{}).Where("id = ?", adminID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+	if err != nil {
+		return err
+	}
+	return session.RevokeRefreshTokens(tx, adminID)
+}
+
+// issueAccessToken signs an access token carrying the admin's permissions.
+// When TOTP is required but the admin has not enrolled, the token carries no
+// permissions and only lets the admin enroll.
+func issueAccessToken(admin *model.Admin, refreshToken string) (*TokenPair, error) {
+	role, permissions := "", []string{}
+	if admin.Role != nil {
+		role, permissions = admin.Role.Name, admin.Role.Permissions
+	}
+	enrollmentRequired := TOTPRequired() && !admin.TOTPEnabled
+	if enrollmentRequired {
+		permissions = []string{}
 	}
-	err := bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(password))
+	jti, err := session.RandomToken(16)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":  admin.ID,
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
-	}).SignedString([]byte(os.Getenv("JWT_SECRET")))
+	ttl := session.TTL("ACCESS_TOKEN_TTL", 15*time.Minute)
+	token, err := SigningKeys.Sign(jwt.MapClaims{
+		"iss":                      TokenIssuer,
+		"id":                       admin.ID,
+		"role":                     role,
+		"permissions":              permissions,
+		"totp_enrollment_required": enrollmentRequired,
+		"ver":                      admin.TokenVersion,
+		"jti":                      jti,
+		"exp":                      time.Now().Add(ttl).Unix(),
+	})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	return token, nil
+	return &TokenPair{AccessToken: token, RefreshToken: refreshToken, ExpiresIn: int64(ttl.Seconds())}, nil
 }
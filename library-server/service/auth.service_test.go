@@ -0,0 +1,147 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"library-server/dbtest"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// accessClaims parses an access token issued by this server
+func accessClaims(t *testing.T, token string) jwt.MapClaims {
+	t.Helper()
+	claims := jwt.MapClaims{}
+	if _, err := SigningKeys.Parse(token, claims); err != nil {
+		t.Fatal(err)
+	}
+	return claims
+}
+
+// tokenStillValid reports whether ValidateAdminToken accepts an access token
+func tokenStillValid(t *testing.T, token string) bool {
+	t.Helper()
+	claims := accessClaims(t, token)
+	id, _ := claims["id"].(float64)
+	version, _ := claims["ver"].(float64)
+	jti, _ := claims["jti"].(string)
+	err := ValidateAdminToken(uint(id), int(version), jti)
+	if err != nil && !errors.Is(err, ErrTokenRevoked) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func loginTestAdmin(t *testing.T, username string) *TokenPair {
+	t.Helper()
+	tokens, _, err := Login(username, "correct horse", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+func TestRefreshSessionRotatesTheToken(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	t.Setenv("REQUIRE_ADMIN_TOTP", "")
+	createTestAdmin(t, "librarian")
+	login := loginTestAdmin(t, "librarian")
+
+	first, err := RefreshSession(login.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RefreshToken == login.RefreshToken || first.AccessToken == login.AccessToken {
+		t.Error("refreshing handed back the same tokens")
+	}
+	second, err := RefreshSession(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refreshing with the rotated token: %v", err)
+	}
+	if !tokenStillValid(t, second.AccessToken) {
+		t.Error("the refreshed access token was not accepted")
+	}
+
+	if _, err := RefreshSession("never-issued"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestReusedRefreshTokenRevokesEverySession(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	t.Setenv("REQUIRE_ADMIN_TOTP", "")
+	createTestAdmin(t, "librarian")
+	stolen := loginTestAdmin(t, "librarian")
+	other := loginTestAdmin(t, "librarian")
+
+	rotated, err := RefreshSession(stolen.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshSession(stolen.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reusing a refresh token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	for name, tokens := range map[string]*TokenPair{"rotated": rotated, "other": other} {
+		if tokenStillValid(t, tokens.AccessToken) {
+			t.Errorf("the %s session's access token is still accepted", name)
+		}
+		if _, err := RefreshSession(tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("the %s session's refresh token: got %v, want %v", name, err, ErrInvalidRefreshToken)
+		}
+	}
+	if fresh := loginTestAdmin(t, "librarian"); !tokenStillValid(t, fresh.AccessToken) {
+		t.Error("logging in again did not start a working session")
+	}
+}
+
+func TestRefreshSessionOfDisabledAdmin(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	t.Setenv("REQUIRE_ADMIN_TOTP", "")
+	actor := createTestAdmin(t, "head")
+	admin := createTestAdmin(t, "librarian")
+	tokens := loginTestAdmin(t, "librarian")
+
+	if _, err := SetAdminDisabled(admin.ID, true, actor.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RefreshSession(tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestLogoutEndsOnlyItsSession(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	t.Setenv("REQUIRE_ADMIN_TOTP", "")
+	admin := createTestAdmin(t, "librarian")
+	leaving := loginTestAdmin(t, "librarian")
+	staying := loginTestAdmin(t, "librarian")
+
+	claims := accessClaims(t, leaving.AccessToken)
+	expiresAt, err := claims.GetExpirationTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Logout(admin.ID, claims["jti"].(string), expiresAt.Time, leaving.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+
+	if tokenStillValid(t, leaving.AccessToken) {
+		t.Error("the logged out access token is still accepted")
+	}
+	// Presenting a logged out refresh token is not a sign it leaked
+	if _, err := RefreshSession(leaving.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("the logged out refresh token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if !tokenStillValid(t, staying.AccessToken) {
+		t.Error("logging out ended the other session")
+	}
+	if _, err := RefreshSession(staying.RefreshToken); err != nil {
+		t.Errorf("refreshing the other session: %v", err)
+	}
+}
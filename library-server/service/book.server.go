@@ -2,23 +2,49 @@ package service
 
 import (
 	"errors"
+	apiv1 "library-contract/v1"
 	db "library-server/DB"
 	"library-server/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrBookNotFound   = errors.New("book not found")
+	ErrBookInUse      = errors.New("book has copies that are placed, taken or lost, or patrons waiting for it")
+	ErrBookHasHistory = errors.New("book has been borrowed or held and is kept for the loan history")
 )
 
-// CreateBook creates a new book in the database
+// CreateBook creates a new book in the database and records a BookCreated event
 func CreateBook(book *model.Book) error {
-	result := db.DB.Create(book)
-	return result.Error
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(book).Error; err != nil {
+			return err
+		}
+		return recordEvent(tx, apiv1.MessageBookCreated, apiv1.BookCreated{
+			BookID:     book.ID,
+			Title:      book.Title,
+			Author:     book.Author,
+			CategoryID: book.CategoryID,
+			Copies:     len(book.Copies),
+		})
+	})
 }
 
 // GetBookByID retrieves a book by its ID
 func GetBookByID(id uint) (*model.Book, error) {
 	var book model.Book
-	result := db.DB.Preload("Category").First(&book, id)
+	result := db.DB.Preload("Category").Preload("Copies").First(&book, id)
 	if result.Error != nil {
 		return nil, result.Error
 	}
+	for _, bookCopy := range book.Copies {
+		book.TotalCopies++
+		if bookCopy.Status == model.BookStatusAvailable {
+			book.AvailableCopies++
+		}
+	}
 	return &book, nil
 }
 
@@ -47,38 +73,118 @@ func GetAllBooks(page, pageSize int, author, category, title string) ([]model.Bo
 
 	// Apply pagination
 	offset := (page - 1) * pageSize
-	result := query.Offset(offset).Limit(pageSize).Find(&books)
+	if err := query.Offset(offset).Limit(pageSize).Find(&books).Error; err != nil {
+		return nil, 0, err
+	}
 
-	return books, totalCount, result.Error
+	if err := attachCopyCounts(books); err != nil {
+		return nil, 0, err
+	}
+	return books, totalCount, nil
 }
 
 // UpdateBook updates an existing book in the database
 func UpdateBook(book *model.Book) error {
-	result := db.DB.Save(book)
+	result := db.DB.Omit("Copies").Save(book)
 	return result.Error
 }
 
-// DeleteBook deletes a book from the database
+// DeleteBook deletes a book and all of its copies from the database. Books
+// with a copy that is not available or with patrons waiting for a copy are
+// refused, like copies in use are by DeleteCopy. So are books that were ever
+// borrowed or held, as their receipts and holds keep pointing at them.
 func DeleteBook(id uint) error {
-	result := db.DB.Delete(&model.Book{}, id)
-	if result.RowsAffected == 0 {
-		return errors.New("book not found")
-	}
-	return result.Error
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		// Serialise with placements, holds and copies being released, which lock the book too
+		var book model.Book
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&book, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrBookNotFound
+			}
+			return err
+		}
+
+		var inUse int64
+		err := tx.Model(&model.BookCopy{}).
+			Where("book_id = ? AND status <> ?", id, model.BookStatusAvailable).
+			Count(&inUse).Error
+		if err != nil {
+			return err
+		}
+		waiting, err := bookHasWaiters(tx, id)
+		if err != nil {
+			return err
+		}
+		if inUse > 0 || waiting {
+			return ErrBookInUse
+		}
+
+		var receipts, holds int64
+		if err := tx.Unscoped().Model(&model.Receipt{}).Where("book_id = ?", id).Count(&receipts).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Hold{}).Where("book_id = ?", id).Count(&holds).Error; err != nil {
+			return err
+		}
+		if receipts > 0 || holds > 0 {
+			return ErrBookHasHistory
+		}
+
+		if err := tx.Where("book_id = ?", id).Delete(&model.BookCopy{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&book).Error; err != nil {
+			return err
+		}
+		return recordEvent(tx, apiv1.MessageBookDeleted, apiv1.BookDeleted{BookID: id})
+	})
 }
 
 // GetBooksByCategory retrieves all books in a specific category
 func GetBooksByCategory(categoryID uint) ([]model.Book, error) {
 	var books []model.Book
-	result := db.DB.Preload("Category").Where("category_id = ?", categoryID).Find(&books)
-	return books, result.Error
+	if err := db.DB.Preload("Category").Where("category_id = ?", categoryID).Find(&books).Error; err != nil {
+		return nil, err
+	}
+	if err := attachCopyCounts(books); err != nil {
+		return nil, err
+	}
+	return books, nil
 }
 
-// UpdateBookStatus updates the status of a book
-func UpdateBookStatus(id uint, status model.BookStatus) error {
-	result := db.DB.Model(&model.Book{}).Where("id = ?", id).Update("status", status)
-	if result.RowsAffected == 0 {
-		return errors.New("book not found")
+// attachCopyCounts fills in the total and available copy counts of each book
+func attachCopyCounts(books []model.Book) error {
+	if len(books) == 0 {
+		return nil
 	}
-	return result.Error
+
+	ids := make([]uint, 0, len(books))
+	for _, book := range books {
+		ids = append(ids, book.ID)
+	}
+
+	var counts []struct {
+		BookID    uint
+		Total     int64
+		Available int64
+	}
+	err := db.DB.Model(&model.BookCopy{}).
+		Select("book_id, COUNT(*) AS total, COUNT(*) FILTER (WHERE status = ?) AS available", model.BookStatusAvailable).
+		Where("book_id IN ?", ids).
+		Group("book_id").
+		Scan(&counts).Error
+	if err != nil {
+		return err
+	}
+
+	byBook := make(map[uint]int, len(books))
+	for i := range books {
+		byBook[books[i].ID] = i
+	}
+	for _, c := range counts {
+		i := byBook[c.BookID]
+		books[i].TotalCopies = c.Total
+		books[i].AvailableCopies = c.Available
+	}
+	return nil
 }
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+)
+
+func TestDeleteBookKeepsLoanHistory(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+
+	t.Run("borrowed", func(t *testing.T) {
+		book := createTestBook(t, 1)
+		receipt := model.Receipt{UserID: 1, BookID: book.ID}
+		if err := CreateReceipt(&receipt); err != nil {
+			t.Fatal(err)
+		}
+		if err := UpdateReceiptStatus(receipt.ID, model.ReceiptStatusCanceled); err != nil {
+			t.Fatal(err)
+		}
+		if err := DeleteReceipt(receipt.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := DeleteCopy(book.Copies[0].ID); !errors.Is(err, ErrCopyHasHistory) {
+			t.Errorf("DeleteCopy returned %v, want ErrCopyHasHistory", err)
+		}
+		if err := DeleteBook(book.ID); !errors.Is(err, ErrBookHasHistory) {
+			t.Errorf("DeleteBook returned %v, want ErrBookHasHistory", err)
+		}
+	})
+	t.Run("held", func(t *testing.T) {
+		book := createTestBook(t, 0)
+		hold := model.Hold{UserID: 1, BookID: book.ID, Status: model.HoldStatusCanceled}
+		if err := db.DB.Create(&hold).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := DeleteBook(book.ID); !errors.Is(err, ErrBookHasHistory) {
+			t.Errorf("DeleteBook returned %v, want ErrBookHasHistory", err)
+		}
+	})
+	t.Run("never lent", func(t *testing.T) {
+		book := createTestBook(t, 2)
+		if err := DeleteBook(book.ID); err != nil {
+			t.Fatalf("DeleteBook: %v", err)
+		}
+		var copies int64
+		if err := db.DB.Model(&model.BookCopy{}).Where("book_id = ?", book.ID).Count(&copies).Error; err != nil {
+			t.Fatal(err)
+		}
+		if copies != 0 {
+			t.Errorf("%d copies are left, want none", copies)
+		}
+	})
+}
+
+func TestDeleteBookRacesPlacement(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+
+	// Whichever runs first wins: the book is either lent or gone, never both
+	for i := 0; i < 10; i++ {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			book := createTestBook(t, 1)
+			var placeErr, deleteErr error
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				<-start
+				placeErr = CreateReceipt(&model.Receipt{UserID: 1, BookID: book.ID})
+			}()
+			go func() {
+				defer wg.Done()
+				<-start
+				deleteErr = DeleteBook(book.ID)
+			}()
+			close(start)
+			wg.Wait()
+
+			switch {
+			case placeErr == nil && errors.Is(deleteErr, ErrBookInUse):
+			case deleteErr == nil && errors.Is(placeErr, ErrBookNotFound):
+			default:
+				t.Fatalf("placement returned %v and deletion %v, want exactly one to succeed", placeErr, deleteErr)
+			}
+		})
+	}
+}
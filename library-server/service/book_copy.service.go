@@ -0,0 +1,176 @@
+package service
+
+import (
+	"errors"
+	apiv1 "library-contract/v1"
+	db "library-server/DB"
+	"library-server/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrCopyNotFound      = errors.New("copy not found")
+	ErrCopyInUse         = errors.New("copy is placed, taken or lost")
+	ErrCopyHasHistory    = errors.New("copy has been borrowed and is kept for the loan history")
+	ErrUnknownCopyStatus = errors.New("unknown copy status")
+	ErrCopyOnLoan        = errors.New("copy is held by an active receipt; change the receipt's status instead")
+	ErrCopyStatusNotSet  = errors.New("copies are only placed or taken by receipts; set available or lost instead")
+)
+
+// CreateCopy adds a new physical copy to an existing book and records a
+// CopyCreated event. A new copy goes to the first patron in the queue, if
+// there is one, and is shelved as available otherwise.
+func CreateCopy(bookID uint, bookCopy *model.BookCopy) error {
+	bookCopy.BookID = bookID
+	if bookCopy.Condition == "" {
+		bookCopy.Condition = model.CopyConditionGood
+	}
+	if bookCopy.ItemType == "" {
+		bookCopy.ItemType = model.DefaultItemType
+	}
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		hold, err := nextHold(tx, bookID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrBookNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		bookCopy.Status = model.BookStatusAvailable
+		if hold != nil {
+			bookCopy.Status = model.BookStatusPlaced
+		}
+		if err := tx.Create(bookCopy).Error; err != nil {
+			return err
+		}
+		err = recordEvent(tx, apiv1.MessageCopyCreated, apiv1.CopyCreated{
+			BookID: bookID,
+			CopyID: bookCopy.ID,
+			Status: string(bookCopy.Status),
+		})
+		if err != nil {
+			return err
+		}
+		if hold != nil {
+			return promoteHold(tx, hold, bookCopy)
+		}
+		return nil
+	})
+}
+
+// GetCopiesByBookID retrieves all copies of a book
+func GetCopiesByBookID(bookID uint) ([]model.BookCopy, error) {
+	var copies []model.BookCopy
+	result := db.DB.Where("book_id = ?", bookID).Order("id").Find(&copies)
+	return copies, result.Error
+}
+
+// GetCopyByID retrieves a copy by its ID
+func GetCopyByID(id uint) (*model.BookCopy, error) {
+	var bookCopy model.BookCopy
+	if err := db.DB.First(&bookCopy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, err
+	}
+	return &bookCopy, nil
+}
+
+// UpdateCopy updates the barcode, location and condition of a copy
+func UpdateCopy(bookCopy *model.BookCopy) error {
+	result := db.DB.Model(&model.BookCopy{}).Where("id = ?", bookCopy.ID).Updates(map[string]interface{}{
+		"barcode":   bookCopy.Barcode,
+		"location":  bookCopy.Location,
+		"condition": bookCopy.Condition,
+		"item_type": bookCopy.ItemType,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrCopyNotFound
+	}
+	return db.DB.First(bookCopy, bookCopy.ID).Error
+}
+
+// DeleteCopy deletes an available copy that was never borrowed. The copy is
+// locked while it is checked, so no placement can reserve it in between.
+func DeleteCopy(id uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		bookCopy, err := lockCopy(tx, id)
+		if err != nil {
+			return err
+		}
+		if bookCopy.Status != model.BookStatusAvailable {
+			return ErrCopyInUse
+		}
+		var receipts int64
+		if err := tx.Unscoped().Model(&model.Receipt{}).Where("copy_id = ?", id).Count(&receipts).Error; err != nil {
+			return err
+		}
+		if receipts > 0 {
+			return ErrCopyHasHistory
+		}
+		return tx.Delete(bookCopy).Error
+	})
+}
+
+// lockCopy locks a copy and its book, the book first in the same order as
+// placements and releaseCopy
+func lockCopy(tx *gorm.DB, id uint) (*model.BookCopy, error) {
+	var bookCopy model.BookCopy
+	if err := tx.First(&bookCopy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCopyNotFound
+		}
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&model.Book{}, bookCopy.BookID).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&bookCopy, id).Error; err != nil {
+		return nil, err
+	}
+	return &bookCopy, nil
+}
+
+// UpdateCopyStatus marks a copy no active receipt holds as lost or as
+// available again. A copy made available goes to the next hold for its book,
+// if there is one. Copies are only placed or taken by receipts, and copies
+// under a pending, owned or overdue receipt follow the receipt's lifecycle.
+func UpdateCopyStatus(id uint, status model.BookStatus) error {
+	switch status {
+	case model.BookStatusAvailable, model.BookStatusLost:
+	case model.BookStatusPlaced, model.BookStatusTaken:
+		return ErrCopyStatusNotSet
+	default:
+		return ErrUnknownCopyStatus
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		bookCopy, err := lockCopy(tx, id)
+		if err != nil {
+			return err
+		}
+
+		var active int64
+		err = tx.Model(&model.Receipt{}).
+			Where("copy_id = ? AND status IN ?", id, []model.ReceiptStatus{model.ReceiptStatusPending, model.ReceiptStatusOwned, model.ReceiptStatusOverdue}).
+			Count(&active).Error
+		if err != nil {
+			return err
+		}
+		if active > 0 {
+			return ErrCopyOnLoan
+		}
+
+		if status == model.BookStatusAvailable {
+			return releaseCopy(tx, bookCopy)
+		}
+		return setCopyStatus(tx, bookCopy, status)
+	})
+}
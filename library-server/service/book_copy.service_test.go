@@ -0,0 +1,187 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	apiv1 "library-contract/v1"
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+)
+
+func TestUpdateCopyStatus(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 2)
+	onLoan, spare := book.Copies[0], book.Copies[1]
+
+	receipt := model.Receipt{UserID: 1, BookID: book.ID}
+	if err := CreateReceipt(&receipt); err != nil {
+		t.Fatal(err)
+	}
+	if receipt.CopyID != onLoan.ID {
+		t.Fatalf("receipt reserved copy %d, want %d", receipt.CopyID, onLoan.ID)
+	}
+
+	if err := UpdateCopyStatus(spare.ID, "misplaced"); !errors.Is(err, ErrUnknownCopyStatus) {
+		t.Errorf("unknown status: got %v, want ErrUnknownCopyStatus", err)
+	}
+	if err := UpdateCopyStatus(onLoan.ID, model.BookStatusAvailable); !errors.Is(err, ErrCopyOnLoan) {
+		t.Errorf("copy under a pending receipt: got %v, want ErrCopyOnLoan", err)
+	}
+	for _, status := range []model.BookStatus{model.BookStatusPlaced, model.BookStatusTaken} {
+		if err := UpdateCopyStatus(spare.ID, status); !errors.Is(err, ErrCopyStatusNotSet) {
+			t.Errorf("setting %s: got %v, want ErrCopyStatusNotSet", status, err)
+		}
+	}
+	if err := UpdateCopyStatus(spare.ID+100, model.BookStatusLost); !errors.Is(err, ErrCopyNotFound) {
+		t.Errorf("missing copy: got %v, want ErrCopyNotFound", err)
+	}
+
+	if err := UpdateCopyStatus(spare.ID, model.BookStatusLost); err != nil {
+		t.Fatalf("marking the spare copy lost: %v", err)
+	}
+	hold := model.Hold{UserID: 2, BookID: book.ID, Status: model.HoldStatusWaiting}
+	if err := db.DB.Create(&hold).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Finding the copy again hands it to the patron waiting for it
+	if err := UpdateCopyStatus(spare.ID, model.BookStatusAvailable); err != nil {
+		t.Fatalf("marking the spare copy found: %v", err)
+	}
+	var found model.BookCopy
+	if err := db.DB.First(&found, spare.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if found.Status != model.BookStatusPlaced {
+		t.Errorf("found copy is %s, want %s", found.Status, model.BookStatusPlaced)
+	}
+	if err := db.DB.First(&hold, hold.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if hold.Status != model.HoldStatusFulfilled {
+		t.Errorf("hold is %s, want %s", hold.Status, model.HoldStatusFulfilled)
+	}
+}
+
+func TestDeleteCopyRacesPlacement(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+
+	// Whichever runs first wins: the copy is either reserved or gone, never both
+	for i := 0; i < 10; i++ {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			book := createTestBook(t, 1)
+			var placeErr, deleteErr error
+			start := make(chan struct{})
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				<-start
+				placeErr = CreateReceipt(&model.Receipt{UserID: 1, BookID: book.ID})
+			}()
+			go func() {
+				defer wg.Done()
+				<-start
+				deleteErr = DeleteCopy(book.Copies[0].ID)
+			}()
+			close(start)
+			wg.Wait()
+
+			switch {
+			case placeErr == nil && errors.Is(deleteErr, ErrCopyInUse):
+			case deleteErr == nil && errors.Is(placeErr, ErrBookNotAvailable):
+			default:
+				t.Fatalf("placement returned %v and deletion %v, want exactly one to succeed", placeErr, deleteErr)
+			}
+		})
+	}
+}
+
+// outboxEventsAfter returns the outbox events recorded after the one with ID after
+func outboxEventsAfter(t *testing.T, after uint) []model.OutboxEvent {
+	t.Helper()
+	var events []model.OutboxEvent
+	if err := db.DB.Where("id > ?", after).Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// lastOutboxEventID returns the ID of the newest outbox event, or 0
+func lastOutboxEventID(t *testing.T) uint {
+	t.Helper()
+	var last model.OutboxEvent
+	if err := db.DB.Order("id DESC").Limit(1).Find(&last).Error; err != nil {
+		t.Fatal(err)
+	}
+	return last.ID
+}
+
+func TestCreateCopyRecordsOneEvent(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+
+	t.Run("shelved", func(t *testing.T) {
+		book := createTestBook(t, 0)
+		before := lastOutboxEventID(t)
+		bookCopy := model.BookCopy{Barcode: fmt.Sprintf("NEW-%d", book.ID), Location: "A1"}
+		if err := CreateCopy(book.ID, &bookCopy); err != nil {
+			t.Fatal(err)
+		}
+		if bookCopy.Status != model.BookStatusAvailable {
+			t.Errorf("copy is %s, want %s", bookCopy.Status, model.BookStatusAvailable)
+		}
+
+		events := outboxEventsAfter(t, before)
+		if len(events) != 1 || events[0].Type != apiv1.MessageCopyCreated {
+			t.Fatalf("got events %+v, want a single CopyCreated", events)
+		}
+		var created apiv1.CopyCreated
+		if err := json.Unmarshal([]byte(events[0].Payload), &created); err != nil {
+			t.Fatal(err)
+		}
+		want := apiv1.CopyCreated{BookID: book.ID, CopyID: bookCopy.ID, Status: apiv1.CopyStatusAvailable}
+		if created != want {
+			t.Errorf("got %+v, want %+v", created, want)
+		}
+	})
+	t.Run("to the next hold", func(t *testing.T) {
+		book := createTestBook(t, 0)
+		hold := model.Hold{UserID: 3, BookID: book.ID, Status: model.HoldStatusWaiting}
+		if err := db.DB.Create(&hold).Error; err != nil {
+			t.Fatal(err)
+		}
+		before := lastOutboxEventID(t)
+		bookCopy := model.BookCopy{Barcode: fmt.Sprintf("NEW-%d", book.ID), Location: "A1"}
+		if err := CreateCopy(book.ID, &bookCopy); err != nil {
+			t.Fatal(err)
+		}
+		if bookCopy.Status != model.BookStatusPlaced {
+			t.Errorf("copy is %s, want %s", bookCopy.Status, model.BookStatusPlaced)
+		}
+		if err := db.DB.First(&hold, hold.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if hold.Status != model.HoldStatusFulfilled {
+			t.Errorf("hold is %s, want %s", hold.Status, model.HoldStatusFulfilled)
+		}
+
+		var types []string
+		for _, event := range outboxEventsAfter(t, before) {
+			types = append(types, event.Type)
+		}
+		want := []string{apiv1.MessageCopyCreated, apiv1.MessageReceiptCreated}
+		if fmt.Sprint(types) != fmt.Sprint(want) {
+			t.Errorf("got events %v, want %v", types, want)
+		}
+	})
+	t.Run("missing book", func(t *testing.T) {
+		if err := CreateCopy(999999, &model.BookCopy{Barcode: "NONE", Location: "A1"}); !errors.Is(err, ErrBookNotFound) {
+			t.Errorf("got %v, want ErrBookNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"errors"
+	db "library-server/DB"
+	"library-server/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrCategoryNotFound    = errors.New("category not found")
+	ErrCategoryExists      = errors.New("category already exists")
+	ErrCategoryHasBooks    = errors.New("category still has books")
+	ErrInvalidReassignment = errors.New("invalid reassignment target")
+)
+
+// CategoryWithStats is a category along with the number of books it holds
+// and how many of their copies are in each BookStatus
+type CategoryWithStats struct {
+	model.Category
+	BookCount    int64                      `json:"book_count"`
+	CopyCount    int64                      `json:"copy_count"`
+	StatusCounts map[model.BookStatus]int64 `json:"status_counts"`
+}
+
+// CreateCategory creates a new category in the database
+func CreateCategory(category *model.Category) error {
+	if err := ensureCategoryNameFree(category.Name, 0); err != nil {
+		return err
+	}
+	result := db.DB.Create(category)
+	return result.Error
+}
+
+// GetAllCategories retrieves every category together with its book statistics
+func GetAllCategories() ([]CategoryWithStats, error) {
+	var categories []model.Category
+	if err := db.DB.Order("id").Find(&categories).Error; err != nil {
+		return nil, err
+	}
+
+	stats, err := categoryStats()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]CategoryWithStats, 0, len(categories))
+	for _, category := range categories {
+		result = append(result, withStats(category, stats[category.ID]))
+	}
+	return result, nil
+}
+
+// GetCategoryByID retrieves a category and its book statistics by ID
+func GetCategoryByID(id uint) (*CategoryWithStats, error) {
+	var category model.Category
+	if err := db.DB.First(&category, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrCategoryNotFound
+		}
+		return nil, err
+	}
+
+	stats, err := categoryStats(id)
+	if err != nil {
+		return nil, err
+	}
+
+	result := withStats(category, stats[id])
+	return &result, nil
+}
+
+// RenameCategory changes the name of an existing category
+func RenameCategory(id uint, name string) (*model.Category, error) {
+	if err := ensureCategoryNameFree(name, id); err != nil {
+		return nil, err
+	}
+	result := db.DB.Model(&model.Category{}).Where("id = ?", id).Update("name", name)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrCategoryNotFound
+	}
+	return &model.Category{ID: id, Name: name}, nil
+}
+
+// DeleteCategory deletes a category. If the category still has books they are
+// moved to reassignTo first; without a reassignment target the deletion is refused.
+func DeleteCategory(id uint, reassignTo *uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var category model.Category
+		if err := tx.First(&category, id).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrCategoryNotFound
+			}
+			return err
+		}
+
+		var bookCount int64
+		if err := tx.Model(&model.Book{}).Where("category_id = ?", id).Count(&bookCount).Error; err != nil {
+			return err
+		}
+
+		if bookCount > 0 {
+			if reassignTo == nil {
+				return ErrCategoryHasBooks
+			}
+			if *reassignTo == id {
+				return ErrInvalidReassignment
+			}
+			var target model.Category
+			if err := tx.First(&target, *reassignTo).Error; err != nil {
+				if errors.Is(err, gorm.ErrRecordNotFound) {
+					return ErrInvalidReassignment
+				}
+				return err
+			}
+			if err := tx.Model(&model.Book{}).Where("category_id = ?", id).Update("category_id", target.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(&category).Error
+	})
+}
+
+// ensureCategoryNameFree reports ErrCategoryExists if another category already uses name
+func ensureCategoryNameFree(name string, exceptID uint) error {
+	var count int64
+	if err := db.DB.Model(&model.Category{}).Where("name = ? AND id <> ?", name, exceptID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrCategoryExists
+	}
+	return nil
+}
+
+type categoryCounts struct {
+	books  int64
+	status []categoryStatusCount
+}
+
+type categoryStatusCount struct {
+	CategoryID uint
+	Status     model.BookStatus
+	Count      int64
+}
+
+// categoryStats counts books per category and their copies per status,
+// optionally limited to the given categories
+func categoryStats(categoryIDs ...uint) (map[uint]categoryCounts, error) {
+	var books []struct {
+		CategoryID uint
+		Count      int64
+	}
+	bookQuery := db.DB.Model(&model.Book{}).
+		Select("category_id, COUNT(*) AS count").
+		Group("category_id")
+	if len(categoryIDs) > 0 {
+		bookQuery = bookQuery.Where("category_id IN ?", categoryIDs)
+	}
+	if err := bookQuery.Scan(&books).Error; err != nil {
+		return nil, err
+	}
+
+	var copies []categoryStatusCount
+	copyQuery := db.DB.Model(&model.BookCopy{}).
+		Joins("JOIN books ON books.id = book_copies.book_id").
+		Select("books.category_id, book_copies.status, COUNT(*) AS count").
+		Group("books.category_id, book_copies.status")
+	if len(categoryIDs) > 0 {
+		copyQuery = copyQuery.Where("books.category_id IN ?", categoryIDs)
+	}
+	if err := copyQuery.Scan(&copies).Error; err != nil {
+		return nil, err
+	}
+
+	stats := make(map[uint]categoryCounts)
+	for _, row := range books {
+		counts := stats[row.CategoryID]
+		counts.books = row.Count
+		stats[row.CategoryID] = counts
+	}
+	for _, row := range copies {
+		counts := stats[row.CategoryID]
+		counts.status = append(counts.status, row)
+		stats[row.CategoryID] = counts
+	}
+	return stats, nil
+}
+
+func withStats(category model.Category, counts categoryCounts) CategoryWithStats {
+	result := CategoryWithStats{
+		Category:  category,
+		BookCount: counts.books,
+		StatusCounts: map[model.BookStatus]int64{
+			model.BookStatusAvailable: 0,
+			model.BookStatusPlaced:    0,
+			model.BookStatusTaken:     0,
+			model.BookStatusLost:      0,
+		},
+	}
+	for _, c := range counts.status {
+		result.StatusCounts[c.Status] = c.Count
+		result.CopyCount += c.Count
+	}
+	return result
+}
@@ -0,0 +1,113 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+)
+
+func TestCategoryStatsCountCopiesByStatus(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 3)
+	if err := db.DB.Model(&book.Copies[0]).Update("status", model.BookStatusPlaced).Error; err != nil {
+		t.Fatal(err)
+	}
+	empty := model.Category{Name: "Empty"}
+	if err := CreateCategory(&empty); err != nil {
+		t.Fatal(err)
+	}
+
+	category, err := GetCategoryByID(book.CategoryID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if category.BookCount != 1 || category.CopyCount != 3 {
+		t.Errorf("got %d books and %d copies, want 1 and 3", category.BookCount, category.CopyCount)
+	}
+	want := map[model.BookStatus]int64{
+		model.BookStatusAvailable: 2,
+		model.BookStatusPlaced:    1,
+		model.BookStatusTaken:     0,
+		model.BookStatusLost:      0,
+	}
+	for status, count := range want {
+		if category.StatusCounts[status] != count {
+			t.Errorf("got %d %s copies, want %d", category.StatusCounts[status], status, count)
+		}
+	}
+
+	categories, err := GetAllCategories()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(categories) != 2 {
+		t.Fatalf("got %d categories, want 2", len(categories))
+	}
+	if listed := categories[1]; listed.ID != empty.ID || listed.BookCount != 0 || listed.StatusCounts[model.BookStatusAvailable] != 0 {
+		t.Errorf("got %+v for the empty category", listed)
+	}
+}
+
+func TestDeleteCategoryWithBooksNeedsATarget(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 1)
+	target := model.Category{Name: "Target"}
+	if err := CreateCategory(&target); err != nil {
+		t.Fatal(err)
+	}
+	self, missing := book.CategoryID, uint(9999)
+
+	if err := DeleteCategory(book.CategoryID, nil); !errors.Is(err, ErrCategoryHasBooks) {
+		t.Errorf("without a target: got %v, want %v", err, ErrCategoryHasBooks)
+	}
+	if err := DeleteCategory(book.CategoryID, &self); !errors.Is(err, ErrInvalidReassignment) {
+		t.Errorf("onto itself: got %v, want %v", err, ErrInvalidReassignment)
+	}
+	if err := DeleteCategory(book.CategoryID, &missing); !errors.Is(err, ErrInvalidReassignment) {
+		t.Errorf("onto a missing category: got %v, want %v", err, ErrInvalidReassignment)
+	}
+
+	if err := DeleteCategory(book.CategoryID, &target.ID); err != nil {
+		t.Fatal(err)
+	}
+	var moved model.Book
+	if err := db.DB.First(&moved, book.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if moved.CategoryID != target.ID {
+		t.Errorf("book is in category %d, want %d", moved.CategoryID, target.ID)
+	}
+	if _, err := GetCategoryByID(book.CategoryID); !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("deleted category: got %v, want %v", err, ErrCategoryNotFound)
+	}
+	if err := DeleteCategory(target.ID, nil); !errors.Is(err, ErrCategoryHasBooks) {
+		t.Errorf("target with the moved book: got %v, want %v", err, ErrCategoryHasBooks)
+	}
+}
+
+func TestCategoryNamesAreUnique(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	fiction := model.Category{Name: "Fiction"}
+	poetry := model.Category{Name: "Poetry"}
+	for _, category := range []*model.Category{&fiction, &poetry} {
+		if err := CreateCategory(category); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := CreateCategory(&model.Category{Name: "Fiction"}); !errors.Is(err, ErrCategoryExists) {
+		t.Errorf("creating a duplicate: got %v, want %v", err, ErrCategoryExists)
+	}
+	if _, err := RenameCategory(poetry.ID, "Fiction"); !errors.Is(err, ErrCategoryExists) {
+		t.Errorf("renaming onto another: got %v, want %v", err, ErrCategoryExists)
+	}
+	if _, err := RenameCategory(fiction.ID, "Fiction"); err != nil {
+		t.Errorf("keeping its own name: %v", err)
+	}
+	if _, err := RenameCategory(9999, "Drama"); !errors.Is(err, ErrCategoryNotFound) {
+		t.Errorf("renaming a missing category: got %v, want %v", err, ErrCategoryNotFound)
+	}
+}
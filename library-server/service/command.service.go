@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	apiv1 "library-contract/v1"
+	db "library-server/DB"
+	"library-server/model"
+
+	"gorm.io/gorm"
+)
+
+var ErrReceiptNotPending = errors.New("only pending receipts can be canceled")
+
+// commandFailures are the errors a command can fail with for good. They are
+// recorded by name, so that a repeated command fails the same way.
+var commandFailures = map[string]error{
+	apiv1.CodeBookNotFound:      ErrBookNotFound,
+	apiv1.CodeBookNotAvailable:  ErrBookNotAvailable,
+	apiv1.CodeReceiptNotFound:   ErrReceiptNotFound,
+	apiv1.CodeReceiptNotPending: ErrReceiptNotPending,
+}
+
+// PlaceReceiptOnce reserves a copy of a book for a user like CreateReceipt,
+// but only once per requestID. Repeating a request returns the receipt
+// created the first time, or fails with the error the first attempt failed with.
+func PlaceReceiptOnce(requestID string, userID, bookID uint) (*model.Receipt, error) {
+	receiptID, err := runCommandOnce(requestID, func(tx *gorm.DB) (uint, error) {
+		receipt := model.Receipt{UserID: userID, BookID: bookID}
+		err := createReceipt(tx, &receipt)
+		return receipt.ID, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetReceiptByID(receiptID)
+}
+
+// CancelReceiptOnce cancels one of a user's pending receipts, only once per
+// requestID. A receipt that is already canceled, for instance because its
+// pickup deadline passed, counts as canceled.
+func CancelReceiptOnce(requestID string, userID, receiptID uint) error {
+	_, err := runCommandOnce(requestID, func(tx *gorm.DB) (uint, error) {
+		var receipt model.Receipt
+		if err := tx.First(&receipt, receiptID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return 0, ErrReceiptNotFound
+			}
+			return 0, err
+		}
+		if receipt.UserID != userID {
+			return 0, ErrReceiptNotFound
+		}
+		switch receipt.Status {
+		case model.ReceiptStatusCanceled:
+			return receipt.ID, nil
+		case model.ReceiptStatusPending:
+			return receipt.ID, updateReceiptStatus(tx, receipt.ID, model.ReceiptStatusCanceled)
+		default:
+			return 0, ErrReceiptNotPending
+		}
+	})
+	return err
+}
+
+// runCommandOnce runs a command unless requestID was already processed, and
+// records its outcome in the same transaction as its changes. Failures listed
+// in commandFailures are recorded too; other errors roll everything back so
+// the command can be tried again.
+func runCommandOnce(requestID string, run func(tx *gorm.DB) (uint, error)) (uint, error) {
+	var receiptID uint
+	var failure error
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var processed model.ProcessedCommand
+		err := tx.Where("request_id = ?", requestID).First(&processed).Error
+		if err == nil {
+			if processed.ReceiptID != nil {
+				receiptID = *processed.ReceiptID
+			}
+			if processed.Failure != "" {
+				failure = commandFailures[processed.Failure]
+				if failure == nil {
+					failure = errors.New(processed.Failure)
+				}
+			}
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		processed = model.ProcessedCommand{RequestID: requestID}
+		// A savepoint undoes a failed command's changes without losing the record of it
+		err = tx.Transaction(func(tx *gorm.DB) error {
+			var runErr error
+			receiptID, runErr = run(tx)
+			return runErr
+		})
+		if err != nil {
+			name, ok := commandFailureName(err)
+			if !ok {
+				return err
+			}
+			failure = err
+			processed.Failure = name
+		} else {
+			processed.ReceiptID = &receiptID
+		}
+		return tx.Create(&processed).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return receiptID, failure
+}
+
+func commandFailureName(err error) (string, bool) {
+	for name, failure := range commandFailures {
+		if errors.Is(err, failure) {
+			return name, true
+		}
+	}
+	return "", false
+}
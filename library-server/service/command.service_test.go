@@ -0,0 +1,116 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+)
+
+func TestPlaceReceiptOnceCarriesOutEachRequestOnce(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 2)
+
+	first, err := PlaceReceiptOnce("request-1", 1, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := PlaceReceiptOnce("request-1", 1, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Errorf("repeating the request created receipt %d, want %d", again.ID, first.ID)
+	}
+	second, err := PlaceReceiptOnce("request-2", 1, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second.ID == first.ID {
+		t.Error("a new request got the receipt of another")
+	}
+
+	var receipts int64
+	if err := db.DB.Model(&model.Receipt{}).Where("book_id = ?", book.ID).Count(&receipts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if receipts != 2 {
+		t.Errorf("got %d receipts, want one per request", receipts)
+	}
+}
+
+func TestFailedCommandsFailTheSameWayAgain(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 1)
+	loan, err := PlaceReceiptOnce("loan", 1, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := PlaceReceiptOnce("request-1", 2, book.ID); !errors.Is(err, ErrBookNotAvailable) {
+		t.Fatalf("got %v, want %v", err, ErrBookNotAvailable)
+	}
+	if _, err := PlaceReceiptOnce("request-2", 2, 9999); !errors.Is(err, ErrBookNotFound) {
+		t.Errorf("missing book: got %v, want %v", err, ErrBookNotFound)
+	}
+
+	// Once the copy is back the refused request still fails, and a new one succeeds
+	if err := UpdateReceiptStatus(loan.ID, model.ReceiptStatusCanceled); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PlaceReceiptOnce("request-1", 2, book.ID); !errors.Is(err, ErrBookNotAvailable) {
+		t.Errorf("repeating a refused request: got %v, want %v", err, ErrBookNotAvailable)
+	}
+	if _, err := PlaceReceiptOnce("request-3", 2, book.ID); err != nil {
+		t.Errorf("a new request: %v", err)
+	}
+}
+
+func TestCancelReceiptOnce(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 2)
+	pending, err := PlaceReceiptOnce("place-pending", 1, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taken, err := PlaceReceiptOnce("place-taken", 1, book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateReceiptStatus(taken.ID, model.ReceiptStatusOwned); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CancelReceiptOnce("cancel-other", 2, pending.ID); !errors.Is(err, ErrReceiptNotFound) {
+		t.Errorf("another user's receipt: got %v, want %v", err, ErrReceiptNotFound)
+	}
+	if err := CancelReceiptOnce("cancel-taken", 1, taken.ID); !errors.Is(err, ErrReceiptNotPending) {
+		t.Errorf("a receipt on loan: got %v, want %v", err, ErrReceiptNotPending)
+	}
+	for i := 0; i < 2; i++ {
+		if err := CancelReceiptOnce("cancel-pending", 1, pending.ID); err != nil {
+			t.Fatalf("canceling, attempt %d: %v", i+1, err)
+		}
+	}
+	// A receipt canceled meanwhile, for instance by its pickup deadline, counts as canceled
+	if err := CancelReceiptOnce("cancel-again", 1, pending.ID); err != nil {
+		t.Errorf("a canceled receipt: %v", err)
+	}
+
+	receipt, err := GetReceiptByID(pending.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.Status != model.ReceiptStatusCanceled {
+		t.Errorf("receipt is %s, want %s", receipt.Status, model.ReceiptStatusCanceled)
+	}
+	var bookCopy model.BookCopy
+	if err := db.DB.First(&bookCopy, receipt.CopyID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bookCopy.Status != model.BookStatusAvailable {
+		t.Errorf("copy is %s, want %s", bookCopy.Status, model.BookStatusAvailable)
+	}
+}
@@ -0,0 +1,208 @@
+package service
+
+import (
+	"errors"
+	db "library-server/DB"
+	"library-server/model"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidAmount        = errors.New("amount must be positive")
+	ErrAmountExceedsBalance = errors.New("amount exceeds the outstanding balance")
+	ErrUnsupportedFineEntry = errors.New("only payments and waivers can be recorded")
+)
+
+// FineBalance is a user's outstanding fines together with the ledger entries that make it up
+type FineBalance struct {
+	UserID       uint               `json:"user_id"`
+	BalanceCents int64              `json:"balance_cents"`
+	Entries      []model.FineLedger `json:"entries"`
+}
+
+// GetFineBalance retrieves the balance and ledger of a user
+func GetFineBalance(userID uint) (*FineBalance, error) {
+	var entries []model.FineLedger
+	if err := db.DB.Where("user_id = ?", userID).Order("id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	balance := FineBalance{UserID: userID, Entries: entries}
+	for _, entry := range entries {
+		balance.BalanceCents += entry.AmountCents
+	}
+	return &balance, nil
+}
+
+// GetOutstandingFineBalances retrieves every user that currently owes fines, without their ledgers
+func GetOutstandingFineBalances() ([]FineBalance, error) {
+	// Scanned into a plain row, as gorm cannot map the Entries of a FineBalance
+	var rows []struct {
+		UserID       uint
+		BalanceCents int64
+	}
+	err := db.DB.Model(&model.FineLedger{}).
+		Select("user_id, SUM(amount_cents) AS balance_cents").
+		Group("user_id").
+		Having("SUM(amount_cents) > 0").
+		Order("user_id").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	balances := make([]FineBalance, len(rows))
+	for i, row := range rows {
+		balances[i] = FineBalance{UserID: row.UserID, BalanceCents: row.BalanceCents}
+	}
+	return balances, nil
+}
+
+// RecordFineCredit records a full or partial payment or a waiver against a
+// user's balance. The amount is given as a positive number of cents.
+func RecordFineCredit(userID uint, entryType model.FineEntryType, amountCents int64, note string, createdBy *uint) (*model.FineLedger, error) {
+	if entryType != model.FineEntryPayment && entryType != model.FineEntryWaiver {
+		return nil, ErrUnsupportedFineEntry
+	}
+	if amountCents <= 0 {
+		return nil, ErrInvalidAmount
+	}
+
+	entry := model.FineLedger{
+		UserID:      userID,
+		Type:        entryType,
+		AmountCents: -amountCents,
+		Note:        note,
+		CreatedBy:   createdBy,
+	}
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		balance, err := lockFineBalance(tx, userID)
+		if err != nil {
+			return err
+		}
+		if amountCents > balance {
+			return ErrAmountExceedsBalance
+		}
+		return tx.Create(&entry).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &entry, nil
+}
+
+// fineAccountLock is the first key of the advisory locks taken on fine accounts
+const fineAccountLock = 7007
+
+// lockFineBalance serialises the transactions that decide what to write from
+// a user's balance and returns that balance. Locking the ledger rows is not
+// enough: a user without entries has none to lock, and a transaction waiting
+// on them would not see an entry another one inserted meanwhile. User IDs past
+// 2^31 wrap around, which only makes two users share a lock.
+func lockFineBalance(tx *gorm.DB, userID uint) (int64, error) {
+	if err := tx.Exec("SELECT pg_advisory_xact_lock(?, ?)", fineAccountLock, int32(userID)).Error; err != nil {
+		return 0, err
+	}
+	var balance int64
+	err := tx.Model(&model.FineLedger{}).
+		Select("COALESCE(SUM(amount_cents), 0)").
+		Where("user_id = ?", userID).
+		Scan(&balance).Error
+	return balance, err
+}
+
+// ProcessOverdueReceipts marks owned receipts past their due date as overdue
+// and brings the fines of every overdue receipt up to date
+func ProcessOverdueReceipts(now time.Time) error {
+	var marked []model.Receipt
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// Receipts owned before due dates were computed have no due date and are never overdue
+		err := tx.Model(&marked).Clauses(clause.Returning{}).
+			Where("status = ? AND due_date > ? AND due_date < ?", model.ReceiptStatusOwned, time.Time{}, now).
+			Update("status", model.ReceiptStatusOverdue).Error
+		if err != nil {
+			return err
+		}
+		for i := range marked {
+			if err := recordReceiptStatusChange(tx, &marked[i], model.ReceiptStatusOwned, model.ReceiptStatusOverdue); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(marked) > 0 {
+		log.Printf("Marked %d receipts overdue", len(marked))
+	}
+
+	var ids []uint
+	if err := db.DB.Model(&model.Receipt{}).Where("status = ?", model.ReceiptStatusOverdue).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			// Skip receipts another replica or a request is working on right now
+			var receipt model.Receipt
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("id = ? AND status = ?", id, model.ReceiptStatusOverdue).
+				Take(&receipt).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			return accrueFine(tx, &receipt, now)
+		})
+		if err != nil {
+			log.Printf("Failed to accrue fine for receipt %d: %v", id, err)
+		}
+	}
+	return nil
+}
+
+// accrueFine records whatever part of the fine owed on a receipt past its due
+// date has not been charged yet. Days inside the grace period are free and the total is
+// capped by the loan policy, so running it repeatedly is safe.
+func accrueFine(tx *gorm.DB, receipt *model.Receipt, now time.Time) error {
+	policy, err := loanPolicyForReceipt(tx, receipt)
+	if err != nil {
+		return err
+	}
+
+	days := int64(now.Sub(receipt.DueDate).Hours()/24) - int64(policy.GracePeriodDays)
+	if days <= 0 || policy.FinePerDayCents == 0 {
+		return nil
+	}
+	owed := days * policy.FinePerDayCents
+	if policy.MaxFineCents > 0 && owed > policy.MaxFineCents {
+		owed = policy.MaxFineCents
+	}
+
+	var charged int64
+	err = tx.Model(&model.FineLedger{}).
+		Select("COALESCE(SUM(amount_cents), 0)").
+		Where("receipt_id = ? AND type = ?", receipt.ID, model.FineEntryFine).
+		Scan(&charged).Error
+	if err != nil {
+		return err
+	}
+	if owed <= charged {
+		return nil
+	}
+
+	return tx.Create(&model.FineLedger{
+		UserID:      receipt.UserID,
+		ReceiptID:   &receipt.ID,
+		Type:        model.FineEntryFine,
+		AmountCents: owed - charged,
+		Note:        "Overdue fine",
+	}).Error
+}
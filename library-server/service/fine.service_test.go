@@ -0,0 +1,134 @@
+package service
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+)
+
+// createOwnedReceipt lends a new book's only copy to a patron, due at dueDate
+func createOwnedReceipt(t *testing.T, dueDate time.Time) model.Receipt {
+	t.Helper()
+	book := createTestBook(t, 1)
+	receipt := model.Receipt{UserID: 1, BookID: book.ID}
+	if err := CreateReceipt(&receipt); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateReceiptStatus(receipt.ID, model.ReceiptStatusOwned); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.Model(&receipt).Update("due_date", dueDate).Error; err != nil {
+		t.Fatal(err)
+	}
+	return receipt
+}
+
+func TestClosingLateOwnedReceiptChargesFine(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	lateDays := int64(3)
+	due := time.Now().AddDate(0, 0, -int(lateDays)).Add(-time.Hour)
+
+	for _, status := range []model.ReceiptStatus{model.ReceiptStatusReturned, model.ReceiptStatusLost} {
+		t.Run(string(status), func(t *testing.T) {
+			// The overdue scan has not run, so the receipt is still owned
+			receipt := createOwnedReceipt(t, due)
+			if err := UpdateReceiptStatus(receipt.ID, status); err != nil {
+				t.Fatalf("moving receipt to %s: %v", status, err)
+			}
+
+			var fines []model.FineLedger
+			if err := db.DB.Where("receipt_id = ?", receipt.ID).Find(&fines).Error; err != nil {
+				t.Fatal(err)
+			}
+			want := lateDays * DefaultLoanPolicy.FinePerDayCents
+			if len(fines) != 1 || fines[0].AmountCents != want {
+				t.Errorf("got fines %+v, want one fine of %d", fines, want)
+			}
+		})
+	}
+}
+
+func TestReturningOnTimeChargesNothing(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	receipt := createOwnedReceipt(t, time.Now().AddDate(0, 0, 1))
+
+	if err := UpdateReceiptStatus(receipt.ID, model.ReceiptStatusReturned); err != nil {
+		t.Fatal(err)
+	}
+	var fines int64
+	if err := db.DB.Model(&model.FineLedger{}).Where("receipt_id = ?", receipt.ID).Count(&fines).Error; err != nil {
+		t.Fatal(err)
+	}
+	if fines != 0 {
+		t.Errorf("got %d fines for a return before the due date, want none", fines)
+	}
+}
+
+func TestConcurrentCreditsNeverOverdrawBalance(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	const owed = 500
+	fine := model.FineLedger{UserID: 7, Type: model.FineEntryFine, AmountCents: owed, Note: "Overdue fine"}
+	if err := db.DB.Create(&fine).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Payments and waivers race for the same balance; only one of them fits
+	const credits = 10
+	results := make(chan error, credits)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < credits; i++ {
+		entryType := model.FineEntryPayment
+		if i%2 == 1 {
+			entryType = model.FineEntryWaiver
+		}
+		wg.Add(1)
+		go func(entryType model.FineEntryType) {
+			defer wg.Done()
+			<-start
+			_, err := RecordFineCredit(fine.UserID, entryType, owed, "", nil)
+			results <- err
+		}(entryType)
+	}
+	close(start)
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrAmountExceedsBalance):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d credits succeeded, want 1", succeeded)
+	}
+	balance, err := GetFineBalance(fine.UserID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.BalanceCents != 0 {
+		t.Errorf("balance is %d, want 0", balance.BalanceCents)
+	}
+}
+
+func TestCreditWithoutFinesIsRefused(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	if _, err := RecordFineCredit(8, model.FineEntryPayment, 100, "", nil); !errors.Is(err, ErrAmountExceedsBalance) {
+		t.Errorf("paying without fines returned %v, want ErrAmountExceedsBalance", err)
+	}
+	if _, err := RecordFineCredit(8, model.FineEntryFine, 100, "", nil); !errors.Is(err, ErrUnsupportedFineEntry) {
+		t.Errorf("recording a fine returned %v, want ErrUnsupportedFineEntry", err)
+	}
+	if _, err := RecordFineCredit(8, model.FineEntryWaiver, 0, "", nil); !errors.Is(err, ErrInvalidAmount) {
+		t.Errorf("waiving nothing returned %v, want ErrInvalidAmount", err)
+	}
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"errors"
+	db "library-server/DB"
+	"library-server/model"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrHoldNotFound   = errors.New("hold not found")
+	ErrHoldExists     = errors.New("user is already waiting for this book")
+	ErrBookAvailable  = errors.New("book has an available copy; place a receipt instead")
+	ErrHoldNotWaiting = errors.New("hold is no longer waiting")
+)
+
+// defaultPickupWindow is how long a patron has to collect a reserved copy
+// when PICKUP_WINDOW_HOURS is not set
+const defaultPickupWindow = 72 * time.Hour
+
+// pickupWindow returns how long a pending receipt may wait to be collected
+func pickupWindow() time.Duration {
+	if hours, err := strconv.Atoi(os.Getenv("PICKUP_WINDOW_HOURS")); err == nil && hours > 0 {
+		return time.Duration(hours) * time.Hour
+	}
+	return defaultPickupWindow
+}
+
+// PlaceHold adds the user to the end of the queue for a book with no available copies
+func PlaceHold(hold *model.Hold) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the book so concurrent holds and placements see a consistent queue
+		var book model.Book
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&book, hold.BookID).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrBookNotFound
+			}
+			return err
+		}
+
+		var available int64
+		err = tx.Model(&model.BookCopy{}).
+			Where("book_id = ? AND status = ?", hold.BookID, model.BookStatusAvailable).
+			Count(&available).Error
+		if err != nil {
+			return err
+		}
+		if available > 0 {
+			return ErrBookAvailable
+		}
+
+		var existing int64
+		err = tx.Model(&model.Hold{}).
+			Where("user_id = ? AND book_id = ? AND status = ?", hold.UserID, hold.BookID, model.HoldStatusWaiting).
+			Count(&existing).Error
+		if err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ErrHoldExists
+		}
+
+		hold.ID = 0
+		hold.Status = model.HoldStatusWaiting
+		hold.ReceiptID = nil
+		if err := tx.Omit("Book").Create(hold).Error; err != nil {
+			return err
+		}
+		return fillHoldPositions(tx, []*model.Hold{hold})
+	})
+}
+
+// GetHoldByID retrieves a hold and its queue position by ID
+func GetHoldByID(id uint) (*model.Hold, error) {
+	var hold model.Hold
+	if err := db.DB.Preload("Book").First(&hold, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHoldNotFound
+		}
+		return nil, err
+	}
+	if err := fillHoldPositions(db.DB, []*model.Hold{&hold}); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// GetHoldsByUserID retrieves every hold of a user with the queue position of those still waiting
+func GetHoldsByUserID(userID uint) ([]model.Hold, error) {
+	var holds []model.Hold
+	if err := db.DB.Preload("Book").Where("user_id = ?", userID).Order("id").Find(&holds).Error; err != nil {
+		return nil, err
+	}
+	if err := fillHoldPositions(db.DB, holdPointers(holds)); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// GetHoldsByBookID retrieves the waiting queue of a book in FIFO order
+func GetHoldsByBookID(bookID uint) ([]model.Hold, error) {
+	var holds []model.Hold
+	result := db.DB.Where("book_id = ? AND status = ?", bookID, model.HoldStatusWaiting).Order("id").Find(&holds)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for i := range holds {
+		holds[i].Position = int64(i + 1)
+	}
+	return holds, nil
+}
+
+// CancelHold takes a waiting hold out of the queue
+func CancelHold(id uint) error {
+	result := db.DB.Model(&model.Hold{}).
+		Where("id = ? AND status = ?", id, model.HoldStatusWaiting).
+		Update("status", model.HoldStatusCanceled)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		if _, err := GetHoldByID(id); err != nil {
+			return err
+		}
+		return ErrHoldNotWaiting
+	}
+	return nil
+}
+
+// releaseCopy makes a copy available again, unless someone is queued for its
+// book, in which case the oldest hold is promoted to a pending receipt for it
+func releaseCopy(tx *gorm.DB, bookCopy *model.BookCopy) error {
+	hold, err := nextHold(tx, bookCopy.BookID)
+	if err != nil {
+		return err
+	}
+	if hold == nil {
+		return setCopyStatus(tx, bookCopy, model.BookStatusAvailable)
+	}
+	if err := promoteHold(tx, hold, bookCopy); err != nil {
+		return err
+	}
+	return setCopyStatus(tx, bookCopy, model.BookStatusPlaced)
+}
+
+// nextHold locks a book and returns the oldest hold waiting for it, or nil
+// when nobody is queued
+func nextHold(tx *gorm.DB, bookID uint) (*model.Hold, error) {
+	// Serialise with PlaceHold, which checks for available copies under the same lock
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&model.Book{}, bookID).Error; err != nil {
+		return nil, err
+	}
+
+	var hold model.Hold
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("book_id = ? AND status = ?", bookID, model.HoldStatusWaiting).
+		Order("id").First(&hold).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// promoteHold fulfils a hold with a pending receipt for bookCopy. The caller
+// marks the copy placed.
+func promoteHold(tx *gorm.DB, hold *model.Hold, bookCopy *model.BookCopy) error {
+	deadline := time.Now().Add(pickupWindow())
+	receipt := model.Receipt{
+		UserID:         hold.UserID,
+		BookID:         bookCopy.BookID,
+		CopyID:         bookCopy.ID,
+		Status:         model.ReceiptStatusPending,
+		PickupDeadline: &deadline,
+	}
+	if err := tx.Omit("Book", "Copy").Create(&receipt).Error; err != nil {
+		return err
+	}
+	if err := recordReceiptCreated(tx, &receipt); err != nil {
+		return err
+	}
+	return tx.Model(hold).Updates(map[string]interface{}{
+		"status":     model.HoldStatusFulfilled,
+		"receipt_id": receipt.ID,
+	}).Error
+}
+
+// bookHasWaiters reports whether any patron is queued for a copy of the book
+func bookHasWaiters(tx *gorm.DB, bookID uint) (bool, error) {
+	var count int64
+	err := tx.Model(&model.Hold{}).
+		Where("book_id = ? AND status = ?", bookID, model.HoldStatusWaiting).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// fillHoldPositions sets the 1-based queue position of every waiting hold
+func fillHoldPositions(tx *gorm.DB, holds []*model.Hold) error {
+	for _, hold := range holds {
+		if hold.Status != model.HoldStatusWaiting {
+			continue
+		}
+		var ahead int64
+		err := tx.Model(&model.Hold{}).
+			Where("book_id = ? AND status = ? AND id < ?", hold.BookID, model.HoldStatusWaiting, hold.ID).
+			Count(&ahead).Error
+		if err != nil {
+			return err
+		}
+		hold.Position = ahead + 1
+	}
+	return nil
+}
+
+func holdPointers(holds []model.Hold) []*model.Hold {
+	pointers := make([]*model.Hold, 0, len(holds))
+	for i := range holds {
+		pointers = append(pointers, &holds[i])
+	}
+	return pointers
+}
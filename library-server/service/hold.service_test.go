@@ -0,0 +1,132 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+)
+
+// placeTestHold queues userID for book and fails the test if it cannot
+func placeTestHold(t *testing.T, userID uint, book model.Book) model.Hold {
+	t.Helper()
+	hold := model.Hold{UserID: userID, BookID: book.ID}
+	if err := PlaceHold(&hold); err != nil {
+		t.Fatalf("queueing user %d: %v", userID, err)
+	}
+	return hold
+}
+
+func holdPosition(t *testing.T, id uint) (model.HoldStatus, int64) {
+	t.Helper()
+	hold, err := GetHoldByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return hold.Status, hold.Position
+}
+
+func TestHoldQueueIsFirstInFirstOut(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	t.Setenv("PICKUP_WINDOW_HOURS", "5")
+	book := createTestBook(t, 1)
+
+	if err := PlaceHold(&model.Hold{UserID: 2, BookID: book.ID}); !errors.Is(err, ErrBookAvailable) {
+		t.Fatalf("queueing for an available book: got %v, want %v", err, ErrBookAvailable)
+	}
+	loan := model.Receipt{UserID: 1, BookID: book.ID}
+	if err := CreateReceipt(&loan); err != nil {
+		t.Fatal(err)
+	}
+
+	first := placeTestHold(t, 2, book)
+	second := placeTestHold(t, 3, book)
+	third := placeTestHold(t, 4, book)
+	if err := PlaceHold(&model.Hold{UserID: 2, BookID: book.ID}); !errors.Is(err, ErrHoldExists) {
+		t.Errorf("queueing twice: got %v, want %v", err, ErrHoldExists)
+	}
+	for i, hold := range []model.Hold{first, second, third} {
+		if hold.Position != int64(i+1) {
+			t.Errorf("user %d is at position %d, want %d", hold.UserID, hold.Position, i+1)
+		}
+	}
+
+	if err := CancelHold(second.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := CancelHold(second.ID); !errors.Is(err, ErrHoldNotWaiting) {
+		t.Errorf("leaving twice: got %v, want %v", err, ErrHoldNotWaiting)
+	}
+	if _, position := holdPosition(t, third.ID); position != 2 {
+		t.Errorf("after a hold ahead left, position is %d, want 2", position)
+	}
+
+	// Returning the loan hands the copy to the head of the queue
+	for _, status := range []model.ReceiptStatus{model.ReceiptStatusOwned, model.ReceiptStatusReturned} {
+		if err := UpdateReceiptStatus(loan.ID, status); err != nil {
+			t.Fatalf("marking the loan %s: %v", status, err)
+		}
+	}
+	promoted, err := GetHoldByID(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Status != model.HoldStatusFulfilled || promoted.ReceiptID == nil {
+		t.Fatalf("got hold %s with receipt %v, want it fulfilled", promoted.Status, promoted.ReceiptID)
+	}
+	receipt, err := GetReceiptByID(*promoted.ReceiptID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.UserID != first.UserID || receipt.Status != model.ReceiptStatusPending || receipt.CopyID != book.Copies[0].ID {
+		t.Errorf("got receipt %+v, want a pending receipt of the returned copy for user %d", receipt, first.UserID)
+	}
+	if receipt.PickupDeadline == nil || time.Until(*receipt.PickupDeadline) < 4*time.Hour || time.Until(*receipt.PickupDeadline) > 5*time.Hour {
+		t.Errorf("got pickup deadline %v, want five hours from now", receipt.PickupDeadline)
+	}
+	var bookCopy model.BookCopy
+	if err := db.DB.First(&bookCopy, book.Copies[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bookCopy.Status != model.BookStatusPlaced {
+		t.Errorf("copy is %s, want %s", bookCopy.Status, model.BookStatusPlaced)
+	}
+
+	queue, err := GetHoldsByBookID(book.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 1 || queue[0].ID != third.ID || queue[0].Position != 1 {
+		t.Errorf("got queue %+v, want only user %d at the head", queue, third.UserID)
+	}
+}
+
+func TestReleasedCopyGoesBackToTheShelfWithoutHolds(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 1)
+	receipt := model.Receipt{UserID: 1, BookID: book.ID}
+	if err := CreateReceipt(&receipt); err != nil {
+		t.Fatal(err)
+	}
+	hold := placeTestHold(t, 2, book)
+	if err := CancelHold(hold.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := UpdateReceiptStatus(receipt.ID, model.ReceiptStatusCanceled); err != nil {
+		t.Fatal(err)
+	}
+	var bookCopy model.BookCopy
+	if err := db.DB.First(&bookCopy, book.Copies[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bookCopy.Status != model.BookStatusAvailable {
+		t.Errorf("copy is %s, want %s", bookCopy.Status, model.BookStatusAvailable)
+	}
+	if status, _ := holdPosition(t, hold.ID); status != model.HoldStatusCanceled {
+		t.Errorf("a canceled hold became %s", status)
+	}
+}
@@ -0,0 +1,139 @@
+package service
+
+import (
+	"errors"
+	db "library-server/DB"
+	"library-server/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLoanPolicyNotFound = errors.New("loan policy not found")
+	ErrLoanPolicyExists   = errors.New("a loan policy already exists for this category and item type")
+)
+
+// DefaultLoanPolicy applies when no configured loan policy matches a copy, not
+// even a library-wide default
+var DefaultLoanPolicy = model.LoanPolicy{
+	Name:            "Built-in default",
+	LoanPeriodDays:  14,
+	MaxRenewals:     2,
+	GracePeriodDays: 0,
+	FinePerDayCents: 25,
+	MaxFineCents:    1000,
+}
+
+// CreateLoanPolicy creates a new loan policy in the database
+func CreateLoanPolicy(policy *model.LoanPolicy) error {
+	if err := validateLoanPolicyScope(policy); err != nil {
+		return err
+	}
+	policy.ID = 0
+	return db.DB.Omit("Category").Create(policy).Error
+}
+
+// GetAllLoanPolicies retrieves every configured loan policy
+func GetAllLoanPolicies() ([]model.LoanPolicy, error) {
+	var policies []model.LoanPolicy
+	result := db.DB.Preload("Category").Order("id").Find(&policies)
+	return policies, result.Error
+}
+
+// GetLoanPolicyByID retrieves a loan policy by its ID
+func GetLoanPolicyByID(id uint) (*model.LoanPolicy, error) {
+	var policy model.LoanPolicy
+	if err := db.DB.Preload("Category").First(&policy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrLoanPolicyNotFound
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// UpdateLoanPolicy updates an existing loan policy
+func UpdateLoanPolicy(policy *model.LoanPolicy) error {
+	if _, err := GetLoanPolicyByID(policy.ID); err != nil {
+		return err
+	}
+	if err := validateLoanPolicyScope(policy); err != nil {
+		return err
+	}
+	return db.DB.Model(policy).Select("Name", "CategoryID", "ItemType", "LoanPeriodDays", "MaxRenewals", "GracePeriodDays", "FinePerDayCents", "MaxFineCents").Updates(policy).Error
+}
+
+// DeleteLoanPolicy deletes a loan policy by its ID
+func DeleteLoanPolicy(id uint) error {
+	result := db.DB.Delete(&model.LoanPolicy{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrLoanPolicyNotFound
+	}
+	return nil
+}
+
+// validateLoanPolicyScope checks that the policy's category exists and that no
+// other policy has the same category and item type; only one policy may be the
+// library-wide default
+func validateLoanPolicyScope(policy *model.LoanPolicy) error {
+	if policy.CategoryID != nil {
+		var count int64
+		if err := db.DB.Model(&model.Category{}).Where("id = ?", *policy.CategoryID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrCategoryNotFound
+		}
+	}
+
+	query := db.DB.Model(&model.LoanPolicy{}).Where("id <> ?", policy.ID)
+	if policy.CategoryID != nil {
+		query = query.Where("category_id = ?", *policy.CategoryID)
+	} else {
+		query = query.Where("category_id IS NULL")
+	}
+	if policy.ItemType != nil {
+		query = query.Where("item_type = ?", *policy.ItemType)
+	} else {
+		query = query.Where("item_type IS NULL")
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrLoanPolicyExists
+	}
+	return nil
+}
+
+// loanPolicyForReceipt resolves the policy that governs the loan of a receipt's
+// copy. A policy for both the book's category and the copy's item type wins over
+// one for the item type alone, which wins over one for the category alone, then
+// the library-wide default and finally DefaultLoanPolicy.
+func loanPolicyForReceipt(tx *gorm.DB, receipt *model.Receipt) (model.LoanPolicy, error) {
+	var book model.Book
+	if err := tx.First(&book, receipt.BookID).Error; err != nil {
+		return model.LoanPolicy{}, err
+	}
+	var bookCopy model.BookCopy
+	if err := tx.First(&bookCopy, receipt.CopyID).Error; err != nil {
+		return model.LoanPolicy{}, err
+	}
+
+	var policies []model.LoanPolicy
+	err := tx.Where("category_id = ? OR category_id IS NULL", book.CategoryID).
+		Where("item_type = ? OR item_type IS NULL", bookCopy.ItemType).
+		Order("item_type IS NULL").Order("category_id IS NULL").
+		Limit(1).Find(&policies).Error
+	if err != nil {
+		return model.LoanPolicy{}, err
+	}
+	if len(policies) == 0 {
+		return DefaultLoanPolicy, nil
+	}
+	return policies[0], nil
+}
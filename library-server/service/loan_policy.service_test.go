@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+)
+
+func TestLoanPolicyPrecedence(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 1)
+	bookCopy := book.Copies[0]
+	if err := db.DB.Model(&bookCopy).Update("item_type", "dvd").Error; err != nil {
+		t.Fatal(err)
+	}
+	receipt := model.Receipt{UserID: 1, BookID: book.ID, CopyID: bookCopy.ID}
+
+	dvd := "dvd"
+	scopes := []struct {
+		name       string
+		categoryID *uint
+		itemType   *string
+	}{
+		{"Library default", nil, nil},
+		{"Category", &book.CategoryID, nil},
+		{"Item type", nil, &dvd},
+		{"Category and item type", &book.CategoryID, &dvd},
+	}
+
+	policy, err := loanPolicyForReceipt(db.DB, &receipt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Name != DefaultLoanPolicy.Name {
+		t.Fatalf("got policy %q with nothing configured, want the built-in default", policy.Name)
+	}
+
+	// Each added policy is more specific than the ones before it
+	for _, scope := range scopes {
+		err := CreateLoanPolicy(&model.LoanPolicy{
+			Name:           scope.name,
+			CategoryID:     scope.categoryID,
+			ItemType:       scope.itemType,
+			LoanPeriodDays: 7,
+		})
+		if err != nil {
+			t.Fatalf("creating %s policy: %v", scope.name, err)
+		}
+		policy, err := loanPolicyForReceipt(db.DB, &receipt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policy.Name != scope.name {
+			t.Errorf("got policy %q, want %q", policy.Name, scope.name)
+		}
+	}
+
+	err = CreateLoanPolicy(&model.LoanPolicy{Name: "Duplicate", ItemType: &dvd, LoanPeriodDays: 7})
+	if !errors.Is(err, ErrLoanPolicyExists) {
+		t.Fatalf("creating a second item type policy returned %v, want ErrLoanPolicyExists", err)
+	}
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"errors"
+	"library-contract/throttle"
+	db "library-server/DB"
+)
+
+// ErrInvalidCredentials is returned for every failed login, whether the
+// username is unknown, the password is wrong or the account is disabled
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+// LoginLockedError is returned while the account or address a login comes
+// from is locked out
+type LoginLockedError = throttle.LockedError
+
+// UnlockAdmin lifts a lockout on an admin account and records who lifted it
+func UnlockAdmin(id uint, actorID *uint) error {
+	admin, err := GetAdminByID(id)
+	if err != nil {
+		return err
+	}
+	return throttle.Unlock(db.DB, throttle.AccountSubject(admin.Username), actorID)
+}
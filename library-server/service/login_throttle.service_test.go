@@ -0,0 +1,109 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"library-contract/throttle"
+	db "library-server/DB"
+	"library-server/dbtest"
+)
+
+// failLogins tries a wrong password n times
+func failLogins(t *testing.T, username, ip string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if _, _, err := Login(username, "wrong horse", ip); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failed login %d: got %v, want %v", i+1, err, ErrInvalidCredentials)
+		}
+	}
+}
+
+// lockedFor returns how long a login to username from ip has to wait, or
+// zero when it goes through
+func lockedFor(t *testing.T, username, ip string) time.Duration {
+	t.Helper()
+	_, _, err := Login(username, "correct horse", ip)
+	var locked *LoginLockedError
+	if errors.As(err, &locked) {
+		return locked.RetryAfter
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return 0
+}
+
+func TestLoginLocksTheAccountAfterRepeatedFailures(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	t.Setenv("REQUIRE_ADMIN_TOTP", "")
+	actor := createTestAdmin(t, "head")
+	admin := createTestAdmin(t, "librarian")
+
+	// A successful login forgets earlier failures
+	failLogins(t, "librarian", "192.0.2.1", 4)
+	if wait := lockedFor(t, "librarian", "192.0.2.1"); wait != 0 {
+		t.Fatalf("locked for %s after four failures", wait)
+	}
+	failLogins(t, "librarian", "192.0.2.1", 4)
+	if wait := lockedFor(t, "librarian", "192.0.2.1"); wait != 0 {
+		t.Fatalf("locked for %s after four failures since the last login", wait)
+	}
+
+	failLogins(t, "librarian", "192.0.2.1", 5)
+	if wait := lockedFor(t, "librarian", "198.51.100.1"); wait <= 0 || wait > time.Minute {
+		t.Fatalf("locked for %s from another address, want up to a minute", wait)
+	}
+	if wait := lockedFor(t, "head", "192.0.2.1"); wait != 0 {
+		t.Errorf("another account from the same address is locked for %s", wait)
+	}
+
+	// Each failure after the lock runs out doubles it
+	if err := db.DB.Model(&throttle.LoginThrottle{}).Where("subject = ?", throttle.AccountSubject("librarian")).
+		Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	failLogins(t, "librarian", "192.0.2.1", 1)
+	if wait := lockedFor(t, "librarian", "192.0.2.1"); wait <= time.Minute || wait > 2*time.Minute {
+		t.Errorf("locked for %s after another failure, want up to two minutes", wait)
+	}
+
+	if err := UnlockAdmin(admin.ID, &actor.ID); err != nil {
+		t.Fatal(err)
+	}
+	if wait := lockedFor(t, "librarian", "192.0.2.1"); wait != 0 {
+		t.Errorf("locked for %s after being unlocked", wait)
+	}
+	var events []throttle.LockoutEvent
+	if err := db.DB.Where("subject = ?", throttle.AccountSubject("librarian")).Order("id").Find(&events).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 3 || events[0].Action != throttle.LockoutActionLocked || events[1].Action != throttle.LockoutActionLocked ||
+		events[2].Action != throttle.LockoutActionUnlocked || events[2].ActorID == nil || *events[2].ActorID != actor.ID {
+		t.Errorf("got lockout history %+v, want two locks and an unlock by %d", events, actor.ID)
+	}
+	if err := UnlockAdmin(9999, &actor.ID); !errors.Is(err, ErrAdminNotFound) {
+		t.Errorf("unlocking a missing admin: got %v, want %v", err, ErrAdminNotFound)
+	}
+}
+
+func TestLoginLocksTheAddressAfterRepeatedFailures(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	t.Setenv("REQUIRE_ADMIN_TOTP", "")
+	createTestAdmin(t, "librarian")
+
+	// Guessing across many accounts never locks any one of them
+	for i := 0; i < 20; i++ {
+		failLogins(t, fmt.Sprintf("guess%d", i), "203.0.113.9", 1)
+	}
+	if wait := lockedFor(t, "librarian", "203.0.113.9"); wait <= 0 {
+		t.Error("the guessing address was not locked")
+	}
+	if wait := lockedFor(t, "librarian", "192.0.2.1"); wait != 0 {
+		t.Errorf("locked for %s from another address", wait)
+	}
+}
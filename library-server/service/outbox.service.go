@@ -0,0 +1,132 @@
+package service
+
+import (
+	"encoding/json"
+	apiv1 "library-contract/v1"
+	db "library-server/DB"
+	"library-server/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// outboxBatchSize bounds how many events a single relay transaction locks
+const outboxBatchSize = 100
+
+// outboxRetention is how long published events are kept before they are purged
+const outboxRetention = 7 * 24 * time.Hour
+
+// recordEvent adds a domain event to the outbox as part of tx, so it is only
+// published if tx commits
+func recordEvent(tx *gorm.DB, eventType string, payload interface{}) error {
+	message, err := apiv1.NewMessage(eventType, payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.OutboxEvent{
+		MessageID: message.ID,
+		Type:      message.Type,
+		Payload:   string(message.Payload),
+		CreatedAt: message.SentAt,
+	}).Error
+}
+
+// setCopyStatus changes the status of a copy and records the change
+func setCopyStatus(tx *gorm.DB, bookCopy *model.BookCopy, status model.BookStatus) error {
+	from := bookCopy.Status
+	if err := tx.Model(bookCopy).Update("status", status).Error; err != nil {
+		return err
+	}
+	if from == status {
+		return nil
+	}
+	return recordEvent(tx, apiv1.MessageBookStatusChanged, apiv1.BookStatusChanged{
+		BookID: bookCopy.BookID,
+		CopyID: bookCopy.ID,
+		From:   string(from),
+		To:     string(status),
+	})
+}
+
+func recordReceiptCreated(tx *gorm.DB, receipt *model.Receipt) error {
+	return recordEvent(tx, apiv1.MessageReceiptCreated, apiv1.ReceiptCreated{
+		ReceiptID:      receipt.ID,
+		UserID:         receipt.UserID,
+		BookID:         receipt.BookID,
+		CopyID:         receipt.CopyID,
+		Status:         string(receipt.Status),
+		PickupDeadline: receipt.PickupDeadline,
+	})
+}
+
+func recordReceiptStatusChange(tx *gorm.DB, receipt *model.Receipt, from, to model.ReceiptStatus) error {
+	return recordEvent(tx, apiv1.MessageReceiptStatusChanged, apiv1.ReceiptStatusChanged{
+		ReceiptID: receipt.ID,
+		UserID:    receipt.UserID,
+		BookID:    receipt.BookID,
+		CopyID:    receipt.CopyID,
+		From:      string(from),
+		To:        string(to),
+	})
+}
+
+// RelayOutboxEvents hands unpublished outbox events to publish, oldest first,
+// and marks each one published once publish succeeds. Events are claimed with
+// SKIP LOCKED, so replicas relaying at the same time never send the same
+// batch. An event is sent again if the process stops between publishing it and
+// marking it, so delivery is at least once. Relaying stops at the first event
+// that fails to publish and it is tried again on the next run.
+func RelayOutboxEvents(publish func(message *apiv1.Message) error) (int, error) {
+	relayed := 0
+	for {
+		claimed, marked := 0, 0
+		var publishErr error
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			var events []model.OutboxEvent
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("published_at IS NULL").
+				Order("id").Limit(outboxBatchSize).Find(&events).Error
+			if err != nil {
+				return err
+			}
+			claimed = len(events)
+
+			for i := range events {
+				event := &events[i]
+				publishErr = publish(&apiv1.Message{
+					ID:      event.MessageID,
+					Type:    event.Type,
+					Version: apiv1.Version,
+					SentAt:  event.CreatedAt.UTC(),
+					Payload: json.RawMessage(event.Payload),
+				})
+				if publishErr != nil {
+					// Keep what was marked so far
+					return nil
+				}
+				if err := tx.Model(event).Update("published_at", time.Now()).Error; err != nil {
+					return err
+				}
+				marked++
+			}
+			return nil
+		})
+		if err != nil {
+			return relayed, err
+		}
+		relayed += marked
+		if publishErr != nil {
+			return relayed, publishErr
+		}
+		if claimed < outboxBatchSize {
+			return relayed, nil
+		}
+	}
+}
+
+// PurgePublishedEvents deletes outbox events published longer than
+// outboxRetention ago
+func PurgePublishedEvents(now time.Time) error {
+	return db.DB.Where("published_at < ?", now.Add(-outboxRetention)).Delete(&model.OutboxEvent{}).Error
+}
@@ -0,0 +1,176 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	apiv1 "library-contract/v1"
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+
+	"gorm.io/gorm"
+)
+
+// relayAll relays the outbox and returns what was published
+func relayAll(t *testing.T) []apiv1.Message {
+	t.Helper()
+	var published []apiv1.Message
+	relayed, err := RelayOutboxEvents(func(message *apiv1.Message) error {
+		published = append(published, *message)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if relayed != len(published) {
+		t.Errorf("reported %d events relayed, published %d", relayed, len(published))
+	}
+	return published
+}
+
+func messageTypes(messages []apiv1.Message) []string {
+	types := make([]string, len(messages))
+	for i, message := range messages {
+		types[i] = message.Type
+	}
+	return types
+}
+
+func TestChangesRecordTheirEvents(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 1)
+
+	receipt := model.Receipt{UserID: 1, BookID: book.ID}
+	if err := CreateReceipt(&receipt); err != nil {
+		t.Fatal(err)
+	}
+	// A refused change announces nothing
+	if err := CreateReceipt(&model.Receipt{UserID: 2, BookID: book.ID}); !errors.Is(err, ErrBookNotAvailable) {
+		t.Fatalf("got %v, want %v", err, ErrBookNotAvailable)
+	}
+
+	published := relayAll(t)
+	types := messageTypes(published)
+	if len(types) != 2 || types[0] != apiv1.MessageBookStatusChanged || types[1] != apiv1.MessageReceiptCreated {
+		t.Fatalf("got events %v, want the copy placed and the receipt created", types)
+	}
+	var created apiv1.ReceiptCreated
+	if err := json.Unmarshal(published[1].Payload, &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.ReceiptID != receipt.ID || created.CopyID != book.Copies[0].ID || created.Status != string(model.ReceiptStatusPending) {
+		t.Errorf("got %+v for receipt %+v", created, receipt)
+	}
+	if published[0].Version != apiv1.Version || published[0].ID == "" {
+		t.Errorf("got message %+v, want it versioned and identified", published[0])
+	}
+}
+
+func TestRelayPublishesEveryEventOnceInOrder(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	const events = outboxBatchSize + 20
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		for i := 1; i <= events; i++ {
+			if err := recordEvent(tx, apiv1.MessageBookDeleted, apiv1.BookDeleted{BookID: uint(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	published := relayAll(t)
+	if len(published) != events {
+		t.Fatalf("published %d events, want %d across batches", len(published), events)
+	}
+	for i, message := range published {
+		var deleted apiv1.BookDeleted
+		if err := json.Unmarshal(message.Payload, &deleted); err != nil {
+			t.Fatal(err)
+		}
+		if deleted.BookID != uint(i+1) {
+			t.Fatalf("event %d is for book %d, want them in the order recorded", i, deleted.BookID)
+		}
+	}
+	if again := relayAll(t); len(again) != 0 {
+		t.Errorf("published %d events again", len(again))
+	}
+}
+
+func TestRelayStopsAtTheFirstFailure(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		for i := 1; i <= 3; i++ {
+			if err := recordEvent(tx, apiv1.MessageBookDeleted, apiv1.BookDeleted{BookID: uint(i)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var attempted []apiv1.Message
+	brokerDown := errors.New("broker is down")
+	relayed, err := RelayOutboxEvents(func(message *apiv1.Message) error {
+		attempted = append(attempted, *message)
+		if len(attempted) == 2 {
+			return brokerDown
+		}
+		return nil
+	})
+	if !errors.Is(err, brokerDown) || relayed != 1 {
+		t.Fatalf("got %d relayed and %v, want 1 and the publish error", relayed, err)
+	}
+
+	// The next run resumes with the event that failed, under the same message ID
+	published := relayAll(t)
+	if len(published) != 2 || published[0].ID != attempted[1].ID {
+		t.Errorf("got %d events starting with %s, want the failed event %s and the one after it", len(published), published[0].ID, attempted[1].ID)
+	}
+}
+
+func TestPurgePublishedEvents(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		return recordEvent(tx, apiv1.MessageBookDeleted, apiv1.BookDeleted{BookID: 1})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	relayAll(t)
+	err = db.DB.Transaction(func(tx *gorm.DB) error {
+		return recordEvent(tx, apiv1.MessageBookDeleted, apiv1.BookDeleted{BookID: 2})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PurgePublishedEvents(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	var kept int64
+	if err := db.DB.Model(&model.OutboxEvent{}).Count(&kept).Error; err != nil {
+		t.Fatal(err)
+	}
+	if kept != 2 {
+		t.Fatalf("kept %d events, want recently published ones kept", kept)
+	}
+
+	if err := PurgePublishedEvents(time.Now().Add(outboxRetention + time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	var left []model.OutboxEvent
+	if err := db.DB.Find(&left).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(left) != 1 || left[0].PublishedAt != nil {
+		t.Errorf("got %+v, want only the unpublished event left", left)
+	}
+}
@@ -0,0 +1,64 @@
+package service
+
+import (
+	"errors"
+	db "library-server/DB"
+	"library-server/model"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AnonymousUserID replaces the user ID on the records of patrons who deleted their account
+const AnonymousUserID = 0
+
+var (
+	ErrPatronHasLoans  = errors.New("patron still has books reserved or on loan")
+	ErrPatronOwesFines = errors.New("patron still owes fines")
+)
+
+// AnonymizePatron detaches a patron's receipts, holds and fine ledger from
+// them so their borrowing history can no longer be traced back once their
+// account is deleted. Waiting holds are canceled. Patrons with a reserved or
+// borrowed book, or with outstanding fines, must settle those first.
+func AnonymizePatron(userID uint) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		// Lock the patron's receipts so none can change status underneath us
+		var receipts []model.Receipt
+		err := tx.Unscoped().Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", userID).Find(&receipts).Error
+		if err != nil {
+			return err
+		}
+		for _, receipt := range receipts {
+			switch receipt.Status {
+			case model.ReceiptStatusPending, model.ReceiptStatusOwned, model.ReceiptStatusOverdue:
+				if !receipt.DeletedAt.Valid {
+					return ErrPatronHasLoans
+				}
+			}
+		}
+
+		balance, err := lockFineBalance(tx, userID)
+		if err != nil {
+			return err
+		}
+		if balance > 0 {
+			return ErrPatronOwesFines
+		}
+
+		err = tx.Model(&model.Hold{}).
+			Where("user_id = ? AND status = ?", userID, model.HoldStatusWaiting).
+			Update("status", model.HoldStatusCanceled).Error
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&model.Hold{}).Where("user_id = ?", userID).Update("user_id", AnonymousUserID).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&model.FineLedger{}).Where("user_id = ?", userID).Update("user_id", AnonymousUserID).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Model(&model.Receipt{}).Where("user_id = ?", userID).Update("user_id", AnonymousUserID).Error
+	})
+}
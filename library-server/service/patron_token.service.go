@@ -0,0 +1,35 @@
+package service
+
+import (
+	"errors"
+	"library-contract/signing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PatronTokenIssuer is the iss claim of the access tokens order-server issues to patrons
+const PatronTokenIssuer = "order-server"
+
+// patronKeys holds the keys order-server publishes at ORDER_SERVER_JWKS_URL
+var patronKeys = signing.NewRemoteKeys(PatronTokenIssuer, "ORDER_SERVER_JWKS_URL")
+
+// PatronClaims are the claims of the access tokens order-server issues to patrons
+type PatronClaims struct {
+	UserID  uint `json:"id"`
+	Version int  `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+// VerifyPatronToken checks a patron access token against the keys order-server
+// publishes at ORDER_SERVER_JWKS_URL. Revocations recorded by order-server are
+// not visible here; the short lifetime of access tokens bounds that window.
+func VerifyPatronToken(tokenString string) (*PatronClaims, error) {
+	claims := &PatronClaims{}
+	if _, err := patronKeys.Parse(tokenString, claims); err != nil {
+		return nil, err
+	}
+	if claims.UserID == 0 {
+		return nil, errors.New("token has no user")
+	}
+	return claims, nil
+}
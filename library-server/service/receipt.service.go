@@ -2,85 +2,336 @@ package service
 
 import (
 	"errors"
+	"fmt"
+	apiv1 "library-contract/v1"
 	db "library-server/DB"
 	"library-server/model"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var ErrBookNotAvailable = errors.New("book is not available for placement")
+
+// CreateReceipt reserves any available copy of the requested book for the receipt.
+// The copy is locked and marked placed in the same transaction that creates the
+// receipt, so concurrent placements can never reserve the same copy.
 func CreateReceipt(receipt *model.Receipt) error {
-	result := db.DB.Create(receipt)
-	if result.Error == nil {
-		// Update the book status to "placed" only if it's currently "available"
-		err := db.DB.Model(&model.Book{}).
-			Where("id = ? AND status = ?", receipt.BookID, model.BookStatusAvailable).
-			Update("status", model.BookStatusPlaced).Error
-		if err != nil {
-			// If updating book status fails, delete the created receipt
-			db.DB.Delete(receipt)
-			return err
-		}
-		// Check if the book status was actually updated
-		var updatedBook model.Book
-		if err := db.DB.First(&updatedBook, receipt.BookID).Error; err != nil {
-			db.DB.Delete(receipt)
-			return err
-		}
-		if updatedBook.Status != model.BookStatusPlaced {
-			// If the book wasn't available, delete the created receipt
-			db.DB.Delete(receipt)
-			return errors.New("book is not available for placement")
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return createReceipt(tx, receipt)
+	})
+}
+
+func createReceipt(tx *gorm.DB, receipt *model.Receipt) error {
+	// A shared lock keeps the book from being deleted while placements for it
+	// run side by side
+	err := tx.Clauses(clause.Locking{Strength: "SHARE"}).First(&model.Book{}, receipt.BookID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrBookNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	// Skip copies other transactions are reserving instead of waiting on them
+	var bookCopy model.BookCopy
+	err = tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("book_id = ? AND status = ?", receipt.BookID, model.BookStatusAvailable).
+		Order("id").First(&bookCopy).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrBookNotAvailable
 		}
+		return err
+	}
+
+	if err := setCopyStatus(tx, &bookCopy, model.BookStatusPlaced); err != nil {
+		return err
+	}
+
+	receipt.ID = 0
+	receipt.CopyID = bookCopy.ID
+	receipt.Status = model.ReceiptStatusPending
+	receipt.DueDate = time.Time{}
+	receipt.Renewals = 0
+	deadline := time.Now().Add(pickupWindow())
+	receipt.PickupDeadline = &deadline
+	receipt.CancelReason = ""
+	if err := tx.Omit("Book", "Copy").Create(receipt).Error; err != nil {
+		return err
 	}
-	return result.Error
+	return recordReceiptCreated(tx, receipt)
 }
+
 func GetReceiptByUserID(userID uint) ([]model.Receipt, error) {
 	var receipts []model.Receipt
-	result := db.DB.Where("user_id = ?", userID).Find(&receipts)
+	result := db.DB.Preload("Book").Preload("Copy").Where("user_id = ?", userID).Find(&receipts)
 	return receipts, result.Error
 }
 
 func GetReceiptByID(id uint) (*model.Receipt, error) {
 	var receipt model.Receipt
-	result := db.DB.Preload("Book").First(&receipt, id)
+	result := db.DB.Preload("Book").Preload("Copy").First(&receipt, id)
 	return &receipt, result.Error
 }
 
+var (
+	ErrReceiptNotFound      = errors.New("receipt not found")
+	ErrUnknownReceiptStatus = errors.New("unknown receipt status")
+)
+
+// ReceiptTransitionError reports a receipt status change the lifecycle does not allow
+type ReceiptTransitionError struct {
+	From model.ReceiptStatus
+	To   model.ReceiptStatus
+}
+
+func (e *ReceiptTransitionError) Error() string {
+	return fmt.Sprintf("cannot change receipt status from %s to %s", e.From, e.To)
+}
+
+// receiptTransitions lists every allowed receipt status change together with
+// the status the reserved copy is left in afterwards
+var receiptTransitions = map[model.ReceiptStatus]map[model.ReceiptStatus]model.BookStatus{
+	model.ReceiptStatusPending: {
+		model.ReceiptStatusOwned:    model.BookStatusTaken,
+		model.ReceiptStatusCanceled: model.BookStatusAvailable,
+	},
+	model.ReceiptStatusOwned: {
+		model.ReceiptStatusOverdue:  model.BookStatusTaken,
+		model.ReceiptStatusReturned: model.BookStatusAvailable,
+		model.ReceiptStatusLost:     model.BookStatusLost,
+	},
+	model.ReceiptStatusOverdue: {
+		model.ReceiptStatusReturned: model.BookStatusAvailable,
+		model.ReceiptStatusLost:     model.BookStatusLost,
+	},
+}
+
+// UpdateReceiptStatus moves a receipt along its lifecycle and updates the
+// status of its copy in the same transaction
 func UpdateReceiptStatus(id uint, newStatus model.ReceiptStatus) error {
-	result := db.DB.Model(&model.Receipt{}).Where("id = ?", id).Update("status", newStatus)
-	// Get the receipt to check its current status
+	switch newStatus {
+	case model.ReceiptStatusPending, model.ReceiptStatusOwned, model.ReceiptStatusOverdue,
+		model.ReceiptStatusReturned, model.ReceiptStatusCanceled, model.ReceiptStatusLost:
+	default:
+		return ErrUnknownReceiptStatus
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		return updateReceiptStatus(tx, id, newStatus)
+	})
+}
+
+func updateReceiptStatus(tx *gorm.DB, id uint, newStatus model.ReceiptStatus) error {
 	var receipt model.Receipt
-	if err := db.DB.First(&receipt, id).Error; err != nil {
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&receipt, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrReceiptNotFound
+		}
 		return err
 	}
 
-	// Update book status based on the new receipt status
-	var bookStatus model.BookStatus
-	switch newStatus {
-	case model.ReceiptStatusPending:
-		bookStatus = model.BookStatusPlaced
-	case model.ReceiptStatusReturned:
-		bookStatus = model.BookStatusAvailable
-	default:
-		// For other statuses, we don't change the book status
-		return nil
+	copyStatus, ok := receiptTransitions[receipt.Status][newStatus]
+	if !ok {
+		return &ReceiptTransitionError{From: receipt.Status, To: newStatus}
+	}
+
+	// Charge for a late return or loss before the loan closes, whether or not
+	// the overdue scan has got to the receipt yet. Loans made before due dates
+	// were computed have none and are never late.
+	closing := newStatus == model.ReceiptStatusReturned || newStatus == model.ReceiptStatusLost
+	if closing && !receipt.DueDate.IsZero() {
+		if err := accrueFine(tx, &receipt, time.Now()); err != nil {
+			return err
+		}
+	}
+
+	oldStatus := receipt.Status
+	updates := map[string]interface{}{"status": newStatus}
+	if newStatus == model.ReceiptStatusOwned {
+		policy, err := loanPolicyForReceipt(tx, &receipt)
+		if err != nil {
+			return err
+		}
+		updates["due_date"] = time.Now().AddDate(0, 0, policy.LoanPeriodDays)
+	}
+
+	if err := tx.Model(&receipt).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := recordReceiptStatusChange(tx, &receipt, oldStatus, newStatus); err != nil {
+		return err
 	}
 
-	// Update the book status
-	if err := db.DB.Model(&model.Book{}).Where("id = ?", receipt.BookID).Update("status", bookStatus).Error; err != nil {
+	var bookCopy model.BookCopy
+	if err := tx.First(&bookCopy, receipt.CopyID).Error; err != nil {
 		return err
 	}
-	return result.Error
+	if copyStatus == model.BookStatusAvailable {
+		return releaseCopy(tx, &bookCopy)
+	}
+	return setCopyStatus(tx, &bookCopy, copyStatus)
+}
+
+var (
+	ErrReceiptNotOwned     = errors.New("only owned receipts can be renewed")
+	ErrRenewalLimitReached = errors.New("renewal limit reached")
+	ErrBookHasWaiters      = errors.New("another patron is waiting for this book")
+)
+
+// RenewReceipt extends the due date of an owned receipt by another loan period,
+// as long as the loan policy allows more renewals and nobody is waiting for the book
+func RenewReceipt(id uint) (*model.Receipt, error) {
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var receipt model.Receipt
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&receipt, id).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrReceiptNotFound
+			}
+			return err
+		}
+		if receipt.Status != model.ReceiptStatusOwned {
+			return ErrReceiptNotOwned
+		}
+
+		policy, err := loanPolicyForReceipt(tx, &receipt)
+		if err != nil {
+			return err
+		}
+		if receipt.Renewals >= policy.MaxRenewals {
+			return ErrRenewalLimitReached
+		}
+
+		waiting, err := bookHasWaiters(tx, receipt.BookID)
+		if err != nil {
+			return err
+		}
+		if waiting {
+			return ErrBookHasWaiters
+		}
+
+		return tx.Model(&receipt).Updates(map[string]interface{}{
+			"due_date": receipt.DueDate.AddDate(0, 0, policy.LoanPeriodDays),
+			"renewals": receipt.Renewals + 1,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetReceiptByID(id)
+}
+
+// PickupExpiredReason is recorded on receipts canceled because nobody collected the copy in time
+const PickupExpiredReason = "pickup window expired"
+
+// expiryBatchSize bounds how many receipts a single expiry transaction locks
+const expiryBatchSize = 100
+
+// ExpirePendingReceipts cancels pending receipts whose pickup deadline has
+// passed and releases their copies to the next hold or back to the shelf.
+// Receipts are claimed with SKIP LOCKED, so replicas running it at the same
+// time each process a different batch and none is handled twice.
+func ExpirePendingReceipts(now time.Time) (int, error) {
+	expired := 0
+	for {
+		processed := 0
+		err := db.DB.Transaction(func(tx *gorm.DB) error {
+			// Receipts from before pickup deadlines existed expire a full window after creation
+			var receipts []model.Receipt
+			err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+				Where("status = ?", model.ReceiptStatusPending).
+				Where("pickup_deadline < ? OR (pickup_deadline IS NULL AND created_at < ?)", now, now.Add(-pickupWindow())).
+				Order("id").Limit(expiryBatchSize).Find(&receipts).Error
+			if err != nil {
+				return err
+			}
+
+			for i := range receipts {
+				err := tx.Model(&receipts[i]).Updates(map[string]interface{}{
+					"status":        model.ReceiptStatusCanceled,
+					"cancel_reason": PickupExpiredReason,
+				}).Error
+				if err != nil {
+					return err
+				}
+				if err := recordReceiptStatusChange(tx, &receipts[i], model.ReceiptStatusPending, model.ReceiptStatusCanceled); err != nil {
+					return err
+				}
+
+				var bookCopy model.BookCopy
+				if err := tx.First(&bookCopy, receipts[i].CopyID).Error; err != nil {
+					return err
+				}
+				if err := releaseCopy(tx, &bookCopy); err != nil {
+					return err
+				}
+			}
+			processed = len(receipts)
+			return nil
+		})
+		if err != nil {
+			return expired, err
+		}
+		expired += processed
+		if processed < expiryBatchSize {
+			return expired, nil
+		}
+	}
 }
 
+var ErrReceiptNotDeletable = errors.New("receipts on loan must be returned or marked lost before they can be deleted")
+
+// DeleteReceipt deletes a receipt. The copy of a pending receipt is released
+// first, to the next hold or back to the shelf. Owned and overdue receipts are
+// refused until they are returned or lost, as the patron still has the copy
+// and may owe a late fine.
 func DeleteReceipt(id uint) error {
-	result := db.DB.Delete(&model.Receipt{}, id)
-	return result.Error
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		var receipt model.Receipt
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&receipt, id).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrReceiptNotFound
+			}
+			return err
+		}
+
+		switch receipt.Status {
+		case model.ReceiptStatusPending:
+			var bookCopy model.BookCopy
+			if err := tx.First(&bookCopy, receipt.CopyID).Error; err != nil {
+				return err
+			}
+			if err := releaseCopy(tx, &bookCopy); err != nil {
+				return err
+			}
+		case model.ReceiptStatusReturned, model.ReceiptStatusCanceled, model.ReceiptStatusLost:
+		default:
+			return ErrReceiptNotDeletable
+		}
+
+		if err := tx.Delete(&receipt).Error; err != nil {
+			return err
+		}
+		return recordEvent(tx, apiv1.MessageReceiptDeleted, apiv1.ReceiptDeleted{
+			ReceiptID: receipt.ID,
+			UserID:    receipt.UserID,
+			BookID:    receipt.BookID,
+			CopyID:    receipt.CopyID,
+			Status:    string(receipt.Status),
+		})
+	})
 }
 
 func GetAllReceipts(page, pageSize int) ([]model.Receipt, int64, error) {
 	var receipts []model.Receipt
 	var totalCount int64
 
-	query := db.DB.Model(&model.Receipt{}).Preload("Book")
+	query := db.DB.Model(&model.Receipt{}).Preload("Book").Preload("Copy")
 
 	if page > 0 && pageSize > 0 {
 		offset := (page - 1) * pageSize
@@ -0,0 +1,288 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "library-contract/v1"
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+)
+
+// createTestBook stores a book in a new category with the given number of
+// available copies
+func createTestBook(t *testing.T, copies int) model.Book {
+	t.Helper()
+	category := model.Category{Name: fmt.Sprintf("Category for %s", t.Name())}
+	if err := db.DB.Create(&category).Error; err != nil {
+		t.Fatalf("creating category: %v", err)
+	}
+	book := model.Book{Title: "Clean Code", Author: "Robert C. Martin", CategoryID: category.ID}
+	for i := 1; i <= copies; i++ {
+		book.Copies = append(book.Copies, model.BookCopy{
+			Barcode:   fmt.Sprintf("T%d-%03d", category.ID, i),
+			Location:  "T",
+			Condition: model.CopyConditionGood,
+			Status:    model.BookStatusAvailable,
+		})
+	}
+	if err := db.DB.Create(&book).Error; err != nil {
+		t.Fatalf("creating book: %v", err)
+	}
+	return book
+}
+
+func TestCreateReceiptConcurrentPlacements(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 1)
+
+	const placements = 20
+	results := make(chan error, placements)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 1; i <= placements; i++ {
+		wg.Add(1)
+		go func(userID uint) {
+			defer wg.Done()
+			<-start
+			results <- CreateReceipt(&model.Receipt{UserID: userID, BookID: book.ID})
+		}(uint(i))
+	}
+	close(start)
+	wg.Wait()
+	close(results)
+
+	succeeded, unavailable := 0, 0
+	for err := range results {
+		switch {
+		case err == nil:
+			succeeded++
+		case errors.Is(err, ErrBookNotAvailable):
+			unavailable++
+		default:
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if succeeded != 1 || unavailable != placements-1 {
+		t.Fatalf("got %d placed and %d unavailable, want 1 and %d", succeeded, unavailable, placements-1)
+	}
+
+	var receipts int64
+	if err := db.DB.Model(&model.Receipt{}).Where("book_id = ?", book.ID).Count(&receipts).Error; err != nil {
+		t.Fatal(err)
+	}
+	if receipts != 1 {
+		t.Errorf("got %d receipts, want 1", receipts)
+	}
+	var bookCopy model.BookCopy
+	if err := db.DB.First(&bookCopy, book.Copies[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bookCopy.Status != model.BookStatusPlaced {
+		t.Errorf("copy is %s, want %s", bookCopy.Status, model.BookStatusPlaced)
+	}
+}
+
+func TestDeleteReceiptReleasesCopy(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 1)
+
+	receipt := model.Receipt{UserID: 1, BookID: book.ID}
+	if err := CreateReceipt(&receipt); err != nil {
+		t.Fatal(err)
+	}
+	hold := model.Hold{UserID: 2, BookID: book.ID, Status: model.HoldStatusWaiting}
+	if err := db.DB.Create(&hold).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteReceipt(receipt.ID); err != nil {
+		t.Fatalf("DeleteReceipt: %v", err)
+	}
+
+	// The copy goes to the patron waiting for it instead of back to the shelf
+	if err := db.DB.First(&hold, hold.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if hold.Status != model.HoldStatusFulfilled || hold.ReceiptID == nil {
+		t.Fatalf("hold is %s with receipt %v, want fulfilled with a receipt", hold.Status, hold.ReceiptID)
+	}
+	var bookCopy model.BookCopy
+	if err := db.DB.First(&bookCopy, book.Copies[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if bookCopy.Status != model.BookStatusPlaced {
+		t.Errorf("copy is %s, want %s", bookCopy.Status, model.BookStatusPlaced)
+	}
+}
+
+func TestDeleteReceiptRefusesLoans(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 1)
+
+	receipt := model.Receipt{UserID: 1, BookID: book.ID}
+	if err := CreateReceipt(&receipt); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []model.ReceiptStatus{model.ReceiptStatusOwned, model.ReceiptStatusOverdue} {
+		if err := db.DB.Model(&receipt).Update("status", status).Error; err != nil {
+			t.Fatal(err)
+		}
+		if err := DeleteReceipt(receipt.ID); !errors.Is(err, ErrReceiptNotDeletable) {
+			t.Fatalf("DeleteReceipt of an %s receipt returned %v, want ErrReceiptNotDeletable", status, err)
+		}
+	}
+	if err := DeleteReceipt(receipt.ID + 1); !errors.Is(err, ErrReceiptNotFound) {
+		t.Fatalf("DeleteReceipt of a missing receipt returned %v, want ErrReceiptNotFound", err)
+	}
+}
+
+// placeTestReceipt places a pending receipt for userID whose pickup deadline is deadline
+func placeTestReceipt(t *testing.T, userID uint, book model.Book, deadline time.Time) model.Receipt {
+	t.Helper()
+	receipt := model.Receipt{UserID: userID, BookID: book.ID}
+	if err := CreateReceipt(&receipt); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.DB.Model(&receipt).Update("pickup_deadline", deadline).Error; err != nil {
+		t.Fatal(err)
+	}
+	return receipt
+}
+
+func TestExpirePendingReceipts(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	now := time.Now()
+	book := createTestBook(t, 3)
+	expired := placeTestReceipt(t, 1, book, now.Add(-time.Minute))
+	collectable := placeTestReceipt(t, 2, book, now.Add(time.Hour))
+	// Receipts from before pickup deadlines existed expire a window after creation
+	legacy := placeTestReceipt(t, 3, book, now)
+	err := db.DB.Model(&legacy).Updates(map[string]interface{}{
+		"pickup_deadline": nil,
+		"created_at":      now.Add(-pickupWindow() - time.Minute),
+	}).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := ExpirePendingReceipts(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("expired %d receipts, want 2", count)
+	}
+	for _, tc := range []struct {
+		receipt model.Receipt
+		status  model.ReceiptStatus
+		reason  string
+		copy    model.BookStatus
+	}{
+		{expired, model.ReceiptStatusCanceled, PickupExpiredReason, model.BookStatusAvailable},
+		{legacy, model.ReceiptStatusCanceled, PickupExpiredReason, model.BookStatusAvailable},
+		{collectable, model.ReceiptStatusPending, "", model.BookStatusPlaced},
+	} {
+		receipt, err := GetReceiptByID(tc.receipt.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if receipt.Status != tc.status || receipt.CancelReason != tc.reason {
+			t.Errorf("receipt of user %d is %s %q, want %s %q", receipt.UserID, receipt.Status, receipt.CancelReason, tc.status, tc.reason)
+		}
+		var bookCopy model.BookCopy
+		if err := db.DB.First(&bookCopy, receipt.CopyID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if bookCopy.Status != tc.copy {
+			t.Errorf("copy of user %d's receipt is %s, want %s", receipt.UserID, bookCopy.Status, tc.copy)
+		}
+	}
+}
+
+func TestExpiredPickupGoesToTheNextHold(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	book := createTestBook(t, 1)
+	expired := placeTestReceipt(t, 1, book, time.Now().Add(-time.Minute))
+	hold := placeTestHold(t, 2, book)
+
+	if _, err := ExpirePendingReceipts(time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	promoted, err := GetHoldByID(hold.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Status != model.HoldStatusFulfilled || promoted.ReceiptID == nil {
+		t.Fatalf("hold is %s, want it fulfilled with the expired copy", promoted.Status)
+	}
+	receipt, err := GetReceiptByID(*promoted.ReceiptID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if receipt.CopyID != expired.CopyID || receipt.Status != model.ReceiptStatusPending {
+		t.Errorf("got receipt %+v, want a pending receipt of copy %d", receipt, expired.CopyID)
+	}
+}
+
+func TestConcurrentExpiryHandlesEachReceiptOnce(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	const receipts = 12
+	for i := 0; i < receipts; i++ {
+		t.Run(fmt.Sprint(i), func(t *testing.T) {
+			book := createTestBook(t, 1)
+			placeTestReceipt(t, uint(i+1), book, time.Now().Add(-time.Minute))
+		})
+	}
+	before := lastOutboxEventID(t)
+
+	// Replicas running the job at the same time
+	const replicas = 4
+	counts := make(chan int, replicas)
+	var wg sync.WaitGroup
+	for i := 0; i < replicas; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			count, err := ExpirePendingReceipts(time.Now())
+			if err != nil {
+				t.Error(err)
+			}
+			counts <- count
+		}()
+	}
+	wg.Wait()
+	close(counts)
+
+	total := 0
+	for count := range counts {
+		total += count
+	}
+	if total != receipts {
+		t.Errorf("replicas expired %d receipts in total, want %d", total, receipts)
+	}
+	canceled := map[uint]int{}
+	for _, event := range outboxEventsAfter(t, before) {
+		if event.Type != apiv1.MessageReceiptStatusChanged {
+			continue
+		}
+		var changed apiv1.ReceiptStatusChanged
+		if err := json.Unmarshal([]byte(event.Payload), &changed); err != nil {
+			t.Fatal(err)
+		}
+		canceled[changed.ReceiptID]++
+	}
+	if len(canceled) != receipts {
+		t.Errorf("got status changes for %d receipts, want %d", len(canceled), receipts)
+	}
+	for id, changes := range canceled {
+		if changes != 1 {
+			t.Errorf("receipt %d was canceled %d times", id, changes)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	db "library-server/DB"
+	"library-server/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrRoleNotFound      = errors.New("role not found")
+	ErrRoleExists        = errors.New("role already exists")
+	ErrRoleInUse         = errors.New("role is still assigned to admins")
+	ErrRoleProtected     = errors.New("the superadmin role cannot be changed or deleted")
+	ErrUnknownPermission = errors.New("unknown permission")
+)
+
+// CreateRole creates a new role in the database
+func CreateRole(role *model.Role) error {
+	if err := validateRole(role); err != nil {
+		return err
+	}
+	role.ID = 0
+	return db.DB.Create(role).Error
+}
+
+// GetAllRoles retrieves every role
+func GetAllRoles() ([]model.Role, error) {
+	var roles []model.Role
+	result := db.DB.Order("id").Find(&roles)
+	return roles, result.Error
+}
+
+// GetRoleByID retrieves a role by its ID
+func GetRoleByID(id uint) (*model.Role, error) {
+	var role model.Role
+	if err := db.DB.First(&role, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrRoleNotFound
+		}
+		return nil, err
+	}
+	return &role, nil
+}
+
+// UpdateRole renames a role and replaces its permissions. Access tokens of
+// admins holding the role are revoked, so they pick up the new permissions
+// when they refresh their session.
+func UpdateRole(role *model.Role) error {
+	existing, err := GetRoleByID(role.ID)
+	if err != nil {
+		return err
+	}
+	if existing.Name == model.RoleSuperadmin {
+		return ErrRoleProtected
+	}
+	if err := validateRole(role); err != nil {
+		return err
+	}
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(role).Select("Name", "Permissions").Updates(role).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.Admin{}).Where("role_id = ?", role.ID).
+			Update("token_version", gorm.Expr("token_version + 1")).Error
+	})
+}
+
+// DeleteRole deletes a role that is no longer assigned to any admin
+func DeleteRole(id uint) error {
+	role, err := GetRoleByID(id)
+	if err != nil {
+		return err
+	}
+	if role.Name == model.RoleSuperadmin {
+		return ErrRoleProtected
+	}
+
+	var count int64
+	if err := db.DB.Model(&model.Admin{}).Where("role_id = ?", id).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleInUse
+	}
+	return db.DB.Delete(&model.Role{}, id).Error
+}
+
+// validateRole checks that the role name is free and every permission is known
+func validateRole(role *model.Role) error {
+	for _, permission := range role.Permissions {
+		known := false
+		for _, p := range model.AllPermissions {
+			if p == permission {
+				known = true
+				break
+			}
+		}
+		if !known {
+			return fmt.Errorf("%w: %s", ErrUnknownPermission, permission)
+		}
+	}
+
+	var count int64
+	if err := db.DB.Model(&model.Role{}).Where("name = ? AND id <> ?", role.Name, role.ID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrRoleExists
+	}
+	return nil
+}
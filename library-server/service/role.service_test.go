@@ -0,0 +1,133 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// loadTestSigningKeys gives SigningKeys a throwaway key for the test
+func loadTestSigningKeys(t *testing.T) {
+	t.Helper()
+	t.Setenv("JWT_SIGNING_KEY", "")
+	t.Setenv("JWT_RETIRED_KEYS", "")
+	previous := SigningKeys
+	if err := LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SigningKeys = previous })
+}
+
+// createTestRole stores a role directly, bypassing the superadmin checks
+func createTestRole(t *testing.T, name string, permissions ...string) model.Role {
+	t.Helper()
+	role := model.Role{Name: name, Permissions: permissions}
+	if err := db.DB.Create(&role).Error; err != nil {
+		t.Fatalf("creating role %s: %v", name, err)
+	}
+	return role
+}
+
+func TestRolesOnlyHoldKnownPermissions(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	createTestRole(t, model.RoleCataloguer, model.PermissionBooksWrite)
+
+	if err := CreateRole(&model.Role{Name: "shelver", Permissions: []string{"books:burn"}}); !errors.Is(err, ErrUnknownPermission) {
+		t.Errorf("unknown permission: got %v, want %v", err, ErrUnknownPermission)
+	}
+	if err := CreateRole(&model.Role{Name: model.RoleCataloguer, Permissions: []string{model.PermissionBooksRead}}); !errors.Is(err, ErrRoleExists) {
+		t.Errorf("duplicate name: got %v, want %v", err, ErrRoleExists)
+	}
+	role := model.Role{Name: "shelver", Permissions: []string{model.PermissionBooksRead}}
+	if err := CreateRole(&role); err != nil {
+		t.Fatal(err)
+	}
+	role.Permissions = append(role.Permissions, "books:burn")
+	if err := UpdateRole(&role); !errors.Is(err, ErrUnknownPermission) {
+		t.Errorf("updating to an unknown permission: got %v, want %v", err, ErrUnknownPermission)
+	}
+}
+
+func TestSuperadminRoleIsProtected(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	superadmin := createTestRole(t, model.RoleSuperadmin, model.AllPermissions...)
+
+	if err := UpdateRole(&model.Role{ID: superadmin.ID, Name: model.RoleSuperadmin}); !errors.Is(err, ErrRoleProtected) {
+		t.Errorf("updating: got %v, want %v", err, ErrRoleProtected)
+	}
+	if err := DeleteRole(superadmin.ID); !errors.Is(err, ErrRoleProtected) {
+		t.Errorf("deleting: got %v, want %v", err, ErrRoleProtected)
+	}
+}
+
+func TestDeleteRoleInUse(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	role := createTestRole(t, model.RoleLibrarian, model.PermissionReceiptsWrite)
+	admin, err := CreateAdmin("librarian", "correct horse", role.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := DeleteRole(role.ID); !errors.Is(err, ErrRoleInUse) {
+		t.Fatalf("got %v, want %v", err, ErrRoleInUse)
+	}
+	other := createTestRole(t, model.RoleCirculationDesk, model.PermissionReceiptsRead)
+	if _, err := SetAdminRole(admin.ID, other.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteRole(role.ID); err != nil {
+		t.Errorf("deleting an unassigned role: %v", err)
+	}
+}
+
+func TestAccessTokensCarryRolePermissions(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	t.Setenv("REQUIRE_ADMIN_TOTP", "")
+	role := createTestRole(t, model.RoleCirculationDesk, model.PermissionReceiptsRead, model.PermissionReceiptsWrite)
+	admin, err := CreateAdmin("desk", "correct horse", role.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	permissions := func() []interface{} {
+		t.Helper()
+		tokens, _, err := Login("desk", "correct horse", "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		claims := jwt.MapClaims{}
+		if _, err := SigningKeys.Parse(tokens.AccessToken, claims); err != nil {
+			t.Fatal(err)
+		}
+		if claims["role"] != model.RoleCirculationDesk {
+			t.Errorf("got role %v, want %s", claims["role"], model.RoleCirculationDesk)
+		}
+		granted, _ := claims["permissions"].([]interface{})
+		return granted
+	}
+	if granted := permissions(); len(granted) != 2 || granted[0] != model.PermissionReceiptsRead || granted[1] != model.PermissionReceiptsWrite {
+		t.Errorf("got permissions %v, want the role's", granted)
+	}
+
+	// Changing the role revokes the tokens issued with the old permissions
+	var before model.Admin
+	if err := db.DB.First(&before, admin.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	role.Permissions = []string{model.PermissionReceiptsRead}
+	if err := UpdateRole(&role); err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateAdminToken(admin.ID, before.TokenVersion, "any"); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("old token after a role change: got %v, want %v", err, ErrTokenRevoked)
+	}
+	if granted := permissions(); len(granted) != 1 || granted[0] != model.PermissionReceiptsRead {
+		t.Errorf("got permissions %v after the change, want only %s", granted, model.PermissionReceiptsRead)
+	}
+}
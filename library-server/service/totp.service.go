@@ -0,0 +1,234 @@
+package service
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"library-contract/session"
+	db "library-server/DB"
+	"library-server/model"
+	"library-server/totp"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/skip2/go-qrcode"
+	"gorm.io/gorm"
+)
+
+// recoveryCodeCount is how many recovery codes an admin gets at a time
+const recoveryCodeCount = 10
+
+var (
+	ErrTOTPAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTOTPNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTOTPNotEnrolling   = errors.New("start enrollment before confirming it")
+)
+
+// TOTPEnrollment is what an admin needs to add their account to an
+// authenticator app. QRCodePNG encodes URI.
+type TOTPEnrollment struct {
+	Secret    string `json:"secret"`
+	URI       string `json:"otpauth_uri"`
+	QRCodePNG []byte `json:"qr_png" swaggertype:"string" format:"base64"`
+}
+
+// TOTPRequired reports whether REQUIRE_ADMIN_TOTP makes two-factor
+// authentication mandatory for every admin
+func TOTPRequired() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_ADMIN_TOTP"))
+	return required
+}
+
+// BeginTOTPEnrollment generates a new secret for an admin. It takes effect
+// once ConfirmTOTPEnrollment receives a code generated from it.
+func BeginTOTPEnrollment(adminID uint) (*TOTPEnrollment, error) {
+	admin, err := GetAdminByID(adminID)
+	if err != nil {
+		return nil, err
+	}
+	if admin.TOTPEnabled {
+		return nil, ErrTOTPAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := db.DB.Model(admin).Update("totp_secret", secret).Error; err != nil {
+		return nil, err
+	}
+
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "Library"
+	}
+	uri := totp.URI(issuer, admin.Username, secret)
+	png, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		return nil, err
+	}
+	return &TOTPEnrollment{Secret: secret, URI: uri, QRCodePNG: png}, nil
+}
+
+// ConfirmTOTPEnrollment enables two-factor authentication once the admin
+// proves their app produces the right codes, and returns their recovery
+// codes. Every session is revoked, so the admin logs in again with TOTP.
+func ConfirmTOTPEnrollment(adminID uint, code string) ([]string, error) {
+	var codes []string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var admin model.Admin
+		if err := tx.First(&admin, adminID).Error; err != nil {
+			return err
+		}
+		if admin.TOTPEnabled {
+			return ErrTOTPAlreadyEnabled
+		}
+		if admin.TOTPSecret == "" {
+			return ErrTOTPNotEnrolling
+		}
+		step, ok := totp.Validate(admin.TOTPSecret, code, time.Now(), 0)
+		if !ok {
+			return ErrInvalidMFACode
+		}
+
+		err := tx.Model(&admin).Updates(map[string]interface{}{"totp_enabled": true, "totp_last_step": step}).Error
+		if err != nil {
+			return err
+		}
+		if codes, err = replaceRecoveryCodes(tx, admin.ID); err != nil {
+			return err
+		}
+		return revokeAdminSessions(tx, admin.ID)
+	})
+	return codes, err
+}
+
+// DisableTOTP turns two-factor authentication off after checking a current
+// TOTP or recovery code
+func DisableTOTP(adminID uint, code string) error {
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		admin, err := adminWithTOTP(tx, adminID)
+		if err != nil {
+			return err
+		}
+		ok, err := verifySecondFactor(tx, admin, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		return clearTOTP(tx, adminID)
+	})
+}
+
+// RegenerateRecoveryCodes replaces an admin's recovery codes after checking a
+// current TOTP or recovery code
+func RegenerateRecoveryCodes(adminID uint, code string) ([]string, error) {
+	var codes []string
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		admin, err := adminWithTOTP(tx, adminID)
+		if err != nil {
+			return err
+		}
+		ok, err := verifySecondFactor(tx, admin, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrInvalidMFACode
+		}
+		codes, err = replaceRecoveryCodes(tx, adminID)
+		return err
+	})
+	return codes, err
+}
+
+// ResetAdminTOTP turns two-factor authentication off for an admin who lost
+// their authenticator and recovery codes, and revokes their sessions
+func ResetAdminTOTP(adminID uint) error {
+	if _, err := GetAdminByID(adminID); err != nil {
+		return err
+	}
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		if err := clearTOTP(tx, adminID); err != nil {
+			return err
+		}
+		return revokeAdminSessions(tx, adminID)
+	})
+}
+
+// verifySecondFactor accepts a TOTP code not used before or an unused
+// recovery code, consuming it either way
+func verifySecondFactor(tx *gorm.DB, admin *model.Admin, code string) (bool, error) {
+	code = strings.TrimSpace(code)
+	if step, ok := totp.Validate(admin.TOTPSecret, code, time.Now(), admin.TOTPLastStep); ok {
+		// Guarded by the old step so two requests cannot both use the code
+		result := tx.Model(&model.Admin{}).
+			Where("id = ? AND totp_last_step < ?", admin.ID, step).
+			Update("totp_last_step", step)
+		return result.RowsAffected == 1, result.Error
+	}
+
+	result := tx.Model(&model.RecoveryCode{}).
+		Where("admin_id = ? AND code_hash = ? AND used_at IS NULL", admin.ID, hashRecoveryCode(code)).
+		Update("used_at", time.Now())
+	return result.RowsAffected == 1, result.Error
+}
+
+func adminWithTOTP(tx *gorm.DB, adminID uint) (*model.Admin, error) {
+	var admin model.Admin
+	if err := tx.First(&admin, adminID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAdminNotFound
+		}
+		return nil, err
+	}
+	if !admin.TOTPEnabled {
+		return nil, ErrTOTPNotEnabled
+	}
+	return &admin, nil
+}
+
+func clearTOTP(tx *gorm.DB, adminID uint) error {
+	err := tx.Model(&model.Admin{}).Where("id = ?", adminID).Updates(map[string]interface{}{
+		"totp_enabled":   false,
+		"totp_secret":    "",
+		"totp_last_step": 0,
+	}).Error
+	if err != nil {
+		return err
+	}
+	return tx.Where("admin_id = ?", adminID).Delete(&model.RecoveryCode{}).Error
+}
+
+// replaceRecoveryCodes discards an admin's recovery codes and returns a new set
+func replaceRecoveryCodes(tx *gorm.DB, adminID uint) ([]string, error) {
+	if err := tx.Where("admin_id = ?", adminID).Delete(&model.RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, 0, recoveryCodeCount)
+	stored := make([]model.RecoveryCode, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 5)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(base32.StdEncoding.EncodeToString(raw))
+		code = code[:4] + "-" + code[4:]
+		codes = append(codes, code)
+		stored = append(stored, model.RecoveryCode{AdminID: adminID, CodeHash: hashRecoveryCode(code)})
+	}
+	if err := tx.Create(&stored).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// hashRecoveryCode hashes a recovery code ignoring case and dashes, as people
+// type them back in
+func hashRecoveryCode(code string) string {
+	return session.HashToken(strings.ToLower(strings.ReplaceAll(code, "-", "")))
+}
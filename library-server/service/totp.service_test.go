@@ -0,0 +1,44 @@
+package service
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+
+	db "library-server/DB"
+	"library-server/dbtest"
+	"library-server/model"
+	"library-server/totp"
+)
+
+func TestVerifySecondFactorRefusesUsedCode(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	admin := model.Admin{Username: "totp-admin", Password: "x", TOTPSecret: secret, TOTPEnabled: true}
+	if err := db.DB.Create(&admin).Error; err != nil {
+		t.Fatal(err)
+	}
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := totp.Code(key, totp.Step(time.Now()), totp.Digits)
+
+	if ok, err := verifySecondFactor(db.DB, &admin, code); err != nil || !ok {
+		t.Fatalf("first use of the code: ok %v, err %v", ok, err)
+	}
+	// admin still holds the last step from before the first use, as a second
+	// request racing the first one would
+	if ok, err := verifySecondFactor(db.DB, &admin, code); err != nil || ok {
+		t.Errorf("second use of the code with a stale admin: ok %v, err %v", ok, err)
+	}
+	if err := db.DB.First(&admin, admin.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := verifySecondFactor(db.DB, &admin, code); err != nil || ok {
+		t.Errorf("second use of the code: ok %v, err %v", ok, err)
+	}
+}
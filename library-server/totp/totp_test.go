@@ -0,0 +1,64 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 seed of the RFC 6238 Appendix B test vectors
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCodeRFC6238Vectors(t *testing.T) {
+	vectors := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+	for _, vector := range vectors {
+		if got := Code(rfcSecret, Step(time.Unix(vector.unix, 0)), 8); got != vector.code {
+			t.Errorf("code at %d = %s, want %s", vector.unix, got, vector.code)
+		}
+	}
+}
+
+func TestValidateSkewWindow(t *testing.T) {
+	secret := encoding.EncodeToString(rfcSecret)
+	now := time.Unix(1234567890, 0)
+	current := Step(now)
+
+	for offset := int64(-Skew - 1); offset <= Skew+1; offset++ {
+		code := Code(rfcSecret, current+offset, Digits)
+		step, ok := Validate(secret, code, now, 0)
+		want := offset >= -Skew && offset <= Skew
+		if ok != want {
+			t.Errorf("code %d periods from now accepted: %v, want %v", offset, ok, want)
+		}
+		if ok && step != current+offset {
+			t.Errorf("code %d periods from now matched step %d, want %d", offset, step, current+offset)
+		}
+	}
+}
+
+func TestValidateRefusesUsedCode(t *testing.T) {
+	secret := encoding.EncodeToString(rfcSecret)
+	now := time.Unix(1234567890, 0)
+	code := Code(rfcSecret, Step(now), Digits)
+
+	step, ok := Validate(secret, code, now, 0)
+	if !ok {
+		t.Fatal("current code was refused")
+	}
+	if _, ok := Validate(secret, code, now, step); ok {
+		t.Error("code was accepted a second time")
+	}
+	earlier := Code(rfcSecret, Step(now)-1, Digits)
+	if _, ok := Validate(secret, earlier, now, step); ok {
+		t.Error("code older than the last used one was accepted")
+	}
+}
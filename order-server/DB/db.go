@@ -1,8 +1,11 @@
 package db
 
 import (
+	"library-contract/session"
+	"library-contract/throttle"
 	"order-server/model"
 	"os"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -11,10 +14,31 @@ import (
 var DB *gorm.DB
 
 func Connect() {
-	db, err := gorm.Open(postgres.Open(os.Getenv("DB_URL")), &gorm.Config{})
+	db, err := Open(os.Getenv("DB_URL"))
 	if err != nil {
 		panic(err)
 	}
-	db.AutoMigrate(&model.User{})
 	DB = db
 }
+
+// Open connects to the database at url and brings its schema up to date
+func Open(url string) (*gorm.DB, error) {
+	db, err := gorm.Open(postgres.Open(url), &gorm.Config{})
+	if err != nil {
+		return nil, err
+	}
+	// Users who registered before email verification existed keep their access
+	grandfatherEmails := db.Migrator().HasTable(&model.User{}) && !db.Migrator().HasColumn(&model.User{}, "EmailVerifiedAt")
+	// Refresh tokens named their user by user_id before the token store was
+	// shared with the library-server
+	if db.Migrator().HasColumn(&session.RefreshToken{}, "user_id") {
+		db.Migrator().RenameColumn(&session.RefreshToken{}, "user_id", "owner_id")
+	}
+	db.AutoMigrate(&model.User{}, &session.RefreshToken{}, &session.RevokedToken{}, &model.UserToken{}, &throttle.LoginThrottle{}, &throttle.LockoutEvent{}, &model.Order{}, &model.OrderLine{}, &model.ReceiptCancellation{})
+	if grandfatherEmails {
+		if err := db.Model(&model.User{}).Where("email_verified_at IS NULL").Update("email_verified_at", time.Now()).Error; err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
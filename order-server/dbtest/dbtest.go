@@ -0,0 +1,73 @@
+// Package dbtest points tests that need PostgreSQL at a throwaway schema
+package dbtest
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"testing"
+
+	db "order-server/DB"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// Connect sets db.DB to an empty schema of the database at TEST_DB_URL, and
+// skips the test when TEST_DB_URL is unset. Each test package passes its own
+// schema so packages tested in parallel do not see each other's rows; every
+// table in it is emptied before the test runs.
+func Connect(t *testing.T, schema string) {
+	t.Helper()
+	base := os.Getenv("TEST_DB_URL")
+	if base == "" {
+		t.Skip("TEST_DB_URL is not set")
+	}
+
+	admin, err := gorm.Open(postgres.Open(base), &gorm.Config{Logger: logger.Discard})
+	if err != nil {
+		t.Fatalf("connecting to test database: %v", err)
+	}
+	if err := admin.Exec(fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %q", schema)).Error; err != nil {
+		t.Fatalf("creating schema %s: %v", schema, err)
+	}
+	closeDB(admin)
+
+	dsn, err := url.Parse(base)
+	if err != nil {
+		t.Fatalf("parsing TEST_DB_URL: %v", err)
+	}
+	query := dsn.Query()
+	query.Set("search_path", schema)
+	dsn.RawQuery = query.Encode()
+
+	conn, err := db.Open(dsn.String())
+	if err != nil {
+		t.Fatalf("migrating test database: %v", err)
+	}
+	conn.Logger = logger.Discard
+
+	var tables []string
+	if err := conn.Raw("SELECT tablename FROM pg_tables WHERE schemaname = ?", schema).Scan(&tables).Error; err != nil {
+		t.Fatalf("listing tables: %v", err)
+	}
+	for _, table := range tables {
+		if err := conn.Exec(fmt.Sprintf("TRUNCATE TABLE %q RESTART IDENTITY CASCADE", table)).Error; err != nil {
+			t.Fatalf("emptying %s: %v", table, err)
+		}
+	}
+
+	previous := db.DB
+	db.DB = conn
+	t.Cleanup(func() {
+		db.DB = previous
+		closeDB(conn)
+	})
+}
+
+func closeDB(conn *gorm.DB) {
+	if sqlDB, err := conn.DB(); err == nil {
+		sqlDB.Close()
+	}
+}
@@ -0,0 +1,88 @@
+package dto
+
+import (
+	"order-server/model"
+	"time"
+)
+
+// OrderResponse is how an order is shown through the API
+type OrderResponse struct {
+	ID            uint                `json:"id"`
+	Status        model.OrderStatus   `json:"status"`
+	FailureReason string              `json:"failure_reason,omitempty"`
+	Lines         []OrderLineResponse `json:"lines"`
+	CreatedAt     time.Time           `json:"created_at"`
+	UpdatedAt     time.Time           `json:"updated_at"`
+}
+
+// OrderLineResponse is one book of an order and the receipt reserved for it
+type OrderLineResponse struct {
+	ID        uint                  `json:"id"`
+	BookID    uint                  `json:"book_id"`
+	Status    model.OrderLineStatus `json:"status"`
+	ReceiptID *uint                 `json:"receipt_id,omitempty"`
+	Error     string                `json:"error,omitempty"`
+}
+
+// NewOrderResponse converts an order with its lines for the API
+func NewOrderResponse(order *model.Order) OrderResponse {
+	response := OrderResponse{
+		ID:            order.ID,
+		Status:        order.Status,
+		FailureReason: order.FailureReason,
+		Lines:         make([]OrderLineResponse, len(order.Lines)),
+		CreatedAt:     order.CreatedAt,
+		UpdatedAt:     order.UpdatedAt,
+	}
+	for i, line := range order.Lines {
+		response.Lines[i] = OrderLineResponse{
+			ID:        line.ID,
+			BookID:    line.BookID,
+			Status:    line.Status,
+			ReceiptID: line.ReceiptID,
+			Error:     line.Error,
+		}
+	}
+	return response
+}
+
+// NewOrderResponses converts a list of orders for the API
+func NewOrderResponses(orders []model.Order) []OrderResponse {
+	responses := make([]OrderResponse, len(orders))
+	for i := range orders {
+		responses[i] = NewOrderResponse(&orders[i])
+	}
+	return responses
+}
+
+// ReceiptCancellationResponse is how a user's request to cancel a receipt is
+// shown through the API
+type ReceiptCancellationResponse struct {
+	ID        uint                            `json:"id"`
+	ReceiptID uint                            `json:"receipt_id"`
+	Status    model.ReceiptCancellationStatus `json:"status"`
+	Error     string                          `json:"error,omitempty"`
+	CreatedAt time.Time                       `json:"created_at"`
+	UpdatedAt time.Time                       `json:"updated_at"`
+}
+
+// NewReceiptCancellationResponse converts a receipt cancellation for the API
+func NewReceiptCancellationResponse(cancellation *model.ReceiptCancellation) ReceiptCancellationResponse {
+	return ReceiptCancellationResponse{
+		ID:        cancellation.ID,
+		ReceiptID: cancellation.ReceiptID,
+		Status:    cancellation.Status,
+		Error:     cancellation.Error,
+		CreatedAt: cancellation.CreatedAt,
+		UpdatedAt: cancellation.UpdatedAt,
+	}
+}
+
+// NewReceiptCancellationResponses converts a list of receipt cancellations for the API
+func NewReceiptCancellationResponses(cancellations []model.ReceiptCancellation) []ReceiptCancellationResponse {
+	responses := make([]ReceiptCancellationResponse, len(cancellations))
+	for i := range cancellations {
+		responses[i] = NewReceiptCancellationResponse(&cancellations[i])
+	}
+	return responses
+}
@@ -0,0 +1,69 @@
+package dto
+
+import (
+	apiv1 "library-contract/v1"
+	"order-server/model"
+	"order-server/service"
+	"time"
+)
+
+// UserResponse is how a user's account is shown through the API. The password
+// hash and token version never leave the server.
+type UserResponse struct {
+	ID              uint       `json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+}
+
+// NewUserResponse converts a user for the API
+func NewUserResponse(user *model.User) UserResponse {
+	return UserResponse{
+		ID:              user.ID,
+		Username:        user.Username,
+		Email:           user.Email,
+		EmailVerifiedAt: user.EmailVerifiedAt,
+	}
+}
+
+// AccountExportResponse is the download a user gets of everything kept about them
+type AccountExportResponse struct {
+	ExportedAt    time.Time                     `json:"exported_at"`
+	Profile       UserResponse                  `json:"profile"`
+	Orders        []OrderResponse               `json:"orders"`
+	Cancellations []ReceiptCancellationResponse `json:"receipt_cancellations"`
+	Receipts      []apiv1.Receipt               `json:"receipts"`
+	Holds         []apiv1.Hold                  `json:"holds"`
+	Fines         *apiv1.FineBalance            `json:"fines"`
+}
+
+// NewAccountExportResponse converts an account export for the API
+func NewAccountExportResponse(export *service.AccountExport) AccountExportResponse {
+	return AccountExportResponse{
+		ExportedAt:    export.ExportedAt,
+		Profile:       NewUserResponse(export.User),
+		Orders:        NewOrderResponses(export.Orders),
+		Cancellations: NewReceiptCancellationResponses(export.Cancellations),
+		Receipts:      export.Receipts,
+		Holds:         export.Holds,
+		Fines:         export.Fines,
+	}
+}
+
+// LoginResponse is what a successful login returns
+type LoginResponse struct {
+	AccessToken  string       `json:"token"`
+	RefreshToken string       `json:"refresh_token"`
+	ExpiresIn    int64        `json:"expires_in"`
+	User         UserResponse `json:"user"`
+}
+
+// NewLoginResponse combines a session's tokens with the user they belong to
+func NewLoginResponse(user *model.User, tokens *service.TokenPair) LoginResponse {
+	return LoginResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+		User:         NewUserResponse(user),
+	}
+}
@@ -0,0 +1,82 @@
+package dto
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"library-contract/session"
+	apiv1 "library-contract/v1"
+	"order-server/model"
+	"order-server/service"
+)
+
+// secretKeys are parts of JSON keys that would carry a credential
+var secretKeys = []string{"password", "hash", "secret", "token", "code"}
+
+// assertNoSecrets marshals value and fails when any key, at any depth,
+// contains one of secretKeys
+func assertNoSecrets(t *testing.T, name string, value interface{}) {
+	t.Helper()
+	raw, err := json.Marshal(value)
+	if err != nil {
+		t.Fatalf("marshalling %s: %v", name, err)
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("decoding %s: %v", name, err)
+	}
+	var walk func(path string, node interface{})
+	walk = func(path string, node interface{}) {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			for key, child := range node {
+				for _, secret := range secretKeys {
+					if strings.Contains(strings.ToLower(key), secret) {
+						t.Errorf("%s exposes %s%s", name, path, key)
+					}
+				}
+				walk(path+key+".", child)
+			}
+		case []interface{}:
+			for _, child := range node {
+				walk(path, child)
+			}
+		}
+	}
+	walk("", decoded)
+}
+
+func TestSecretsAreNotSerialised(t *testing.T) {
+	now := time.Now()
+	user := model.User{
+		ID:              1,
+		Username:        "reader",
+		Email:           "reader@example.com",
+		Password:        "$2a$10$hash",
+		EmailVerifiedAt: &now,
+		TokenVersion:    3,
+	}
+	replacedBy, receiptID := uint(2), uint(7)
+	export := service.AccountExport{
+		ExportedAt: now,
+		User:       &user,
+		Orders: []model.Order{{
+			ID: 1, UserID: user.ID, Status: model.OrderStatusPlaced,
+			Lines: []model.OrderLine{{ID: 1, OrderID: 1, BookID: 1, RequestID: "req-1", SentAt: &now, ReceiptID: &receiptID}},
+		}},
+		Cancellations: []model.ReceiptCancellation{{
+			ID: 1, UserID: user.ID, ReceiptID: receiptID, Status: model.ReceiptCancellationDone, RequestID: "req-2", SentAt: &now,
+		}},
+		Receipts: []apiv1.Receipt{{ID: receiptID, UserID: user.ID, BookID: 1, Status: apiv1.ReceiptStatusOwned}},
+		Holds:    []apiv1.Hold{{ID: 1, UserID: user.ID, BookID: 1, Status: apiv1.HoldStatusWaiting}},
+		Fines:    &apiv1.FineBalance{UserID: user.ID},
+	}
+
+	assertNoSecrets(t, "model.User", user)
+	assertNoSecrets(t, "model.UserToken", model.UserToken{ID: 1, UserID: user.ID, Purpose: model.UserTokenPasswordReset, TokenHash: "abc", ExpiresAt: now, UsedAt: &now, CreatedAt: now})
+	assertNoSecrets(t, "session.RefreshToken", session.RefreshToken{ID: 1, OwnerID: user.ID, TokenHash: "abc", ExpiresAt: now, RevokedAt: &now, ReplacedByID: &replacedBy, CreatedAt: now})
+	assertNoSecrets(t, "UserResponse", NewUserResponse(&user))
+	assertNoSecrets(t, "AccountExportResponse", NewAccountExportResponse(&export))
+}
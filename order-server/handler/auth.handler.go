@@ -1,24 +1,30 @@
 package handler
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"order-server/dto"
+	"order-server/middleware"
 	"order-server/model"
 	"order-server/service"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
 
 type AuthHandler struct {
-	authService *service.AuthService
+	authService    *service.AuthService
+	accountService *service.AccountService
 }
 
-func NewAuthHandler(authService *service.AuthService) *AuthHandler {
-	return &AuthHandler{authService: authService}
+func NewAuthHandler(authService *service.AuthService, accountService *service.AccountService) *AuthHandler {
+	return &AuthHandler{authService: authService, accountService: accountService}
 }
 
 // Register godoc
 // @Summary Register a new user
-// @Description Register a new user with the provided details
+// @Description Register a new user with the provided details and email them a verification link. Receipts and holds can only be placed once the email is verified.
 // @Tags auth
 // @Accept json
 // @Produce json
@@ -45,7 +51,13 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
+	if err := h.accountService.SendVerificationEmail(c.Request.Context(), &user); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully, but the verification email could not be sent; request a new one after logging in"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully, check your email to verify your address"})
 }
 
 type RegisterUserInput struct {
@@ -61,8 +73,9 @@ type RegisterUserInput struct {
 // @Accept json
 // @Produce json
 // @Param credentials body map[string]string true "User credentials"
-// @Success 200 {object} map[string]string
-// @Failure 401 {object} map[string]string
+// @Success 200 {object} dto.LoginResponse
+// @Failure 401 {object} map[string]string "Invalid username or password"
+// @Failure 429 {object} map[string]string "Too many failed attempts"
 // @Router /auth/login [post]
 func (h *AuthHandler) Login(c *gin.Context) {
 	var credentials struct {
@@ -75,14 +88,252 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	user, token, err := h.authService.Login(c.Request.Context(), credentials.Username, credentials.Password)
+	user, tokens, err := h.authService.Login(c.Request.Context(), credentials.Username, credentials.Password, c.ClientIP())
+	if err != nil {
+		var locked *service.LoginLockedError
+		switch {
+		case errors.As(err, &locked):
+			c.Header("Retry-After", strconv.Itoa(int(locked.RetryAfter.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrInvalidCredentials):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log in"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewLoginResponse(user, tokens))
+}
+
+// RefreshTokenInput represents the request body carrying a refresh token
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// LogoutInput represents the optional request body of a logout
+type LogoutInput struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh godoc
+// @Summary Refresh a session
+// @Description Exchange a refresh token for a new access token and a new refresh token. Each refresh token can be used once; reusing one revokes every session of the user.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body RefreshTokenInput true "Refresh token"
+// @Success 200 {object} service.TokenPair
+// @Failure 400 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Router /auth/refresh [post]
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	var input RefreshTokenInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.authService.Refresh(c.Request.Context(), input.RefreshToken)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		if errors.Is(err, service.ErrInvalidRefreshToken) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to refresh session"})
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout godoc
+// @Summary Logout user
+// @Description Revoke the access token used for the request and, when given, the refresh token of the same session
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body LogoutInput false "Refresh token of the session"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Security BearerAuth
+// @Router /auth/logout [post]
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var input LogoutInput
+	// The body is optional; without it only the access token is revoked
+	_ = c.ShouldBindJSON(&input)
+
+	claims, ok := middleware.Claims(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.authService.Logout(c.Request.Context(), claims, input.RefreshToken); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to log out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// JWKS godoc
+// @Summary Token signing keys
+// @Description Public keys that user access tokens are signed with, current and retired, as a JSON Web Key Set. The library-server uses it to verify user tokens.
+// @Tags auth
+// @Produce json
+// @Success 200 {object} signing.JWKSet
+// @Router /.well-known/jwks.json [get]
+func (h *AuthHandler) JWKS(c *gin.Context) {
+	c.JSON(http.StatusOK, service.SigningKeys.JWKS())
+}
+
+// EmailInput represents a request body carrying an email address
+type EmailInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordInput represents the request body for completing a password reset
+type ResetPasswordInput struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// VerifyEmail godoc
+// @Summary Verify an email address
+// @Description Confirm the user's email address with the token from the verification email. Each token works once.
+// @Tags auth
+// @Produce json
+// @Param token query string true "Verification token"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid or expired token"
+// @Router /auth/verify-email [get]
+func (h *AuthHandler) VerifyEmail(c *gin.Context) {
+	if err := h.accountService.VerifyEmail(c.Request.Context(), c.Query("token")); err != nil {
+		if errors.Is(err, service.ErrInvalidUserToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// ResendVerification godoc
+// @Summary Resend the verification email
+// @Description Send the authenticated user a new verification link; earlier links stop working
+// @Tags auth
+// @Produce json
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 409 {object} map[string]string "Email is already verified"
+// @Security BearerAuth
+// @Router /auth/resend-verification [post]
+func (h *AuthHandler) ResendVerification(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := h.accountService.ResendVerificationEmail(c.Request.Context(), userID); err != nil {
+		if errors.Is(err, service.ErrEmailAlreadyVerified) {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+}
+
+// ForgotPassword godoc
+// @Summary Request a password reset
+// @Description Email a single-use password reset link to the account with this address. The response is the same whether or not the address is registered.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body EmailInput true "Email address"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string
+// @Router /auth/forgot-password [post]
+func (h *AuthHandler) ForgotPassword(c *gin.Context) {
+	var input EmailInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.RequestPasswordReset(c.Request.Context(), input.Email); err != nil {
+		log.Printf("Failed to send password reset email: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "If an account uses this email, a reset link has been sent to it"})
+}
+
+// ResetPassword godoc
+// @Summary Reset a password
+// @Description Set a new password with the token from the reset email. Each token works once and every session of the user is logged out.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body ResetPasswordInput true "Reset token and new password"
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} map[string]string "Invalid or expired token"
+// @Router /auth/reset-password [post]
+func (h *AuthHandler) ResetPassword(c *gin.Context) {
+	var input ResetPasswordInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.accountService.ResetPassword(c.Request.Context(), input.Token, input.NewPassword); err != nil {
+		if errors.Is(err, service.ErrInvalidUserToken) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reset password"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password reset successfully"})
+}
+
+// UnlockUser godoc
+// @Summary Unlock a user account
+// @Description Lift the lockout placed on a user account after repeated failed logins. Requires a library-server admin token with the patrons:manage permission.
+// @Tags auth
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} map[string]string
+// @Failure 401 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Security BearerAuth
+// @Router /admin/users/{id}/unlock [post]
+func (h *AuthHandler) UnlockUser(c *gin.Context) {
+	userID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var actorID *uint
+	if adminID, ok := middleware.StaffAdminID(c); ok {
+		actorID = &adminID
+	}
+	if err := h.authService.UnlockUser(c.Request.Context(), uint(userID), actorID); err != nil {
+		if errors.Is(err, service.ErrUserNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unlock user"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": token,
-		"user":  user,
-	})
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked successfully"})
 }
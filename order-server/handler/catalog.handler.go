@@ -0,0 +1,95 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"order-server/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxCatalogPageSize bounds how many books one catalog search returns
+const maxCatalogPageSize = 100
+
+// CatalogHandler handles requests to browse the library's catalog
+type CatalogHandler struct {
+	catalogService *service.CatalogService
+}
+
+// NewCatalogHandler creates a new CatalogHandler
+func NewCatalogHandler(catalogService *service.CatalogService) *CatalogHandler {
+	return &CatalogHandler{catalogService: catalogService}
+}
+
+// SearchBooks godoc
+// @Summary Search the catalog
+// @Description Browse the library's books with how many copies are available, filtered by author, category name or title. No login is needed.
+// @Tags catalog
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param pageSize query int false "Number of items per page, at most 100" default(10)
+// @Param author query string false "Filter by author"
+// @Param category query string false "Filter by category name"
+// @Param title query string false "Filter by book title"
+// @Success 200 {object} service.CatalogPage
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /catalog/books [get]
+func (h *CatalogHandler) SearchBooks(c *gin.Context) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid page"})
+		return
+	}
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "10"))
+	if err != nil || pageSize < 1 || pageSize > maxCatalogPageSize {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid pageSize"})
+		return
+	}
+
+	result, err := h.catalogService.SearchBooks(c.Request.Context(), service.CatalogQuery{
+		Page:     page,
+		PageSize: pageSize,
+		Author:   c.Query("author"),
+		Category: c.Query("category"),
+		Title:    c.Query("title"),
+	})
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// GetBook godoc
+// @Summary Get a catalog book
+// @Description Get a book with its copies and whether each is available. No login is needed.
+// @Tags catalog
+// @Produce json
+// @Param id path int true "Book ID"
+// @Success 200 {object} service.CatalogBook
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 404 {object} ErrorResponse "Book not found"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /catalog/books/{id} [get]
+func (h *CatalogHandler) GetBook(c *gin.Context) {
+	bookID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid book ID"})
+		return
+	}
+
+	book, err := h.catalogService.GetBook(c.Request.Context(), uint(bookID))
+	if err != nil {
+		if errors.Is(err, service.ErrBookNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Book not found"})
+			return
+		}
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, book)
+}
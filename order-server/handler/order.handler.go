@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"order-server/dto"
+	"order-server/middleware"
+	"order-server/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OrderHandler handles HTTP requests for multi-book orders
+type OrderHandler struct {
+	orderService *service.OrderService
+}
+
+// NewOrderHandler creates a new OrderHandler
+func NewOrderHandler(orderService *service.OrderService) *OrderHandler {
+	return &OrderHandler{orderService: orderService}
+}
+
+// PlaceOrderRequest represents the request body for ordering several books at once
+type PlaceOrderRequest struct {
+	BookIDs []uint `json:"book_ids" binding:"required,min=1,dive,required"`
+}
+
+// PlaceOrder godoc
+// @Summary Order several books at once
+// @Description Ask for a copy of every listed book for the authenticated user, all or nothing. The order is saved and answered at once while still placing, and the library-server reserves the books in the background, even if it is down at the moment. Poll the order to see it become placed, or failed with the receipts already created canceled again.
+// @Tags orders
+// @Accept json
+// @Produce json
+// @Param request body PlaceOrderRequest true "Books to order"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 202 {object} dto.OrderResponse "Order being placed"
+// @Security BearerAuth
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /orders [post]
+func (h *OrderHandler) PlaceOrder(c *gin.Context) {
+	var request PlaceOrderRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	order, err := h.orderService.PlaceOrder(c.Request.Context(), userID, request.BookIDs)
+	switch {
+	case err == nil:
+		c.JSON(http.StatusAccepted, dto.NewOrderResponse(order))
+	case errors.Is(err, service.ErrEmptyOrder), errors.Is(err, service.ErrTooManyBooks), errors.Is(err, service.ErrDuplicateBook):
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to place order"})
+	}
+}
+
+// GetOrders godoc
+// @Summary Get orders for authenticated user
+// @Description Get every order of the authenticated user, newest first
+// @Tags orders
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Security BearerAuth
+// @Success 200 {array} dto.OrderResponse "Orders"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /orders [get]
+func (h *OrderHandler) GetOrders(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	orders, err := h.orderService.GetOrdersByUserID(c.Request.Context(), userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch orders"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewOrderResponses(orders))
+}
+
+// GetOrder godoc
+// @Summary Get an order
+// @Description Get one of the authenticated user's orders with the status of each line
+// @Tags orders
+// @Produce json
+// @Param id path int true "Order ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Security BearerAuth
+// @Success 200 {object} dto.OrderResponse "Order"
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "Order not found"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /orders/{id} [get]
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	orderID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid order ID"})
+		return
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	order, err := h.orderService.GetOrder(c.Request.Context(), userID, uint(orderID))
+	if err != nil {
+		if errors.Is(err, service.ErrOrderNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Order not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to fetch order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewOrderResponse(order))
+}
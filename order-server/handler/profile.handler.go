@@ -0,0 +1,226 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"order-server/dto"
+	"order-server/libraryclient"
+	"order-server/middleware"
+	"order-server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ProfileHandler handles the authenticated user's requests about their own account
+type ProfileHandler struct {
+	profileService *service.ProfileService
+}
+
+// NewProfileHandler creates a new ProfileHandler
+func NewProfileHandler(profileService *service.ProfileService) *ProfileHandler {
+	return &ProfileHandler{profileService: profileService}
+}
+
+// UpdateProfileRequest represents the request body for changing a profile;
+// omitted fields are left unchanged
+type UpdateProfileRequest struct {
+	Username *string `json:"username" binding:"omitempty,min=1"`
+	Email    *string `json:"email" binding:"omitempty,email"`
+}
+
+// ChangePasswordRequest represents the request body for changing a password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,min=6"`
+}
+
+// DeleteAccountRequest represents the request body for deleting an account
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// GetProfile godoc
+// @Summary Get own profile
+// @Description Get the profile of the authenticated user
+// @Tags me
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Security BearerAuth
+// @Success 200 {object} dto.UserResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /me [get]
+func (h *ProfileHandler) GetProfile(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	profile, err := h.profileService.GetProfile(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, err, "Failed to fetch profile")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewUserResponse(profile))
+}
+
+// UpdateProfile godoc
+// @Summary Update own profile
+// @Description Change the username or email of the authenticated user. A new email address must be verified again before receipts or holds can be placed.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param request body UpdateProfileRequest true "Fields to change"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Security BearerAuth
+// @Success 200 {object} dto.UserResponse
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 409 {object} ErrorResponse "Username or email already in use"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /me [patch]
+func (h *ProfileHandler) UpdateProfile(c *gin.Context) {
+	var request UpdateProfileRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	profile, err := h.profileService.UpdateProfile(c.Request.Context(), userID, service.ProfileUpdate{
+		Username: request.Username,
+		Email:    request.Email,
+	})
+	if err != nil {
+		h.respondError(c, err, "Failed to update profile")
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.NewUserResponse(profile))
+}
+
+// ChangePassword godoc
+// @Summary Change own password
+// @Description Set a new password for the authenticated user after checking the current one. Every session is logged out, including the current one.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param request body ChangePasswordRequest true "Current and new password"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Current password is incorrect"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /me/password [put]
+func (h *ProfileHandler) ChangePassword(c *gin.Context) {
+	var request ChangePasswordRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	if err := h.profileService.ChangePassword(c.Request.Context(), userID, request.CurrentPassword, request.NewPassword); err != nil {
+		h.respondError(c, err, "Failed to change password")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully, log in again"})
+}
+
+// DeleteAccount godoc
+// @Summary Delete own account
+// @Description Delete the authenticated user's account after checking their password. Their receipts, holds and fines on the library-server are kept but no longer linked to them. Books must be returned and fines paid first, and orders and receipt cancellations must have finished.
+// @Tags me
+// @Accept json
+// @Produce json
+// @Param request body DeleteAccountRequest true "Password"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Security BearerAuth
+// @Success 200 {object} map[string]string
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Password is incorrect"
+// @Failure 409 {object} ErrorResponse "Books still reserved or on loan, fines outstanding, or orders and cancellations unfinished"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /me [delete]
+func (h *ProfileHandler) DeleteAccount(c *gin.Context) {
+	var request DeleteAccountRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: err.Error()})
+		return
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	if err := h.profileService.DeleteAccount(c.Request.Context(), userID, request.Password); err != nil {
+		h.respondError(c, err, "Failed to delete account")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account deleted"})
+}
+
+// ExportAccount godoc
+// @Summary Export own data
+// @Description Download everything kept about the authenticated user as JSON: their profile and their full history of receipts, holds and fines
+// @Tags me
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Security BearerAuth
+// @Success 200 {object} dto.AccountExportResponse
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /me/export [get]
+func (h *ProfileHandler) ExportAccount(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	export, err := h.profileService.Export(c.Request.Context(), userID)
+	if err != nil {
+		h.respondError(c, err, "Failed to export account")
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="account-%d.json"`, userID))
+	c.IndentedJSON(http.StatusOK, dto.NewAccountExportResponse(export))
+}
+
+func (h *ProfileHandler) respondError(c *gin.Context, err error, fallback string) {
+	switch {
+	case errors.Is(err, service.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "User not found"})
+	case errors.Is(err, service.ErrIncorrectPassword):
+		c.JSON(http.StatusForbidden, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, service.ErrUsernameTaken), errors.Is(err, service.ErrEmailTaken), errors.Is(err, service.ErrLibraryObligated), errors.Is(err, service.ErrCommandsInFlight):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: err.Error()})
+	case errors.Is(err, libraryclient.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Library is unavailable, try again later"})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: fallback})
+	}
+}
@@ -1,7 +1,13 @@
 package handler
 
 import (
+	"errors"
+	apiv1 "library-contract/v1"
+	"log"
 	"net/http"
+	"order-server/dto"
+	"order-server/libraryclient"
+	"order-server/middleware"
 	"order-server/service"
 	"strconv"
 
@@ -10,26 +16,30 @@ import (
 
 // UserHandler handles HTTP requests related to user operations
 type UserHandler struct {
-	userService *service.UserService
+	userService  *service.UserService
+	orderService *service.OrderService
 }
 
 // NewUserHandler creates a new UserHandler
-func NewUserHandler(userService *service.UserService) *UserHandler {
+func NewUserHandler(userService *service.UserService, orderService *service.OrderService) *UserHandler {
 	return &UserHandler{
-		userService: userService,
+		userService:  userService,
+		orderService: orderService,
 	}
 }
 
 // PlaceReceipt godoc
 // @Summary Place a new receipt
-// @Description Place a new receipt for a user and book
+// @Description Ask for a copy of a book for the authenticated user. The request is saved as an order of that one book and answered at once while still placing, and the library-server reserves the book in the background, even if it is down at the moment. Poll the order to see it become placed with its receipt, or failed.
 // @Tags receipts
 // @Accept json
 // @Produce json
 // @Param request body PlaceReceiptRequest true "Receipt details"
 // @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
-// @Success 201 "Created"
+// @Success 202 {object} dto.OrderResponse "Order being placed"
+// @Security BearerAuth
 // @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
 // @Router /receipts [post]
 func (h *UserHandler) PlaceReceipt(c *gin.Context) {
@@ -40,26 +50,85 @@ func (h *UserHandler) PlaceReceipt(c *gin.Context) {
 		return
 	}
 
-	err := h.userService.PlaceReceipt(c.Request.Context(), request.UserID, request.BookID)
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	order, err := h.orderService.PlaceOrder(c.Request.Context(), userID, []uint{request.BookID})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to place receipt"})
 		return
 	}
 
-	c.Status(http.StatusCreated)
+	c.JSON(http.StatusAccepted, dto.NewOrderResponse(order))
+}
+
+// GetReceipt godoc
+// @Summary Get a receipt
+// @Description Get a receipt of the authenticated user. Library staff holding receipts:read may read any receipt with their library-server token.
+// @Tags receipts
+// @Produce json
+// @Param id path int true "Receipt ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} v1.Receipt "Receipt"
+// @Security BearerAuth
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Staff token without receipts:read"
+// @Failure 404 {object} ErrorResponse "Receipt not found or not owned by the user"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /receipts/{id} [get]
+func (h *UserHandler) GetReceipt(c *gin.Context) {
+	receiptID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid receipt ID"})
+		return
+	}
+
+	var receipt *apiv1.Receipt
+	if _, staff := middleware.StaffAdminID(c); staff {
+		receipt, err = h.userService.GetReceiptByID(c.Request.Context(), uint(receiptID))
+	} else {
+		userID, ok := middleware.UserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+			return
+		}
+		receipt, err = h.userService.GetUserReceipt(c.Request.Context(), userID, uint(receiptID))
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrReceiptNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Receipt not found"})
+			return
+		}
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, receipt)
 }
 
 // CancelReceipt godoc
 // @Summary Cancel a receipt
-// @Description Cancel an existing receipt
+// @Description Cancel a pending receipt owned by the authenticated user. The cancellation is saved and answered at once while still canceling, and the library-server carries it out in the background; poll the cancellation to see it become canceled, or failed when the receipt is not the user's or no longer pending. Library staff holding receipts:write may cancel any receipt with their library-server token, which is done at once and answered with 200.
 // @Tags receipts
 // @Accept json
 // @Produce json
 // @Param id path int true "Receipt ID"
 // @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
-// @Success 200 "OK"
+// @Success 200 "Canceled by staff"
+// @Success 202 {object} dto.ReceiptCancellationResponse "Cancellation being carried out"
+// @Security BearerAuth
 // @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Staff token without receipts:write"
+// @Failure 404 {object} ErrorResponse "Receipt not found, for staff"
+// @Failure 409 {object} ErrorResponse "Receipt can no longer be canceled, for staff"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 503 {object} ErrorResponse "Library unavailable, for staff"
 // @Router /receipts/{id}/cancel [post]
 func (h *UserHandler) CancelReceipt(c *gin.Context) {
 	receiptID, err := strconv.ParseUint(c.Param("id"), 10, 32)
@@ -68,13 +137,65 @@ func (h *UserHandler) CancelReceipt(c *gin.Context) {
 		return
 	}
 
-	err = h.userService.CancelReceipt(c.Request.Context(), uint(receiptID))
+	if _, staff := middleware.StaffAdminID(c); staff {
+		if err := h.userService.CancelAnyReceipt(c.Request.Context(), uint(receiptID)); err != nil {
+			respondLibraryError(c, err)
+			return
+		}
+		c.Status(http.StatusOK)
+		return
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+	cancellation, err := h.orderService.CancelReceipt(c.Request.Context(), userID, uint(receiptID))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to cancel receipt"})
 		return
 	}
 
-	c.Status(http.StatusOK)
+	c.JSON(http.StatusAccepted, dto.NewReceiptCancellationResponse(cancellation))
+}
+
+// GetReceiptCancellation godoc
+// @Summary Get the cancellation of a receipt
+// @Description Get where the authenticated user's latest request to cancel a receipt stands
+// @Tags receipts
+// @Produce json
+// @Param id path int true "Receipt ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} dto.ReceiptCancellationResponse "Cancellation"
+// @Security BearerAuth
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 404 {object} ErrorResponse "The user never asked to cancel the receipt"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Router /receipts/{id}/cancellation [get]
+func (h *UserHandler) GetReceiptCancellation(c *gin.Context) {
+	receiptID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid receipt ID"})
+		return
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	cancellation, err := h.orderService.GetReceiptCancellation(c.Request.Context(), userID, uint(receiptID))
+	switch {
+	case err == nil:
+		c.JSON(http.StatusOK, dto.NewReceiptCancellationResponse(cancellation))
+	case errors.Is(err, service.ErrCancellationNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to get cancellation"})
+	}
 }
 
 // GetReceiptsByUserID godoc
@@ -85,30 +206,247 @@ func (h *UserHandler) CancelReceipt(c *gin.Context) {
 // @Produce json
 // @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
 // @Security BearerAuth
-// @Success 200 {array} service.Receipt "Receipts"
+// @Success 200 {array} v1.Receipt "Receipts"
 // @Failure 401 {object} ErrorResponse "Unauthorized"
 // @Failure 500 {object} ErrorResponse "Internal Server Error"
-// @Router /users/receipts [get]
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /receipts [get]
 func (h *UserHandler) GetReceiptsByUserID(c *gin.Context) {
-	userID, exists := c.Get("userID")
-	if !exists {
+	userID, ok := middleware.UserID(c)
+	if !ok {
 		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
 		return
 	}
 
-	receipts, err := h.userService.GetReceiptsByUserID(c.Request.Context(), userID.(uint))
+	receipts, err := h.userService.GetReceiptsByUserID(c.Request.Context(), userID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: err.Error()})
+		respondLibraryError(c, err)
 		return
 	}
 
 	c.JSON(http.StatusOK, receipts)
 }
 
+// PlaceHold godoc
+// @Summary Join the hold queue for a book
+// @Description Queue for a book that has no available copies. When a copy comes back the first user in line gets a pending receipt for it.
+// @Tags holds
+// @Accept json
+// @Produce json
+// @Param request body PlaceHoldRequest true "Hold details"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 201 {object} v1.Hold "Hold with queue position"
+// @Security BearerAuth
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 409 {object} ErrorResponse "A copy is available or the user is already queued"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /holds [post]
+func (h *UserHandler) PlaceHold(c *gin.Context) {
+	var request PlaceHoldRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid request body"})
+		return
+	}
+
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	hold, err := h.userService.PlaceHold(c.Request.Context(), userID, request.BookID)
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, hold)
+}
+
+// GetHold godoc
+// @Summary Get a hold
+// @Description Get a hold of the authenticated user with its queue position. Library staff holding holds:read may read any hold with their library-server token.
+// @Tags holds
+// @Produce json
+// @Param id path int true "Hold ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 {object} v1.Hold "Hold"
+// @Security BearerAuth
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Staff token without holds:read"
+// @Failure 404 {object} ErrorResponse "Hold not found or not owned by the user"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /holds/{id} [get]
+func (h *UserHandler) GetHold(c *gin.Context) {
+	holdID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid hold ID"})
+		return
+	}
+
+	var hold *apiv1.Hold
+	if _, staff := middleware.StaffAdminID(c); staff {
+		hold, err = h.userService.GetHoldByID(c.Request.Context(), uint(holdID))
+	} else {
+		userID, ok := middleware.UserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+			return
+		}
+		hold, err = h.userService.GetUserHold(c.Request.Context(), userID, uint(holdID))
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrHoldNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Hold not found"})
+			return
+		}
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, hold)
+}
+
+// CancelHold godoc
+// @Summary Leave the hold queue
+// @Description Cancel a waiting hold of the authenticated user. Library staff holding holds:write may cancel any hold with their library-server token.
+// @Tags holds
+// @Produce json
+// @Param id path int true "Hold ID"
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Success 200 "OK"
+// @Security BearerAuth
+// @Failure 400 {object} ErrorResponse "Bad Request"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 403 {object} ErrorResponse "Staff token without holds:write"
+// @Failure 404 {object} ErrorResponse "Hold not found or not owned by the user"
+// @Failure 409 {object} ErrorResponse "Hold is no longer waiting"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /holds/{id} [delete]
+func (h *UserHandler) CancelHold(c *gin.Context) {
+	holdID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, ErrorResponse{Error: "Invalid hold ID"})
+		return
+	}
+
+	if _, staff := middleware.StaffAdminID(c); staff {
+		err = h.userService.CancelAnyHold(c.Request.Context(), uint(holdID))
+	} else {
+		userID, ok := middleware.UserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+			return
+		}
+		err = h.userService.CancelHold(c.Request.Context(), userID, uint(holdID))
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrHoldNotFound) {
+			c.JSON(http.StatusNotFound, ErrorResponse{Error: "Hold not found"})
+			return
+		}
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.Status(http.StatusOK)
+}
+
+// GetHoldsByUserID godoc
+// @Summary Get holds for authenticated user
+// @Description Get the holds of the authenticated user with their queue positions
+// @Tags holds
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Security BearerAuth
+// @Success 200 {array} v1.Hold "Holds"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /holds [get]
+func (h *UserHandler) GetHoldsByUserID(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	holds, err := h.userService.GetHoldsByUserID(c.Request.Context(), userID)
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, holds)
+}
+
+// GetFineBalance godoc
+// @Summary Get fines for authenticated user
+// @Description Get the outstanding fine balance of the authenticated user with every fine, payment and waiver
+// @Tags fines
+// @Produce json
+// @Param Authorization header string true "Bearer token" default(Bearer <Add access token here>)
+// @Security BearerAuth
+// @Success 200 {object} v1.FineBalance "Fine balance"
+// @Failure 401 {object} ErrorResponse "Unauthorized"
+// @Failure 500 {object} ErrorResponse "Internal Server Error"
+// @Failure 503 {object} ErrorResponse "Library unavailable"
+// @Router /fines [get]
+func (h *UserHandler) GetFineBalance(c *gin.Context) {
+	userID, ok := middleware.UserID(c)
+	if !ok {
+		c.JSON(http.StatusUnauthorized, ErrorResponse{Error: "User not authenticated"})
+		return
+	}
+
+	balance, err := h.userService.GetFineBalance(c.Request.Context(), userID)
+	if err != nil {
+		respondLibraryError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, balance)
+}
+
 // PlaceReceiptRequest represents the request body for placing a receipt
 type PlaceReceiptRequest struct {
-	UserID uint `json:"user_id"`
-	BookID uint `json:"book_id"`
+	BookID uint `json:"book_id" binding:"required"`
+}
+
+// PlaceHoldRequest represents the request body for joining a hold queue
+type PlaceHoldRequest struct {
+	BookID uint `json:"book_id" binding:"required"`
+}
+
+// respondLibraryError answers with the status matching a failed library-server
+// call. Errors that did not come from the library-server are logged rather than
+// shown, as they may describe its address or this server's internals.
+func respondLibraryError(c *gin.Context, err error) {
+	message := err.Error()
+	var apiErr *libraryclient.APIError
+	if errors.As(err, &apiErr) && apiErr.Message != "" {
+		message = apiErr.Message
+	}
+
+	switch {
+	case errors.Is(err, libraryclient.ErrNotFound):
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: message})
+	case errors.Is(err, libraryclient.ErrConflict):
+		c.JSON(http.StatusConflict, ErrorResponse{Error: message})
+	case errors.Is(err, libraryclient.ErrUnavailable):
+		c.JSON(http.StatusServiceUnavailable, ErrorResponse{Error: "Library is unavailable, try again later"})
+	case apiErr != nil:
+		c.JSON(http.StatusBadGateway, ErrorResponse{Error: message})
+	default:
+		log.Printf("Library request for %s %s failed: %v", c.Request.Method, c.Request.URL.Path, err)
+		c.JSON(http.StatusInternalServerError, ErrorResponse{Error: "Failed to complete the library request"})
+	}
 }
 
 // ErrorResponse represents an error response
@@ -0,0 +1,339 @@
+package handler
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"library-contract/signing"
+	apiv1 "library-contract/v1"
+	"order-server/dbtest"
+	"order-server/libraryclient"
+	"order-server/middleware"
+	"order-server/model"
+	"order-server/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	ownerID = 1
+	otherID = 2
+)
+
+// fakeLibrary serves receipt 1 and hold 1, both owned by ownerID, and records
+// which cancellations reached it
+type fakeLibrary struct {
+	mu       sync.Mutex
+	canceled []string
+}
+
+func (f *fakeLibrary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method + " " + r.URL.Path {
+	case "GET /receipts/1":
+		json.NewEncoder(w).Encode(apiv1.Receipt{ID: 1, UserID: ownerID, Status: apiv1.ReceiptStatusPending})
+	case "GET /holds/1":
+		json.NewEncoder(w).Encode(apiv1.Hold{ID: 1, UserID: ownerID, Status: apiv1.HoldStatusWaiting})
+	case "PATCH /receipts/1/status", "DELETE /holds/1":
+		f.mu.Lock()
+		f.canceled = append(f.canceled, r.URL.Path)
+		f.mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("{}"))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(apiv1.ErrorResponse{Error: "not found"})
+	}
+}
+
+func (f *fakeLibrary) cancellations() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.canceled)
+}
+
+// asUser stands in for middleware.Authenticate, which needs the user database
+func asUser(userID uint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("userID", userID)
+		c.Next()
+	}
+}
+
+// staffKeyServer publishes a fresh Ed25519 key the way library-server does and
+// returns a function that issues staff tokens signed with it
+func staffKeyServer(t *testing.T) func(permissions ...string) string {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := fmt.Sprintf("test-%d", time.Now().UnixNano())
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(signing.JWKSet{Keys: []signing.JWK{{
+			KeyType: "OKP", Curve: "Ed25519", KeyID: kid,
+			X: base64.RawURLEncoding.EncodeToString(public),
+		}}})
+	}))
+	t.Cleanup(jwks.Close)
+	t.Setenv("LIBRARY_SERVER_JWKS_URL", jwks.URL)
+
+	return func(permissions ...string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, service.StaffClaims{
+			AdminID:     9,
+			Permissions: permissions,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    service.StaffTokenIssuer,
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		})
+		token.Header["kid"] = kid
+		signed, err := token.SignedString(private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+}
+
+func TestUserHandlerOwnership(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	staffToken := staffKeyServer(t)
+
+	endpoints := []struct {
+		method, path, permission string
+		cancels                  bool
+		// Users cancel receipts through the broker, so the library-server
+		// checks their ownership; see the order service tests
+		staffOnly bool
+		handler   func(*UserHandler) gin.HandlerFunc
+	}{
+		{http.MethodGet, "/receipts/1", service.PermissionReceiptsRead, false, false, func(h *UserHandler) gin.HandlerFunc { return h.GetReceipt }},
+		{http.MethodPost, "/receipts/1/cancel", service.PermissionReceiptsWrite, true, true, func(h *UserHandler) gin.HandlerFunc { return h.CancelReceipt }},
+		{http.MethodGet, "/holds/1", service.PermissionHoldsRead, false, false, func(h *UserHandler) gin.HandlerFunc { return h.GetHold }},
+		{http.MethodDelete, "/holds/1", service.PermissionHoldsWrite, true, false, func(h *UserHandler) gin.HandlerFunc { return h.CancelHold }},
+	}
+
+	for _, endpoint := range endpoints {
+		cases := []struct {
+			name    string
+			auth    gin.HandlerFunc
+			token   string
+			status  int
+			reaches bool
+		}{
+			{"owner", asUser(ownerID), "", http.StatusOK, true},
+			{"other user", asUser(otherID), "", http.StatusNotFound, false},
+			{"staff", middleware.AuthenticateUserOrStaff(endpoint.permission), staffToken(endpoint.permission), http.StatusOK, true},
+			{"staff without permission", middleware.AuthenticateUserOrStaff(endpoint.permission), staffToken(service.PermissionPatronsManage), http.StatusForbidden, false},
+		}
+		for _, tc := range cases {
+			if endpoint.staffOnly && tc.token == "" {
+				continue
+			}
+			t.Run(endpoint.method+" "+endpoint.path+" as "+tc.name, func(t *testing.T) {
+				library := &fakeLibrary{}
+				server := httptest.NewServer(library)
+				defer server.Close()
+				handler := NewUserHandler(service.NewUserService(libraryclient.New(libraryclient.Config{
+					BaseURL:     server.URL,
+					ServiceName: libraryclient.ServiceName,
+					Secret:      "test-secret",
+				})), nil)
+
+				router := gin.New()
+				routePath := strings.Replace(endpoint.path, "/1", "/:id", 1)
+				router.Handle(endpoint.method, routePath, tc.auth, endpoint.handler(handler))
+
+				req := httptest.NewRequest(endpoint.method, endpoint.path, nil)
+				if tc.token != "" {
+					req.Header.Set("Authorization", "Bearer "+tc.token)
+				}
+				rec := httptest.NewRecorder()
+				router.ServeHTTP(rec, req)
+
+				if rec.Code != tc.status {
+					t.Fatalf("got status %d, want %d: %s", rec.Code, tc.status, rec.Body)
+				}
+				if endpoint.cancels {
+					if reached := library.cancellations() > 0; reached != tc.reaches {
+						t.Errorf("cancellation reached the library: %v, want %v", reached, tc.reaches)
+					}
+				}
+			})
+		}
+	}
+}
+
+// loadTestSigningKeys gives service.SigningKeys a throwaway key for the test
+func loadTestSigningKeys(t *testing.T) {
+	t.Helper()
+	t.Setenv("JWT_SIGNING_KEY", "")
+	t.Setenv("JWT_RETIRED_KEYS", "")
+	previous := service.SigningKeys
+	if err := service.LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { service.SigningKeys = previous })
+}
+
+// receiptRouter serves GET /receipts/:id from a fakeLibrary behind the real
+// middleware, the way UserRoutes does
+func receiptRouter(t *testing.T) (*gin.Engine, *fakeLibrary) {
+	t.Helper()
+	library := &fakeLibrary{}
+	server := httptest.NewServer(library)
+	t.Cleanup(server.Close)
+	handler := NewUserHandler(service.NewUserService(libraryclient.New(libraryclient.Config{
+		BaseURL:     server.URL,
+		ServiceName: libraryclient.ServiceName,
+		Secret:      "test-secret",
+	})), nil)
+
+	router := gin.New()
+	router.GET("/receipts/:id", middleware.AuthenticateUserOrStaff(service.PermissionReceiptsRead), handler.GetReceipt)
+	return router, library
+}
+
+func getReceipt(router *gin.Engine, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/receipts/1", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthenticateRejectsMalformedClaims(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	loadTestSigningKeys(t)
+	router, _ := receiptRouter(t)
+
+	valid := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"id":  ownerID,
+			"ver": 0,
+			"iss": service.TokenIssuer,
+			"jti": "test",
+			"exp": time.Now().Add(time.Minute).Unix(),
+		}
+	}
+	cases := []struct {
+		name   string
+		change func(jwt.MapClaims)
+	}{
+		{"user ID as a string", func(c jwt.MapClaims) { c["id"] = "1" }},
+		{"negative user ID", func(c jwt.MapClaims) { c["id"] = -1 }},
+		{"version as a string", func(c jwt.MapClaims) { c["ver"] = "0" }},
+		{"missing user ID", func(c jwt.MapClaims) { delete(c, "id") }},
+		{"zero user ID", func(c jwt.MapClaims) { c["id"] = 0 }},
+		{"missing expiry", func(c jwt.MapClaims) { delete(c, "exp") }},
+		{"expired", func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Minute).Unix() }},
+		{"other issuer", func(c jwt.MapClaims) { c["iss"] = "someone-else" }},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			claims := valid()
+			tc.change(claims)
+			token, err := service.SigningKeys.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rec := getReceipt(router, token); rec.Code != http.StatusUnauthorized {
+				t.Errorf("got status %d, want 401: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+
+	t.Run("unsigned", func(t *testing.T) {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodNone, valid()).SignedString(jwt.UnsafeAllowNoneSignatureType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec := getReceipt(router, token); rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401: %s", rec.Code, rec.Body)
+		}
+	})
+	t.Run("signed with another key", func(t *testing.T) {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, valid())
+		token.Header["kid"] = "unknown"
+		signed, err := token.SignedString(private)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec := getReceipt(router, signed); rec.Code != http.StatusUnauthorized {
+			t.Errorf("got status %d, want 401: %s", rec.Code, rec.Body)
+		}
+	})
+}
+
+func TestAuthenticateAcceptsIssuedTokens(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	loadTestSigningKeys(t)
+	dbtest.Connect(t, "handler_test")
+	router, _ := receiptRouter(t)
+	auth := service.NewAuthService()
+	ctx := context.Background()
+
+	login := func(username string) *service.TokenPair {
+		t.Helper()
+		user := model.User{Username: username, Email: username + "@example.com", Password: "password"}
+		if err := auth.Register(ctx, &user); err != nil {
+			t.Fatal(err)
+		}
+		_, tokens, err := auth.Login(ctx, username, "password", "192.0.2.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tokens
+	}
+	// Registered first, so the owner of the fake library's receipt
+	owner := login("owner")
+	other := login("other")
+
+	if rec := getReceipt(router, owner.AccessToken); rec.Code != http.StatusOK {
+		t.Fatalf("owner: got status %d, want 200: %s", rec.Code, rec.Body)
+	}
+	if rec := getReceipt(router, other.AccessToken); rec.Code != http.StatusNotFound {
+		t.Errorf("other user: got status %d, want 404: %s", rec.Code, rec.Body)
+	}
+
+	if err := auth.RevokeSessions(ctx, ownerID); err != nil {
+		t.Fatal(err)
+	}
+	if rec := getReceipt(router, owner.AccessToken); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: got status %d, want 401: %s", rec.Code, rec.Body)
+	}
+}
+
+func TestRespondLibraryErrorHidesInternalErrors(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/receipts", func(c *gin.Context) {
+		respondLibraryError(c, errors.New("decoding response from http://library.internal:8080: unexpected EOF"))
+	})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/receipts", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Fatalf("got status %d, want 500", rec.Code)
+	}
+	if strings.Contains(rec.Body.String(), "library.internal") {
+		t.Errorf("response leaks the underlying error: %s", rec.Body)
+	}
+}
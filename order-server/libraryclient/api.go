@@ -0,0 +1,125 @@
+package libraryclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	apiv1 "library-contract/v1"
+)
+
+// CreateReceipt reserves an available copy of a book for a user. It fails with
+// ErrNotFound for unknown books and ErrConflict when no copy is available.
+func (c *Client) CreateReceipt(ctx context.Context, request apiv1.CreateReceiptRequest) (*apiv1.Receipt, error) {
+	var receipt apiv1.Receipt
+	if err := c.do(ctx, http.MethodPost, "/receipts/", request, &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// GetReceipt fetches a receipt by ID
+func (c *Client) GetReceipt(ctx context.Context, receiptID uint) (*apiv1.Receipt, error) {
+	var receipt apiv1.Receipt
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/receipts/%d", receiptID), nil, &receipt); err != nil {
+		return nil, err
+	}
+	return &receipt, nil
+}
+
+// ListUserReceipts fetches every receipt of a user
+func (c *Client) ListUserReceipts(ctx context.Context, userID uint) ([]apiv1.Receipt, error) {
+	var receipts []apiv1.Receipt
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/receipts/user/%d", userID), nil, &receipts); err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+// UpdateReceiptStatus moves a receipt to status. It fails with ErrConflict
+// when the receipt's lifecycle does not allow the change.
+func (c *Client) UpdateReceiptStatus(ctx context.Context, receiptID uint, status string) error {
+	return c.do(ctx, http.MethodPatch, fmt.Sprintf("/receipts/%d/status", receiptID), apiv1.UpdateReceiptStatusRequest{Status: status}, nil)
+}
+
+// PlaceHold queues a user for a book. It fails with ErrConflict when a copy
+// is available or the user is already queued.
+func (c *Client) PlaceHold(ctx context.Context, request apiv1.PlaceHoldRequest) (*apiv1.Hold, error) {
+	var hold apiv1.Hold
+	if err := c.do(ctx, http.MethodPost, "/holds/", request, &hold); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// GetHold fetches a hold by ID
+func (c *Client) GetHold(ctx context.Context, holdID uint) (*apiv1.Hold, error) {
+	var hold apiv1.Hold
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/holds/%d", holdID), nil, &hold); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// ListUserHolds fetches every hold of a user with the queue positions of those still waiting
+func (c *Client) ListUserHolds(ctx context.Context, userID uint) ([]apiv1.Hold, error) {
+	var holds []apiv1.Hold
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/holds/user/%d", userID), nil, &holds); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// CancelHold takes a waiting hold out of its queue. It fails with ErrConflict
+// when the hold is no longer waiting.
+func (c *Client) CancelHold(ctx context.Context, holdID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/holds/%d", holdID), nil, nil)
+}
+
+// GetFineBalance fetches a user's outstanding fines and ledger
+func (c *Client) GetFineBalance(ctx context.Context, userID uint) (*apiv1.FineBalance, error) {
+	var balance apiv1.FineBalance
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/fines/user/%d", userID), nil, &balance); err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// AnonymizePatron detaches a user's receipts, holds and fines from them. It
+// fails with ErrConflict while they have books reserved or on loan or owe fines.
+func (c *Client) AnonymizePatron(ctx context.Context, userID uint) error {
+	return c.do(ctx, http.MethodDelete, fmt.Sprintf("/patrons/%d", userID), nil, nil)
+}
+
+// SearchBooks fetches one page of the books matching query
+func (c *Client) SearchBooks(ctx context.Context, query BookQuery) (*apiv1.BookPage, error) {
+	params := url.Values{}
+	params.Set("page", strconv.Itoa(query.Page))
+	params.Set("pageSize", strconv.Itoa(query.PageSize))
+	if query.Author != "" {
+		params.Set("author", query.Author)
+	}
+	if query.Category != "" {
+		params.Set("category", query.Category)
+	}
+	if query.Title != "" {
+		params.Set("title", query.Title)
+	}
+
+	var page apiv1.BookPage
+	if err := c.do(ctx, http.MethodGet, "/books/?"+params.Encode(), nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// GetBook fetches a book with its copies
+func (c *Client) GetBook(ctx context.Context, bookID uint) (*apiv1.Book, error) {
+	var book apiv1.Book
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/books/%d", bookID), nil, &book); err != nil {
+		return nil, err
+	}
+	return &book, nil
+}
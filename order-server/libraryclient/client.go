@@ -0,0 +1,230 @@
+// Package libraryclient is the order-server's client for the library-server
+// API. Calls are signed with a service secret, time out individually, are
+// retried with jittered backoff when that is safe, and stop being attempted
+// for a while once the library-server keeps failing.
+package libraryclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	apiv1 "library-contract/v1"
+)
+
+// Defaults used for the zero values of Config
+const (
+	defaultTimeout          = 5 * time.Second
+	defaultMaxRetries       = 2
+	defaultBackoff          = 100 * time.Millisecond
+	defaultMaxBackoff       = 2 * time.Second
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 30 * time.Second
+)
+
+// Config describes how to reach the library-server
+type Config struct {
+	BaseURL string
+	// ServiceName and Secret sign every request; see ServiceName and CatalogServiceName
+	ServiceName string
+	Secret      string
+	// Timeout bounds each attempt of a call
+	Timeout time.Duration
+	// MaxRetries is how many times an idempotent call is tried again after
+	// the library-server was unreachable or failed; negative disables retries
+	MaxRetries int
+	// Backoff is the longest wait before the first retry; it doubles with
+	// each retry up to MaxBackoff and the actual wait is a random part of it
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// After BreakerThreshold consecutive failures no calls are made for
+	// BreakerCooldown; a negative threshold disables the breaker
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+// ConfigFromEnv reads the library-server address from LIBRARY_SERVER_URL and
+// the call timeout and retry count from LIBRARY_CLIENT_TIMEOUT and
+// LIBRARY_CLIENT_MAX_RETRIES, leaving the credentials to the caller
+func ConfigFromEnv(serviceName, secret string) Config {
+	config := Config{
+		BaseURL:     os.Getenv("LIBRARY_SERVER_URL"),
+		ServiceName: serviceName,
+		Secret:      secret,
+	}
+	if timeout, err := time.ParseDuration(os.Getenv("LIBRARY_CLIENT_TIMEOUT")); err == nil {
+		config.Timeout = timeout
+	}
+	if retries, err := strconv.Atoi(os.Getenv("LIBRARY_CLIENT_MAX_RETRIES")); err == nil {
+		config.MaxRetries = retries
+		if retries == 0 {
+			config.MaxRetries = -1
+		}
+	}
+	return config
+}
+
+// Client calls the library-server API. It is safe for concurrent use.
+type Client struct {
+	http       *http.Client
+	baseURL    string
+	timeout    time.Duration
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	breaker    *breaker
+}
+
+// New creates a Client from config, filling in defaults for zero values
+func New(config Config) *Client {
+	c := &Client{
+		http:       &http.Client{Transport: newSigningTransport(config.ServiceName, config.Secret, nil)},
+		baseURL:    config.BaseURL,
+		timeout:    config.Timeout,
+		maxRetries: config.MaxRetries,
+		backoff:    config.Backoff,
+		maxBackoff: config.MaxBackoff,
+	}
+	if c.timeout <= 0 {
+		c.timeout = defaultTimeout
+	}
+	if c.maxRetries == 0 {
+		c.maxRetries = defaultMaxRetries
+	}
+	if c.maxRetries < 0 {
+		c.maxRetries = 0
+	}
+	if c.backoff <= 0 {
+		c.backoff = defaultBackoff
+	}
+	if c.maxBackoff <= 0 {
+		c.maxBackoff = defaultMaxBackoff
+	}
+	threshold, cooldown := config.BreakerThreshold, config.BreakerCooldown
+	if threshold == 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	c.breaker = newBreaker(threshold, cooldown)
+	return c
+}
+
+// do sends a request with body encoded as JSON, when not nil, and decodes a
+// 2xx response into out, when not nil. GET, PUT and DELETE requests are
+// idempotent and retried on failure; others are sent once.
+func (c *Client) do(ctx context.Context, method, path string, body, out interface{}) error {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = json.Marshal(body); err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+	}
+
+	attempts := 1
+	switch method {
+	case http.MethodGet, http.MethodPut, http.MethodDelete:
+		attempts += c.maxRetries
+	}
+
+	var err error
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := c.wait(ctx, attempt); waitErr != nil {
+				return err
+			}
+		}
+		if !c.breaker.allow() {
+			// The failure that opened the breaker says more than the breaker
+			if err != nil {
+				return err
+			}
+			return ErrCircuitOpen
+		}
+		err = c.attempt(ctx, method, path, payload, out)
+		if ctx.Err() != nil {
+			// A caller giving up says nothing about the library-server's health
+			c.breaker.abandon()
+			return err
+		}
+		c.breaker.record(errors.Is(err, ErrUnavailable))
+		if !errors.Is(err, ErrUnavailable) {
+			return err
+		}
+	}
+	return err
+}
+
+// attempt makes a single try at a call within the per-attempt timeout
+func (c *Client) attempt(ctx context.Context, method, path string, payload []byte, out interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return decodeError(resp)
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// wait sleeps before retry number attempt, for a random duration up to the
+// exponentially growing backoff, or until ctx is done
+func (c *Client) wait(ctx context.Context, attempt int) error {
+	backoff := c.backoff << (attempt - 1)
+	if backoff > c.maxBackoff || backoff <= 0 {
+		backoff = c.maxBackoff
+	}
+	timer := time.NewTimer(time.Duration(rand.Int63n(int64(backoff)) + 1))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// decodeError turns an error response into an APIError, keeping the message
+// and code from its body
+func decodeError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	var body apiv1.ErrorResponse
+	if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil {
+		apiErr.Message = body.Error
+		apiErr.Code = body.Code
+	}
+	return apiErr
+}
@@ -0,0 +1,244 @@
+package libraryclient
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apiv1 "library-contract/v1"
+)
+
+// countingServer answers every request with handler and counts the requests
+type countingServer struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newCountingServer(t *testing.T, handler http.HandlerFunc) *countingServer {
+	t.Helper()
+	s := &countingServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.requests.Add(1)
+		handler(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// failing answers like a library-server that is up but failing
+func failing(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(apiv1.ErrorResponse{Error: "database is down"})
+}
+
+func ok(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("{}"))
+}
+
+func newTestClient(baseURL string, config Config) *Client {
+	config.BaseURL = baseURL
+	config.ServiceName = ServiceName
+	config.Secret = "test-secret"
+	if config.Backoff == 0 {
+		config.Backoff = time.Millisecond
+	}
+	return New(config)
+}
+
+func TestAttemptsTimeOut(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	server := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+	client := newTestClient(server.URL, Config{Timeout: 20 * time.Millisecond, MaxRetries: -1, BreakerThreshold: -1})
+
+	start := time.Now()
+	err := client.do(context.Background(), http.MethodGet, "/receipts/1", nil, nil)
+	if !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("got %v, want %v", err, ErrUnavailable)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("call took %s, want it cut off after the timeout", elapsed)
+	}
+}
+
+func TestOnlyIdempotentMethodsAreRetried(t *testing.T) {
+	cases := []struct {
+		method   string
+		attempts int32
+	}{
+		{http.MethodGet, 3},
+		{http.MethodPut, 3},
+		{http.MethodDelete, 3},
+		{http.MethodPost, 1},
+		{http.MethodPatch, 1},
+	}
+	for _, tc := range cases {
+		t.Run(tc.method, func(t *testing.T) {
+			server := newCountingServer(t, failing)
+			client := newTestClient(server.URL, Config{MaxRetries: 2, BreakerThreshold: -1})
+
+			err := client.do(context.Background(), tc.method, "/receipts/1", nil, nil)
+			if !errors.Is(err, ErrUnavailable) {
+				t.Fatalf("got %v, want %v", err, ErrUnavailable)
+			}
+			if got := server.requests.Load(); got != tc.attempts {
+				t.Errorf("got %d attempts, want %d", got, tc.attempts)
+			}
+		})
+	}
+}
+
+func TestRefusalsAreNotRetried(t *testing.T) {
+	server := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(apiv1.ErrorResponse{Error: "receipt not found", Code: apiv1.CodeReceiptNotFound})
+	})
+	client := newTestClient(server.URL, Config{MaxRetries: 2, BreakerThreshold: 1})
+
+	err := client.do(context.Background(), http.MethodGet, "/receipts/1", nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrNotFound) || apiErr.Code != apiv1.CodeReceiptNotFound {
+		t.Fatalf("got %v, want the library's not found error", err)
+	}
+	if got := server.requests.Load(); got != 1 {
+		t.Errorf("got %d attempts, want 1", got)
+	}
+	// A refusal is an answer, so the breaker stays closed
+	if err := client.do(context.Background(), http.MethodGet, "/receipts/1", nil, nil); errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("breaker opened on a refusal")
+	}
+}
+
+func TestBreakerOpensAndTriesAgainAfterCooldown(t *testing.T) {
+	var up atomic.Bool
+	server := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if up.Load() {
+			ok(w, r)
+			return
+		}
+		failing(w, r)
+	})
+	const cooldown = 50 * time.Millisecond
+	client := newTestClient(server.URL, Config{MaxRetries: -1, BreakerThreshold: 2, BreakerCooldown: cooldown})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := client.do(ctx, http.MethodGet, "/receipts/1", nil, nil); errors.Is(err, ErrCircuitOpen) {
+			t.Fatalf("call %d was refused before the threshold", i+1)
+		}
+	}
+	if err := client.do(ctx, http.MethodGet, "/receipts/1", nil, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v with the breaker open, want %v", err, ErrCircuitOpen)
+	}
+	if got := server.requests.Load(); got != 2 {
+		t.Fatalf("got %d requests, want none sent while open", got)
+	}
+
+	// A failed trial opens it for another cooldown
+	time.Sleep(cooldown)
+	if err := client.do(ctx, http.MethodGet, "/receipts/1", nil, nil); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("no trial call was let through after the cooldown")
+	}
+	if err := client.do(ctx, http.MethodGet, "/receipts/1", nil, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("got %v after a failed trial, want %v", err, ErrCircuitOpen)
+	}
+
+	// A successful trial closes it
+	time.Sleep(cooldown)
+	up.Store(true)
+	for i := 0; i < 3; i++ {
+		if err := client.do(ctx, http.MethodGet, "/receipts/1", nil, nil); err != nil {
+			t.Fatalf("call %d after a successful trial: %v", i+1, err)
+		}
+	}
+}
+
+func TestBreakerLetsOneTrialThrough(t *testing.T) {
+	var up atomic.Bool
+	arrived := make(chan struct{}, 1)
+	release := make(chan struct{})
+	server := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			failing(w, r)
+			return
+		}
+		arrived <- struct{}{}
+		<-release
+		ok(w, r)
+	})
+	const cooldown = 20 * time.Millisecond
+	client := newTestClient(server.URL, Config{MaxRetries: -1, BreakerThreshold: 1, BreakerCooldown: cooldown})
+	ctx := context.Background()
+
+	client.do(ctx, http.MethodGet, "/receipts/1", nil, nil)
+	time.Sleep(cooldown)
+	up.Store(true)
+
+	trial := make(chan error, 1)
+	go func() { trial <- client.do(ctx, http.MethodGet, "/receipts/1", nil, nil) }()
+	<-arrived
+	if err := client.do(ctx, http.MethodGet, "/receipts/1", nil, nil); !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("got %v during the trial, want %v", err, ErrCircuitOpen)
+	}
+	close(release)
+	if err := <-trial; err != nil {
+		t.Fatalf("trial: %v", err)
+	}
+}
+
+func TestBreakerForgetsAbandonedTrial(t *testing.T) {
+	var hang atomic.Bool
+	server := newCountingServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if hang.Load() {
+			<-r.Context().Done()
+			return
+		}
+		failing(w, r)
+	})
+	const cooldown = 20 * time.Millisecond
+	client := newTestClient(server.URL, Config{MaxRetries: -1, BreakerThreshold: 1, BreakerCooldown: cooldown})
+
+	client.do(context.Background(), http.MethodGet, "/receipts/1", nil, nil)
+	time.Sleep(cooldown)
+
+	// The caller gives up on the trial, which says nothing about the library
+	hang.Store(true)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := client.do(ctx, http.MethodGet, "/receipts/1", nil, nil); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("no trial call was let through after the cooldown")
+	}
+
+	hang.Store(false)
+	requests := server.requests.Load()
+	if err := client.do(context.Background(), http.MethodGet, "/receipts/1", nil, nil); errors.Is(err, ErrCircuitOpen) {
+		t.Fatal("breaker stayed shut after the trial was abandoned")
+	}
+	if server.requests.Load() != requests+1 {
+		t.Error("the next call did not reach the library-server")
+	}
+}
+
+func TestBreakerOpeningDuringRetriesKeepsTheError(t *testing.T) {
+	server := newCountingServer(t, failing)
+	client := newTestClient(server.URL, Config{MaxRetries: 2, BreakerThreshold: 2, BreakerCooldown: time.Minute})
+
+	err := client.do(context.Background(), http.MethodGet, "/receipts/1", nil, nil)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable || apiErr.Message != "database is down" {
+		t.Fatalf("got %v, want the library's 503", err)
+	}
+	if got := server.requests.Load(); got != 2 {
+		t.Errorf("got %d attempts, want the retries to stop once the breaker opened", got)
+	}
+}
@@ -0,0 +1,49 @@
+package libraryclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kinds of failure callers can tell apart with errors.Is
+var (
+	ErrNotFound    = errors.New("not found in the library")
+	ErrConflict    = errors.New("conflicts with the library's current state")
+	ErrUnavailable = errors.New("library-server is unavailable")
+	ErrCircuitOpen = fmt.Errorf("%w: too many recent failures, not trying", ErrUnavailable)
+)
+
+// APIError is an error response from the library-server. It matches
+// ErrNotFound, ErrConflict or ErrUnavailable depending on its status code.
+type APIError struct {
+	StatusCode int
+	// Message and Code come from the library-server's error body, when it sent one
+	Message string
+	Code    string
+}
+
+func (e *APIError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("library-server responded with status %d", e.StatusCode)
+	}
+	return fmt.Sprintf("library-server responded with status %d: %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrUnavailable:
+		return e.unavailable()
+	}
+	return false
+}
+
+// unavailable reports whether the library-server failed rather than refused
+// the request, so trying again later may succeed
+func (e *APIError) unavailable() bool {
+	return e.StatusCode == http.StatusTooManyRequests || e.StatusCode >= 500
+}
@@ -0,0 +1,58 @@
+package libraryclient
+
+import (
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// knownSignature is what the library-server computes for the request in
+// TestSignRequestMatchesLibraryServer; see its service auth middleware tests
+const knownSignature = "7caa17d732e8e92e8b6a0c1eb94c131efef06416cc5a7ac578f78ed8856e4096"
+
+func TestSignRequestMatchesLibraryServer(t *testing.T) {
+	signature := signRequest("test-secret", http.MethodPost, "/receipts/?user=1", "1700000000", []byte(`{"book_id":1}`))
+	if got := hex.EncodeToString(signature); got != knownSignature {
+		t.Errorf("got signature %s, want %s", got, knownSignature)
+	}
+}
+
+func TestSigningTransportSignsWhatIsSent(t *testing.T) {
+	const body = `{"user_id":1,"book_id":1}`
+	var received *http.Request
+	var receivedBody []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r
+		receivedBody, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	client := &http.Client{Transport: newSigningTransport(ServiceName, "test-secret", nil)}
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/receipts/?user=1", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if string(receivedBody) != body {
+		t.Errorf("server got body %q, want %q", receivedBody, body)
+	}
+	if name := received.Header.Get("X-Service-Name"); name != ServiceName {
+		t.Errorf("got service name %q, want %q", name, ServiceName)
+	}
+	timestamp := received.Header.Get("X-Service-Timestamp")
+	want := hex.EncodeToString(signRequest("test-secret", http.MethodPost, "/receipts/?user=1", timestamp, []byte(body)))
+	if got := received.Header.Get("X-Service-Signature"); got != want {
+		t.Errorf("got signature %s, want %s", got, want)
+	}
+	if req.Header.Get("X-Service-Signature") != "" {
+		t.Error("the caller's request was modified")
+	}
+}
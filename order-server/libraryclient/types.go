@@ -0,0 +1,10 @@
+package libraryclient
+
+// BookQuery is a search of the library's books; empty filters match every book
+type BookQuery struct {
+	Page     int
+	PageSize int
+	Author   string
+	Category string
+	Title    string
+}
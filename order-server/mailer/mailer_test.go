@@ -0,0 +1,162 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var testMessage = Message{To: "reader@example.com", Subject: "Hello", Body: "Line one\nLine two\n"}
+
+func TestFromEnv(t *testing.T) {
+	cases := []struct {
+		name    string
+		env     map[string]string
+		want    interface{}
+		wantErr bool
+	}{
+		{"default", map[string]string{}, &FileMailer{}, false},
+		{"file", map[string]string{"MAILER": "file", "MAIL_OUTBOX_DIR": t.TempDir()}, &FileMailer{}, false},
+		{"smtp", map[string]string{"MAILER": "smtp", "SMTP_HOST": "localhost", "SMTP_PORT": "2525"}, &SMTPMailer{}, false},
+		{"smtp without a port", map[string]string{"MAILER": "smtp", "SMTP_HOST": "localhost"}, nil, true},
+		{"unknown", map[string]string{"MAILER": "pigeon"}, nil, true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"MAILER", "MAIL_FROM", "MAIL_OUTBOX_DIR", "SMTP_HOST", "SMTP_PORT", "SMTP_USERNAME", "SMTP_PASSWORD"} {
+				t.Setenv(key, tc.env[key])
+			}
+			mailer, err := FromEnv()
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tc.wantErr)
+			}
+			switch tc.want.(type) {
+			case *FileMailer:
+				if _, ok := mailer.(*FileMailer); !ok {
+					t.Errorf("got %T, want a file mailer", mailer)
+				}
+			case *SMTPMailer:
+				if m, ok := mailer.(*SMTPMailer); !ok || m.addr != "localhost:2525" || m.auth != nil {
+					t.Errorf("got %#v, want an unauthenticated SMTP mailer for localhost:2525", mailer)
+				}
+			}
+		})
+	}
+}
+
+func TestFileMailerWritesOneFilePerEmail(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	mailer := NewFileMailer(dir, "library@example.com")
+	for i := 0; i < 2; i++ {
+		if err := mailer.Send(context.Background(), testMessage); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("got %d files, want 2", len(files))
+	}
+	content, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "From: library@example.com\r\nTo: reader@example.com\r\nSubject: Hello\r\n"
+	if !strings.HasPrefix(string(content), want) || !strings.HasSuffix(string(content), "\r\n\r\n"+testMessage.Body) {
+		t.Errorf("got email %q", content)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := mailer.Send(ctx, testMessage); !errors.Is(err, context.Canceled) {
+		t.Errorf("canceled send: got %v, want %v", err, context.Canceled)
+	}
+}
+
+// fakeSMTPServer accepts one SMTP session and hands back the message data
+// it received
+func fakeSMTPServer(t *testing.T) (string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 fake ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 fake")
+			case command == "DATA":
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 queued")
+			case command == "QUIT":
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().String(), received
+}
+
+func TestSMTPMailerSendsTheMessage(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	portNumber, err := strconv.Atoi(port)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mailer := NewSMTPMailer(host, portNumber, "", "", "library@example.com")
+
+	if err := mailer.Send(context.Background(), testMessage); err != nil {
+		t.Fatal(err)
+	}
+	data := <-received
+	if !strings.Contains(data, "To: reader@example.com\r\n") || !strings.Contains(data, "Subject: Hello\r\n") {
+		t.Errorf("relay got %q", data)
+	}
+	if !strings.HasSuffix(data, "Line one\r\nLine two\r\n") {
+		t.Errorf("relay got body %q", data)
+	}
+}
@@ -1,15 +1,42 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
-	"os"
+	"order-server/service"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt"
 )
 
+// Context keys Authenticate stores the caller's user ID and token claims under
+const (
+	userIDKey = "userID"
+	claimsKey = "claims"
+)
+
+// UserID returns the ID of the user whose token authenticated the request
+func UserID(c *gin.Context) (uint, bool) {
+	userID, ok := c.Get(userIDKey)
+	if !ok {
+		return 0, false
+	}
+	id, ok := userID.(uint)
+	return id, ok
+}
+
+// Claims returns the claims of the token that authenticated the request
+func Claims(c *gin.Context) (*service.UserClaims, bool) {
+	claims, ok := c.Get(claimsKey)
+	if !ok {
+		return nil, false
+	}
+	userClaims, ok := claims.(*service.UserClaims)
+	return userClaims, ok
+}
+
 func Authenticate() gin.HandlerFunc {
+	authService := service.NewAuthService()
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
@@ -26,12 +53,8 @@ func Authenticate() gin.HandlerFunc {
 		}
 
 		tokenString := bearerToken[1]
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, jwt.ErrSignatureInvalid
-			}
-			return []byte(os.Getenv("JWT_SECRET")), nil
-		})
+		claims := &service.UserClaims{}
+		token, err := service.SigningKeys.Parse(tokenString, claims)
 
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
@@ -39,14 +62,51 @@ func Authenticate() gin.HandlerFunc {
 			return
 		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			userID := claims["id"].(string)
-			c.Set("userID", userID)
-			c.Next()
-		} else {
+		if !token.Valid || claims.UserID == 0 {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
 			c.Abort()
 			return
 		}
+
+		if err := authService.ValidateToken(c.Request.Context(), claims); err != nil {
+			if errors.Is(err, service.ErrTokenRevoked) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify token"})
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set(userIDKey, claims.UserID)
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail only lets through users who have confirmed their email
+// address. It must run after Authenticate.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	authService := service.NewAuthService()
+	return func(c *gin.Context) {
+		userID, ok := UserID(c)
+		if !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		verified, err := authService.EmailVerified(c.Request.Context(), userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email verification"})
+			c.Abort()
+			return
+		}
+		if !verified {
+			c.JSON(http.StatusForbidden, gin.H{"error": service.ErrEmailNotVerified.Error()})
+			c.Abort()
+			return
+		}
+		c.Next()
 	}
 }
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"order-server/service"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// staffClaimsKey is the context key AuthenticateStaff stores the admin's claims under
+const staffClaimsKey = "staffClaims"
+
+// StaffAdminID returns the ID of the library admin whose token authenticated the request
+func StaffAdminID(c *gin.Context) (uint, bool) {
+	claims, ok := c.Get(staffClaimsKey)
+	if !ok {
+		return 0, false
+	}
+	staffClaims, ok := claims.(*service.StaffClaims)
+	if !ok {
+		return 0, false
+	}
+	return staffClaims.AdminID, true
+}
+
+// AuthenticateStaff accepts access tokens issued by library-server to admins
+// holding permission
+func AuthenticateStaff(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		bearerToken := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(bearerToken) != 2 || strings.ToLower(bearerToken[0]) != "bearer" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
+			c.Abort()
+			return
+		}
+
+		claims, err := service.VerifyStaffToken(bearerToken[1])
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			c.Abort()
+			return
+		}
+		if !claims.HasPermission(permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing permission " + permission})
+			c.Abort()
+			return
+		}
+
+		c.Set(staffClaimsKey, claims)
+		c.Next()
+	}
+}
+
+// AuthenticateUserOrStaff accepts a user's access token like Authenticate, or
+// a library admin's holding permission like AuthenticateStaff. Handlers tell
+// the two apart with StaffAdminID.
+func AuthenticateUserOrStaff(permission string) gin.HandlerFunc {
+	user := Authenticate()
+	staff := AuthenticateStaff(permission)
+	return func(c *gin.Context) {
+		if staffToken(c) {
+			staff(c)
+		} else {
+			user(c)
+		}
+	}
+}
+
+// staffToken reports whether the request's bearer token claims to come from
+// library-server. The claim is only used to pick the verifier.
+func staffToken(c *gin.Context) bool {
+	bearerToken := strings.Split(c.GetHeader("Authorization"), " ")
+	if len(bearerToken) != 2 {
+		return false
+	}
+	claims := jwt.RegisteredClaims{}
+	if _, _, err := jwt.NewParser().ParseUnverified(bearerToken[1], &claims); err != nil {
+		return false
+	}
+	return claims.Issuer == service.StaffTokenIssuer
+}
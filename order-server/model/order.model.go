@@ -0,0 +1,65 @@
+package model
+
+import "time"
+
+// OrderStatus is where an order is in placing all of its books
+type OrderStatus string
+
+const (
+	// OrderStatusPlacing orders are waiting for the library-server to reserve
+	// their books
+	OrderStatusPlacing OrderStatus = "placing"
+	// OrderStatusPlaced orders hold a pending receipt for every book
+	OrderStatusPlaced OrderStatus = "placed"
+	// OrderStatusCompensating orders failed and are canceling the receipts
+	// they already got
+	OrderStatusCompensating OrderStatus = "compensating"
+	// OrderStatusFailed orders failed and hold no receipts
+	OrderStatusFailed OrderStatus = "failed"
+)
+
+// OrderLineStatus is where a single book of an order is
+type OrderLineStatus string
+
+const (
+	// OrderLineReserving lines asked the library-server for a receipt and are
+	// waiting for the answer
+	OrderLineReserving OrderLineStatus = "reserving"
+	OrderLineReserved  OrderLineStatus = "reserved"
+	// OrderLineFailed lines were refused by the library-server, see Error
+	OrderLineFailed OrderLineStatus = "failed"
+	// OrderLineReleasing lines asked the library-server to cancel their
+	// receipt because the order failed
+	OrderLineReleasing OrderLineStatus = "releasing"
+	// OrderLineReleased lines no longer hold their receipt
+	OrderLineReleased OrderLineStatus = "released"
+)
+
+// Order is a user's request for several books at once. It is placed all or
+// nothing: either every line ends up with a pending receipt on the
+// library-server or none does.
+type Order struct {
+	ID            uint        `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        uint        `gorm:"not null;index" json:"user_id"`
+	Status        OrderStatus `gorm:"not null;index" json:"status"`
+	FailureReason string      `json:"failure_reason,omitempty"`
+	Lines         []OrderLine `gorm:"foreignKey:OrderID" json:"lines"`
+	CreatedAt     time.Time   `json:"created_at"`
+	UpdatedAt     time.Time   `json:"updated_at"`
+}
+
+// OrderLine is one book of an order and the receipt reserved for it.
+// RequestID identifies the line's commands to the library-server, which
+// carries out each of them only once; SentAt is when the command the line is
+// waiting on was last published, or nil while it still has to be.
+type OrderLine struct {
+	ID        uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	OrderID   uint            `gorm:"not null;index" json:"order_id"`
+	BookID    uint            `gorm:"not null" json:"book_id"`
+	Status    OrderLineStatus `gorm:"not null;index" json:"status"`
+	RequestID string          `gorm:"index" json:"-"`
+	SentAt    *time.Time      `json:"-"`
+	ReceiptID *uint           `gorm:"index" json:"receipt_id,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
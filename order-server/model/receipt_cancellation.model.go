@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// ReceiptCancellationStatus is where a user's request to cancel a receipt is
+type ReceiptCancellationStatus string
+
+const (
+	// ReceiptCancellationPending cancellations asked the library-server to
+	// cancel the receipt and are waiting for the answer
+	ReceiptCancellationPending ReceiptCancellationStatus = "canceling"
+	// ReceiptCancellationDone cancellations left the receipt canceled
+	ReceiptCancellationDone ReceiptCancellationStatus = "canceled"
+	// ReceiptCancellationFailed cancellations were refused by the
+	// library-server, see Error
+	ReceiptCancellationFailed ReceiptCancellationStatus = "failed"
+)
+
+// ReceiptCancellation is a user's request to cancel one of their pending
+// receipts. It is kept here and sent to the library-server as a command, so it
+// can be made while the library-server is down. RequestID and SentAt work as
+// they do for an OrderLine.
+type ReceiptCancellation struct {
+	ID        uint                      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint                      `gorm:"not null;index" json:"user_id"`
+	ReceiptID uint                      `gorm:"not null;index" json:"receipt_id"`
+	Status    ReceiptCancellationStatus `gorm:"not null;index" json:"status"`
+	RequestID string                    `gorm:"not null;unique" json:"-"`
+	SentAt    *time.Time                `json:"-"`
+	Error     string                    `json:"error,omitempty"`
+	CreatedAt time.Time                 `json:"created_at"`
+	UpdatedAt time.Time                 `json:"updated_at"`
+}
@@ -1,8 +1,12 @@
 package model
 
+import "time"
+
 type User struct {
-	ID       uint   `gorm:"primaryKey;autoIncrement" json:"id"`
-	Username string `json:"username"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID              uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	Username        string     `json:"username"`
+	Email           string     `json:"email"`
+	Password        string     `json:"-"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TokenVersion    int        `gorm:"not null;default:0" json:"-"`
 }
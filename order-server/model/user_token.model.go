@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// UserTokenPurpose is what a single-use user token can be redeemed for
+type UserTokenPurpose string
+
+const (
+	UserTokenEmailVerification UserTokenPurpose = "email_verification"
+	UserTokenPasswordReset     UserTokenPurpose = "password_reset"
+)
+
+// UserToken is a single-use, expiring token sent to a user by email. Only a
+// hash of the token is stored.
+type UserToken struct {
+	ID        uint             `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uint             `gorm:"not null;index" json:"user_id"`
+	Purpose   UserTokenPurpose `gorm:"not null" json:"purpose"`
+	TokenHash string           `gorm:"not null;unique" json:"-"`
+	ExpiresAt time.Time        `gorm:"not null" json:"expires_at"`
+	UsedAt    *time.Time       `json:"used_at,omitempty"`
+	CreatedAt time.Time        `json:"created_at"`
+}
@@ -2,17 +2,30 @@ package routes
 
 import (
 	"order-server/handler"
+	"order-server/mailer"
+	"order-server/middleware"
 	"order-server/service"
+	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AuthRoutes(router *gin.Engine) {
-	authHandler := handler.NewAuthHandler(service.NewAuthService())
+func AuthRoutes(router *gin.Engine, mail mailer.Mailer) {
+	accountService := service.NewAccountService(mail, os.Getenv("APP_BASE_URL"))
+	authHandler := handler.NewAuthHandler(service.NewAuthService(), accountService)
+
+	router.GET("/.well-known/jwks.json", authHandler.JWKS)
+	router.POST("/admin/users/:id/unlock", middleware.AuthenticateStaff(service.PermissionPatronsManage), authHandler.UnlockUser)
 
 	authGroup := router.Group("/auth")
 	{
 		authGroup.POST("/register", authHandler.Register)
 		authGroup.POST("/login", authHandler.Login)
+		authGroup.POST("/refresh", authHandler.Refresh)
+		authGroup.POST("/logout", middleware.Authenticate(), authHandler.Logout)
+		authGroup.GET("/verify-email", authHandler.VerifyEmail)
+		authGroup.POST("/resend-verification", middleware.Authenticate(), authHandler.ResendVerification)
+		authGroup.POST("/forgot-password", authHandler.ForgotPassword)
+		authGroup.POST("/reset-password", authHandler.ResetPassword)
 	}
 }
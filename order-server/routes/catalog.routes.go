@@ -0,0 +1,28 @@
+package routes
+
+import (
+	"order-server/handler"
+	"order-server/libraryclient"
+	"order-server/service"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func CatalogRoutes(router *gin.Engine) {
+	cacheTTL, err := time.ParseDuration(os.Getenv("CATALOG_CACHE_TTL"))
+	if err != nil {
+		cacheTTL = time.Minute
+	}
+	// Shelf locations are staff-only unless explicitly published
+	hideLocation := os.Getenv("CATALOG_HIDE_LOCATION") != "false"
+	// The catalog signs with its own read-only credential rather than the order-server's
+	library := libraryclient.New(libraryclient.ConfigFromEnv(libraryclient.CatalogServiceName, os.Getenv("CATALOG_SERVICE_SECRET")))
+	catalogService := service.NewCatalogService(library, cacheTTL, hideLocation)
+	catalogHandler := handler.NewCatalogHandler(catalogService)
+
+	catalog := router.Group("/catalog")
+	catalog.GET("/books", catalogHandler.SearchBooks)
+	catalog.GET("/books/:id", catalogHandler.GetBook)
+}
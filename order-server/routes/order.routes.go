@@ -0,0 +1,18 @@
+package routes
+
+import (
+	"order-server/handler"
+	"order-server/middleware"
+	"order-server/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+func OrderRoutes(router *gin.Engine, orderService *service.OrderService) {
+	orderHandler := handler.NewOrderHandler(orderService)
+
+	orders := router.Group("/orders", middleware.Authenticate())
+	orders.POST("", middleware.RequireVerifiedEmail(), orderHandler.PlaceOrder)
+	orders.GET("", orderHandler.GetOrders)
+	orders.GET("/:id", orderHandler.GetOrder)
+}
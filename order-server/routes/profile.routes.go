@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"order-server/handler"
+	"order-server/libraryclient"
+	"order-server/mailer"
+	"order-server/middleware"
+	"order-server/service"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ProfileRoutes(router *gin.Engine, mail mailer.Mailer, library *libraryclient.Client) {
+	accountService := service.NewAccountService(mail, os.Getenv("APP_BASE_URL"))
+	userService := service.NewUserService(library)
+	profileHandler := handler.NewProfileHandler(service.NewProfileService(accountService, userService))
+
+	me := router.Group("/me", middleware.Authenticate())
+	me.GET("", profileHandler.GetProfile)
+	me.PATCH("", profileHandler.UpdateProfile)
+	me.DELETE("", profileHandler.DeleteAccount)
+	me.PUT("/password", profileHandler.ChangePassword)
+	me.GET("/export", profileHandler.ExportAccount)
+}
@@ -2,18 +2,28 @@ package routes
 
 import (
 	"order-server/handler"
+	"order-server/libraryclient"
+	"order-server/middleware"
 	"order-server/service"
-	"os"
 
 	"github.com/gin-gonic/gin"
 )
 
-func UserRoutes(router *gin.Engine) {
-	baseURL := os.Getenv("LIBRARY_SERVER_URL")
-	userService := service.NewUserService(baseURL)
-	userHandler := handler.NewUserHandler(userService)
+func UserRoutes(router *gin.Engine, library *libraryclient.Client, orderService *service.OrderService) {
+	userService := service.NewUserService(library)
+	userHandler := handler.NewUserHandler(userService, orderService)
 
-	router.POST("/receipts", userHandler.PlaceReceipt)
-	router.POST("/receipts/:id/cancel", userHandler.CancelReceipt)
-	router.GET("/receipts", userHandler.GetReceiptsByUserID)
+	authorized := router.Group("/", middleware.Authenticate())
+	authorized.POST("/receipts", middleware.RequireVerifiedEmail(), userHandler.PlaceReceipt)
+	authorized.GET("/receipts", userHandler.GetReceiptsByUserID)
+	authorized.GET("/receipts/:id/cancellation", userHandler.GetReceiptCancellation)
+	authorized.POST("/holds", middleware.RequireVerifiedEmail(), userHandler.PlaceHold)
+	authorized.GET("/holds", userHandler.GetHoldsByUserID)
+	authorized.GET("/fines", userHandler.GetFineBalance)
+
+	// Library staff may also read and cancel single receipts and holds of any user
+	router.GET("/receipts/:id", middleware.AuthenticateUserOrStaff(service.PermissionReceiptsRead), userHandler.GetReceipt)
+	router.POST("/receipts/:id/cancel", middleware.AuthenticateUserOrStaff(service.PermissionReceiptsWrite), userHandler.CancelReceipt)
+	router.GET("/holds/:id", middleware.AuthenticateUserOrStaff(service.PermissionHoldsRead), userHandler.GetHold)
+	router.DELETE("/holds/:id", middleware.AuthenticateUserOrStaff(service.PermissionHoldsWrite), userHandler.CancelHold)
 }
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"library-contract/session"
+	"log"
+	"net/url"
+	db "order-server/DB"
+	"order-server/mailer"
+	"order-server/model"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lifetimes of the tokens sent by email
+const (
+	emailVerificationTTL = 48 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
+var (
+	ErrInvalidUserToken     = errors.New("invalid or expired token")
+	ErrEmailAlreadyVerified = errors.New("email is already verified")
+	ErrEmailNotVerified     = errors.New("email address has not been verified")
+)
+
+// AccountService handles email verification and password resets
+type AccountService struct {
+	mailer  mailer.Mailer
+	baseURL string
+}
+
+// NewAccountService creates an AccountService that sends links pointing at baseURL
+func NewAccountService(mailer mailer.Mailer, baseURL string) *AccountService {
+	return &AccountService{mailer: mailer, baseURL: baseURL}
+}
+
+// SendVerificationEmail emails the user a link that confirms their address
+func (s *AccountService) SendVerificationEmail(ctx context.Context, user *model.User) error {
+	token, err := issueUserToken(ctx, user.ID, model.UserTokenEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/auth/verify-email?token=%s", s.baseURL, url.QueryEscape(token))
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your email address",
+		Body: fmt.Sprintf("Hello %s,\n\nOpen the link below to confirm your email address. It expires in %s.\n\n%s\n",
+			user.Username, emailVerificationTTL, link),
+	})
+}
+
+// ResendVerificationEmail sends a fresh verification link, invalidating earlier ones
+func (s *AccountService) ResendVerificationEmail(ctx context.Context, userID uint) error {
+	var user model.User
+	if err := db.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		return err
+	}
+	if user.EmailVerifiedAt != nil {
+		return ErrEmailAlreadyVerified
+	}
+	return s.SendVerificationEmail(ctx, &user)
+}
+
+// VerifyEmail redeems a verification token and marks the user's email verified
+func (s *AccountService) VerifyEmail(ctx context.Context, token string) error {
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stored, err := redeemUserToken(tx, token, model.UserTokenEmailVerification)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&model.User{}).
+			Where("id = ? AND email_verified_at IS NULL", stored.UserID).
+			Update("email_verified_at", time.Now()).Error
+	})
+}
+
+// RequestPasswordReset emails a reset link to the user with the given email.
+// Unknown addresses are ignored so the response does not reveal who has an account.
+func (s *AccountService) RequestPasswordReset(ctx context.Context, email string) error {
+	var user model.User
+	err := db.DB.WithContext(ctx).Where("email = ?", email).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Password reset requested for unknown email")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := issueUserToken(ctx, user.ID, model.UserTokenPasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/auth/reset-password?token=%s", s.baseURL, url.QueryEscape(token))
+	return s.mailer.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nSomeone asked to reset your password. If it was you, use the link below to choose a new one. It expires in %s.\n\n%s\n\nIf it was not you, you can ignore this email.\n",
+			user.Username, passwordResetTTL, link),
+	})
+}
+
+// ResetPassword redeems a reset token and sets a new password. Every existing
+// session of the user is revoked. Receiving the email also proves the user
+// owns the address, so it counts as verified.
+func (s *AccountService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stored, err := redeemUserToken(tx, token, model.UserTokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		err = tx.Model(&model.User{}).Where("id = ?", stored.UserID).Updates(map[string]interface{}{
+			"password":          string(hash),
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+		}).Error
+		if err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, stored.UserID)
+	})
+}
+
+// issueUserToken creates a single-use token for purpose, invalidating any
+// earlier unused token the user has for the same purpose
+func issueUserToken(ctx context.Context, userID uint, purpose model.UserTokenPurpose, ttl time.Duration) (string, error) {
+	token, err := session.RandomToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&model.UserToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(&model.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: session.HashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// redeemUserToken marks an unused, unexpired token for purpose as used
+func redeemUserToken(tx *gorm.DB, token string, purpose model.UserTokenPurpose) (*model.UserToken, error) {
+	var stored model.UserToken
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("token_hash = ? AND purpose = ?", session.HashToken(token), purpose).
+		Take(&stored).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrInvalidUserToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidUserToken
+	}
+	if err := tx.Model(&stored).Update("used_at", time.Now()).Error; err != nil {
+		return nil, err
+	}
+	return &stored, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	db "order-server/DB"
+	"order-server/dbtest"
+	"order-server/mailer"
+	"order-server/model"
+)
+
+// fakeMailer keeps the emails it is asked to send
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=(\S+)`)
+
+// lastToken returns the token in the link of the last email sent to address
+func (m *fakeMailer) lastToken(t *testing.T, address string) string {
+	t.Helper()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := len(m.sent) - 1; i >= 0; i-- {
+		if m.sent[i].To != address {
+			continue
+		}
+		match := linkToken.FindStringSubmatch(m.sent[i].Body)
+		if match == nil {
+			t.Fatalf("no link in %q", m.sent[i].Body)
+		}
+		token, err := url.QueryUnescape(match[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	t.Fatalf("no email was sent to %s", address)
+	return ""
+}
+
+func TestVerifyEmail(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	mail := &fakeMailer{}
+	accounts := NewAccountService(mail, "https://library.example.com")
+	auth := NewAuthService()
+	ctx := context.Background()
+	user := createTestUser(t, "reader")
+
+	if err := accounts.SendVerificationEmail(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	first := mail.lastToken(t, user.Email)
+	if err := accounts.ResendVerificationEmail(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	second := mail.lastToken(t, user.Email)
+
+	// Sending a new link invalidates the earlier one
+	if err := accounts.VerifyEmail(ctx, first); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("superseded link: got %v, want %v", err, ErrInvalidUserToken)
+	}
+	if verified, _ := auth.EmailVerified(ctx, user.ID); verified {
+		t.Fatal("the email was verified before the link was used")
+	}
+	if err := accounts.VerifyEmail(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if verified, err := auth.EmailVerified(ctx, user.ID); err != nil || !verified {
+		t.Errorf("got verified %v, %v after following the link", verified, err)
+	}
+
+	if err := accounts.VerifyEmail(ctx, second); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("using the link twice: got %v, want %v", err, ErrInvalidUserToken)
+	}
+	if err := accounts.ResendVerificationEmail(ctx, user.ID); !errors.Is(err, ErrEmailAlreadyVerified) {
+		t.Errorf("resending once verified: got %v, want %v", err, ErrEmailAlreadyVerified)
+	}
+}
+
+func TestResetPassword(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	mail := &fakeMailer{}
+	accounts := NewAccountService(mail, "https://library.example.com")
+	auth := NewAuthService()
+	ctx := context.Background()
+	user := createTestUser(t, "reader")
+	before := logIn(t, auth, user)
+
+	if err := accounts.RequestPasswordReset(ctx, "nobody@example.com"); err != nil {
+		t.Errorf("unknown address: %v", err)
+	}
+	if len(mail.sent) != 0 {
+		t.Fatalf("sent %d emails for an unknown address", len(mail.sent))
+	}
+	if err := accounts.RequestPasswordReset(ctx, user.Email); err != nil {
+		t.Fatal(err)
+	}
+	token := mail.lastToken(t, user.Email)
+
+	// Verification links cannot reset passwords
+	if err := accounts.SendVerificationEmail(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.ResetPassword(ctx, mail.lastToken(t, user.Email), "new password"); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("verification link: got %v, want %v", err, ErrInvalidUserToken)
+	}
+
+	if err := accounts.ResetPassword(ctx, token, "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := auth.Login(ctx, user.Username, "password", "192.0.2.1"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("old password: got %v, want %v", err, ErrInvalidCredentials)
+	}
+	if _, _, err := auth.Login(ctx, user.Username, "new password", "192.0.2.1"); err != nil {
+		t.Errorf("new password: %v", err)
+	}
+	if accepted(t, auth, before.AccessToken) {
+		t.Error("a session from before the reset is still accepted")
+	}
+	if verified, _ := auth.EmailVerified(ctx, user.ID); !verified {
+		t.Error("receiving the reset email did not verify the address")
+	}
+	if err := accounts.ResetPassword(ctx, token, "another password"); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("using the link twice: got %v, want %v", err, ErrInvalidUserToken)
+	}
+
+	if err := accounts.RequestPasswordReset(ctx, user.Email); err != nil {
+		t.Fatal(err)
+	}
+	expired := mail.lastToken(t, user.Email)
+	if err := db.DB.Model(&model.UserToken{}).Where("used_at IS NULL").Update("expires_at", time.Now().Add(-time.Minute)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := accounts.ResetPassword(ctx, expired, "another password"); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("expired link: got %v, want %v", err, ErrInvalidUserToken)
+	}
+}
@@ -3,15 +3,56 @@ package service
 import (
 	"context"
 	"errors"
+	"library-contract/session"
+	"library-contract/signing"
+	"library-contract/throttle"
+	"log"
 	db "order-server/DB"
 	"order-server/model"
-	"os"
 	"time"
 
-	"github.com/golang-jwt/jwt"
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
+var (
+	ErrInvalidRefreshToken = session.ErrInvalidRefreshToken
+	ErrTokenRevoked        = errors.New("token has been revoked")
+)
+
+// TokenIssuer is the iss claim of the access tokens this server signs
+const TokenIssuer = "order-server"
+
+// SigningKeys signs and verifies this server's tokens once LoadSigningKeys has run
+var SigningKeys *signing.KeySet
+
+// LoadSigningKeys loads the keys configured with JWT_SIGNING_KEY and
+// JWT_RETIRED_KEYS; see signing.LoadKeySet for how to rotate them
+func LoadSigningKeys() error {
+	keys, err := signing.LoadKeySet(TokenIssuer)
+	if err != nil {
+		return err
+	}
+	SigningKeys = keys
+	return nil
+}
+
+// UserClaims are the claims of the access tokens issued to users. Version must
+// match the user's token version for the token to be accepted.
+type UserClaims struct {
+	UserID  uint `json:"id"`
+	Version int  `json:"ver"`
+	jwt.RegisteredClaims
+}
+
+// TokenPair is what a successful login or refresh hands back to the user
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
 type AuthService struct{}
 
 func NewAuthService() *AuthService {
@@ -40,26 +81,169 @@ func (s *AuthService) Register(ctx context.Context, user *model.User) error {
 	return nil
 }
 
-func (s *AuthService) Login(ctx context.Context, username, password string) (*model.User, string, error) {
+// dummyPasswordHash is compared against when the username is unknown, so that
+// a failed login takes as long whether or not the account exists
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not-a-real-password"), bcrypt.DefaultCost)
+
+// Login checks a user's credentials and starts a session. Failed attempts are
+// counted per account and per client address ip, and either gets locked out
+// after too many of them.
+func (s *AuthService) Login(ctx context.Context, username, password, ip string) (*model.User, *TokenPair, error) {
+	if err := throttle.Check(db.DB.WithContext(ctx), throttle.AccountSubject(username), throttle.IPSubject(ip)); err != nil {
+		return nil, nil, err
+	}
+
 	var user model.User
-	if result := db.DB.Where("username = ?", username).First(&user); result.Error != nil {
-		return nil, "", errors.New("user not found")
+	hash := dummyPasswordHash
+	if result := db.DB.WithContext(ctx).Where("username = ?", username).First(&user); result.Error == nil {
+		hash = []byte(user.Password)
 	}
 
 	// Compare the provided password with the stored hashed password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
-		return nil, "", errors.New("invalid password")
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || user.ID == 0 {
+		throttle.RecordFailure(db.DB.WithContext(ctx), username, ip)
+		return nil, nil, ErrInvalidCredentials
 	}
+	throttle.Clear(db.DB.WithContext(ctx), throttle.AccountSubject(username))
+
+	// Start a new session with its own refresh token
+	var tokens *TokenPair
+	err := db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		refreshToken, _, err := session.IssueRefreshToken(tx, user.ID)
+		if err != nil {
+			return err
+		}
+		tokens, err = issueAccessToken(&user, refreshToken)
+		return err
+	})
+	if err != nil {
+		return nil, nil, errors.New("failed to generate token")
+	}
+
+	// Return user and tokens
+	return &user, tokens, nil
+}
+
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Presenting a refresh token that was already used means it leaked, so
+// every session of its user is revoked.
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	var tokens *TokenPair
+	var reused bool
+	err := db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stored, err := session.UseRefreshToken(tx, refreshToken)
+		if errors.Is(err, session.ErrRefreshTokenReused) {
+			reused = true
+			return revokeUserSessions(tx, stored.OwnerID)
+		}
+		if err != nil {
+			return err
+		}
 
-	// Generate JWT token
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"id":  user.ID,
-		"exp": time.Now().Add(time.Hour * 24).Unix(),
-	}).SignedString([]byte(os.Getenv("JWT_SECRET")))
+		var user model.User
+		if err := tx.First(&user, stored.OwnerID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+
+		next, err := session.RotateRefreshToken(tx, stored)
+		if err != nil {
+			return err
+		}
+		tokens, err = issueAccessToken(&user, next)
+		return err
+	})
 	if err != nil {
-		return nil, "", errors.New("failed to generate token")
+		return nil, err
 	}
+	if reused {
+		log.Printf("Refresh token reuse detected, all sessions revoked")
+		return nil, ErrInvalidRefreshToken
+	}
+	return tokens, nil
+}
 
-	// Return user and token
-	return &user, token, nil
+// Logout revokes the access token described by claims and, when given, the
+// refresh token of the same session
+func (s *AuthService) Logout(ctx context.Context, claims *UserClaims, refreshToken string) error {
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := session.Logout(tx, claims.UserID, claims.ID, claims.ExpiresAt.Time, refreshToken); err != nil {
+			return err
+		}
+		// Revoked tokens are only needed until they would have expired anyway
+		return tx.Where("expires_at < ?", time.Now()).Delete(&session.RevokedToken{}).Error
+	})
+}
+
+// RevokeSessions invalidates every access and refresh token of a user, for
+// example after their password changes
+func (s *AuthService) RevokeSessions(ctx context.Context, userID uint) error {
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return revokeUserSessions(tx, userID)
+	})
+}
+
+// ValidateToken checks that an access token has not been revoked, either by
+// logging out or by revoking all of the user's sessions since it was issued
+func (s *AuthService) ValidateToken(ctx context.Context, claims *UserClaims) error {
+	var user model.User
+	if err := db.DB.WithContext(ctx).Select("id", "token_version").First(&user, claims.UserID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrTokenRevoked
+		}
+		return err
+	}
+	if user.TokenVersion != claims.Version {
+		return ErrTokenRevoked
+	}
+
+	revoked, err := session.AccessTokenRevoked(db.DB.WithContext(ctx), claims.ID)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+// EmailVerified reports whether the user has confirmed their email address
+func (s *AuthService) EmailVerified(ctx context.Context, userID uint) (bool, error) {
+	var user model.User
+	if err := db.DB.WithContext(ctx).Select("id", "email_verified_at").First(&user, userID).Error; err != nil {
+		return false, err
+	}
+	return user.EmailVerifiedAt != nil, nil
+}
+
+func revokeUserSessions(tx *gorm.DB, userID uint) error {
+	err := tx.Model(&model.User{}).Where("id = ?", userID).
+		Update("token_version", gorm.Expr("token_version + 1")).Error
+	if err != nil {
+		return err
+	}
+	return session.RevokeRefreshTokens(tx, userID)
+}
+
+func issueAccessToken(user *model.User, refreshToken string) (*TokenPair, error) {
+	jti, err := session.RandomToken(16)
+	if err != nil {
+		return nil, err
+	}
+	ttl := session.TTL("ACCESS_TOKEN_TTL", 15*time.Minute)
+	token, err := SigningKeys.Sign(UserClaims{
+		UserID:  user.ID,
+		Version: user.TokenVersion,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    TokenIssuer,
+			ID:        jti,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{AccessToken: token, RefreshToken: refreshToken, ExpiresIn: int64(ttl.Seconds())}, nil
 }
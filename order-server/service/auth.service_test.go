@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"order-server/dbtest"
+	"order-server/model"
+)
+
+// loadTestSigningKeys gives SigningKeys a throwaway key for the test
+func loadTestSigningKeys(t *testing.T) {
+	t.Helper()
+	t.Setenv("JWT_SIGNING_KEY", "")
+	t.Setenv("JWT_RETIRED_KEYS", "")
+	previous := SigningKeys
+	if err := LoadSigningKeys(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SigningKeys = previous })
+}
+
+// logIn starts a session for user, whose password is "password"
+func logIn(t *testing.T, auth *AuthService, user model.User) *TokenPair {
+	t.Helper()
+	_, tokens, err := auth.Login(context.Background(), user.Username, "password", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tokens
+}
+
+// userClaims parses an access token issued by this server
+func userClaims(t *testing.T, token string) *UserClaims {
+	t.Helper()
+	var claims UserClaims
+	if _, err := SigningKeys.Parse(token, &claims); err != nil {
+		t.Fatal(err)
+	}
+	return &claims
+}
+
+// accepted reports whether ValidateToken accepts an access token
+func accepted(t *testing.T, auth *AuthService, token string) bool {
+	t.Helper()
+	err := auth.ValidateToken(context.Background(), userClaims(t, token))
+	if err != nil && !errors.Is(err, ErrTokenRevoked) {
+		t.Fatal(err)
+	}
+	return err == nil
+}
+
+func TestRefreshRotatesTheToken(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	auth := NewAuthService()
+	ctx := context.Background()
+	user := createTestUser(t, "reader")
+	login := logIn(t, auth, user)
+
+	first, err := auth.Refresh(ctx, login.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RefreshToken == login.RefreshToken {
+		t.Error("refreshing handed back the same refresh token")
+	}
+	if claims := userClaims(t, first.AccessToken); claims.UserID != user.ID {
+		t.Errorf("got a token for user %d, want %d", claims.UserID, user.ID)
+	}
+	second, err := auth.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("refreshing with the rotated token: %v", err)
+	}
+	if !accepted(t, auth, second.AccessToken) {
+		t.Error("the refreshed access token was not accepted")
+	}
+
+	if _, err := auth.Refresh(ctx, "never-issued"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
+
+func TestReusedRefreshTokenRevokesEverySession(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	auth := NewAuthService()
+	ctx := context.Background()
+	user := createTestUser(t, "reader")
+	stolen := logIn(t, auth, user)
+	other := logIn(t, auth, user)
+
+	rotated, err := auth.Refresh(ctx, stolen.RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := auth.Refresh(ctx, stolen.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reusing a refresh token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+
+	for name, tokens := range map[string]*TokenPair{"rotated": rotated, "other": other} {
+		if accepted(t, auth, tokens.AccessToken) {
+			t.Errorf("the %s session's access token is still accepted", name)
+		}
+		if _, err := auth.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("the %s session's refresh token: got %v, want %v", name, err, ErrInvalidRefreshToken)
+		}
+	}
+}
+
+func TestLogoutEndsOnlyItsSession(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	auth := NewAuthService()
+	ctx := context.Background()
+	user := createTestUser(t, "reader")
+	leaving := logIn(t, auth, user)
+	staying := logIn(t, auth, user)
+
+	if err := auth.Logout(ctx, userClaims(t, leaving.AccessToken), leaving.RefreshToken); err != nil {
+		t.Fatal(err)
+	}
+	if accepted(t, auth, leaving.AccessToken) {
+		t.Error("the logged out access token is still accepted")
+	}
+	// Presenting a logged out refresh token is not a sign it leaked
+	if _, err := auth.Refresh(ctx, leaving.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("the logged out refresh token: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if !accepted(t, auth, staying.AccessToken) {
+		t.Error("logging out ended the other session")
+	}
+	if _, err := auth.Refresh(ctx, staying.RefreshToken); err != nil {
+		t.Errorf("refreshing the other session: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	apiv1 "library-contract/v1"
+	"order-server/libraryclient"
+	"sync"
+	"time"
+)
+
+// maxCatalogCacheEntries bounds how many distinct searches and books are cached
+const maxCatalogCacheEntries = 1000
+
+var ErrBookNotFound = errors.New("book not found")
+
+// CatalogQuery is a search of the catalog; empty filters match every book
+type CatalogQuery struct {
+	Page     int
+	PageSize int
+	Author   string
+	Category string
+	Title    string
+}
+
+// CatalogPage is one page of catalog search results
+type CatalogPage struct {
+	Books []CatalogBook `json:"books"`
+	Total int64         `json:"total"`
+	Pages int           `json:"pages"`
+}
+
+// CatalogBook is a book as patrons see it in the catalog
+type CatalogBook struct {
+	ID              uint             `json:"id"`
+	Title           string           `json:"title"`
+	Author          string           `json:"author"`
+	Category        *CatalogCategory `json:"category,omitempty"`
+	TotalCopies     int64            `json:"total_copies"`
+	AvailableCopies int64            `json:"available_copies"`
+	Copies          []CatalogCopy    `json:"copies,omitempty"`
+}
+
+// CatalogCategory is the category a catalog book belongs to
+type CatalogCategory struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+// CatalogCopy is a physical copy of a catalog book. Barcodes are never shown,
+// and the shelf location only when the catalog is configured to.
+type CatalogCopy struct {
+	ID        uint   `json:"id"`
+	Status    string `json:"status"`
+	Condition string `json:"condition"`
+	Location  string `json:"location,omitempty"`
+}
+
+// CatalogService serves the library's catalog to patrons by reading it from
+// the library-server with a credential that only grants read access to books
+type CatalogService struct {
+	library      *libraryclient.Client
+	hideLocation bool
+	cache        *responseCache
+}
+
+// NewCatalogService creates a CatalogService that reads books through library.
+// Responses are cached for cacheTTL, and shelf locations are left out when
+// hideLocation is set.
+func NewCatalogService(library *libraryclient.Client, cacheTTL time.Duration, hideLocation bool) *CatalogService {
+	return &CatalogService{
+		library:      library,
+		hideLocation: hideLocation,
+		cache:        newResponseCache(cacheTTL, maxCatalogCacheEntries),
+	}
+}
+
+// SearchBooks returns one page of the books matching query
+func (s *CatalogService) SearchBooks(ctx context.Context, query CatalogQuery) (*CatalogPage, error) {
+	key := fmt.Sprintf("search:%d:%d:%q:%q:%q", query.Page, query.PageSize, query.Author, query.Category, query.Title)
+	if cached, ok := s.cache.get(key); ok {
+		return cached.(*CatalogPage), nil
+	}
+
+	result, err := s.library.SearchBooks(ctx, libraryclient.BookQuery(query))
+	if err != nil {
+		return nil, err
+	}
+	page := CatalogPage{Books: make([]CatalogBook, len(result.Books)), Total: result.Total, Pages: result.Pages}
+	for i := range result.Books {
+		page.Books[i] = s.catalogBook(&result.Books[i])
+	}
+	s.cache.set(key, &page)
+	return &page, nil
+}
+
+// GetBook returns a book with its copies
+func (s *CatalogService) GetBook(ctx context.Context, bookID uint) (*CatalogBook, error) {
+	key := fmt.Sprintf("book:%d", bookID)
+	if cached, ok := s.cache.get(key); ok {
+		return cached.(*CatalogBook), nil
+	}
+
+	result, err := s.library.GetBook(ctx, bookID)
+	if errors.Is(err, libraryclient.ErrNotFound) {
+		return nil, ErrBookNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	book := s.catalogBook(result)
+	s.cache.set(key, &book)
+	return &book, nil
+}
+
+// catalogBook keeps only what patrons may see of a book
+func (s *CatalogService) catalogBook(book *apiv1.Book) CatalogBook {
+	result := CatalogBook{
+		ID:              book.ID,
+		Title:           book.Title,
+		Author:          book.Author,
+		TotalCopies:     book.TotalCopies,
+		AvailableCopies: book.AvailableCopies,
+	}
+	if book.Category != nil {
+		result.Category = &CatalogCategory{ID: book.Category.ID, Name: book.Category.Name}
+	}
+	for _, bookCopy := range book.Copies {
+		catalogCopy := CatalogCopy{ID: bookCopy.ID, Status: bookCopy.Status, Condition: bookCopy.Condition}
+		if !s.hideLocation {
+			catalogCopy.Location = bookCopy.Location
+		}
+		result.Copies = append(result.Copies, catalogCopy)
+	}
+	return result
+}
+
+// responseCache keeps decoded responses for a fixed time. When it is full,
+// expired entries are dropped, and if that is not enough it starts over.
+type responseCache struct {
+	mu         sync.Mutex
+	ttl        time.Duration
+	maxEntries int
+	entries    map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value     interface{}
+	expiresAt time.Time
+}
+
+func newResponseCache(ttl time.Duration, maxEntries int) *responseCache {
+	return &responseCache{ttl: ttl, maxEntries: maxEntries, entries: map[string]cacheEntry{}}
+}
+
+func (c *responseCache) get(key string) (interface{}, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.expiresAt) {
+		return nil, false
+	}
+	return entry.value, true
+}
+
+func (c *responseCache) set(key string, value interface{}) {
+	if c.ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.maxEntries {
+		now := time.Now()
+		for k, entry := range c.entries {
+			if now.After(entry.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= c.maxEntries {
+			c.entries = map[string]cacheEntry{}
+		}
+	}
+	c.entries[key] = cacheEntry{value: value, expiresAt: time.Now().Add(c.ttl)}
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	apiv1 "library-contract/v1"
+	"order-server/libraryclient"
+)
+
+// fakeCatalog serves book 1 with one shelved copy and counts the requests
+// that reach it
+type fakeCatalog struct {
+	requests atomic.Int64
+}
+
+var catalogBook = apiv1.Book{
+	ID: 1, Title: "Dune", Author: "Frank Herbert", CategoryID: 2,
+	Category:    &apiv1.Category{ID: 2, Name: "Fiction"},
+	TotalCopies: 1, AvailableCopies: 1,
+	Copies: []apiv1.Copy{{ID: 3, BookID: 1, Barcode: "LIB-0003", Location: "Shelf 4B", Condition: "good", Status: apiv1.CopyStatusAvailable}},
+}
+
+func (f *fakeCatalog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.requests.Add(1)
+	w.Header().Set("Content-Type", "application/json")
+	switch r.URL.Path {
+	case "/books/":
+		json.NewEncoder(w).Encode(apiv1.BookPage{Books: []apiv1.Book{catalogBook}, Total: 1, Pages: 1})
+	case "/books/1":
+		json.NewEncoder(w).Encode(catalogBook)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(apiv1.ErrorResponse{Error: "book not found"})
+	}
+}
+
+func newTestCatalogService(t *testing.T, cacheTTL time.Duration, hideLocation bool) (*CatalogService, *fakeCatalog) {
+	t.Helper()
+	library := &fakeCatalog{}
+	server := httptest.NewServer(library)
+	t.Cleanup(server.Close)
+	client := libraryclient.New(libraryclient.Config{
+		BaseURL:     server.URL,
+		ServiceName: libraryclient.CatalogServiceName,
+		Secret:      "catalog-secret",
+	})
+	return NewCatalogService(client, cacheTTL, hideLocation), library
+}
+
+func TestCatalogCachesResponses(t *testing.T) {
+	catalog, library := newTestCatalogService(t, 100*time.Millisecond, false)
+	ctx := context.Background()
+	query := CatalogQuery{Page: 1, PageSize: 10, Author: "Herbert"}
+
+	for i := 0; i < 2; i++ {
+		if _, err := catalog.SearchBooks(ctx, query); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := catalog.GetBook(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := library.requests.Load(); got != 2 {
+		t.Fatalf("the library was asked %d times, want once per search and book", got)
+	}
+
+	query.Title = "Dune"
+	if _, err := catalog.SearchBooks(ctx, query); err != nil {
+		t.Fatal(err)
+	}
+	if got := library.requests.Load(); got != 3 {
+		t.Errorf("the library was asked %d times, want a different search to reach it", got)
+	}
+
+	// Missing books are not cached
+	for i := 0; i < 2; i++ {
+		if _, err := catalog.GetBook(ctx, 9); !errors.Is(err, ErrBookNotFound) {
+			t.Errorf("missing book: got %v, want %v", err, ErrBookNotFound)
+		}
+	}
+	if got := library.requests.Load(); got != 5 {
+		t.Errorf("the library was asked %d times, want each lookup of a missing book to reach it", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	if _, err := catalog.GetBook(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := library.requests.Load(); got != 6 {
+		t.Errorf("the library was asked %d times, want an expired entry fetched again", got)
+	}
+}
+
+func TestCatalogWithoutCache(t *testing.T) {
+	catalog, library := newTestCatalogService(t, 0, false)
+	for i := 0; i < 2; i++ {
+		if _, err := catalog.GetBook(context.Background(), 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := library.requests.Load(); got != 2 {
+		t.Errorf("the library was asked %d times, want every request to reach it", got)
+	}
+}
+
+func TestCatalogShowsOnlyWhatPatronsMaySee(t *testing.T) {
+	for _, hideLocation := range []bool{false, true} {
+		catalog, _ := newTestCatalogService(t, time.Minute, hideLocation)
+		book, err := catalog.GetBook(context.Background(), 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := json.Marshal(book)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if strings.Contains(string(body), "LIB-0003") {
+			t.Errorf("the barcode is shown: %s", body)
+		}
+		if shown := strings.Contains(string(body), "Shelf 4B"); shown == hideLocation {
+			t.Errorf("with hideLocation %v the location is shown %v: %s", hideLocation, shown, body)
+		}
+		if book.Category == nil || book.Category.Name != "Fiction" || len(book.Copies) != 1 || book.Copies[0].Status != apiv1.CopyStatusAvailable {
+			t.Errorf("got %s, want the book with its category and copy", body)
+		}
+	}
+}
+
+func TestResponseCacheStaysBounded(t *testing.T) {
+	cache := newResponseCache(time.Minute, 2)
+	cache.set("a", 1)
+	cache.set("b", 2)
+	cache.set("c", 3)
+
+	if len(cache.entries) > 2 {
+		t.Errorf("the cache holds %d entries, want at most 2", len(cache.entries))
+	}
+	if value, ok := cache.get("c"); !ok || value != 3 {
+		t.Errorf("got %v, %v for the newest entry, want 3", value, ok)
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"library-contract/throttle"
+	db "order-server/DB"
+	"order-server/model"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrInvalidCredentials is returned for every failed login, whether the
+	// username is unknown or the password is wrong
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrUserNotFound       = errors.New("user not found")
+)
+
+// LoginLockedError is returned while the account or address a login comes
+// from is locked out
+type LoginLockedError = throttle.LockedError
+
+// UnlockUser lifts a lockout on a user account and records which library
+// admin lifted it
+func (s *AuthService) UnlockUser(ctx context.Context, userID uint, actorID *uint) error {
+	var user model.User
+	if err := db.DB.WithContext(ctx).First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+	return throttle.Unlock(db.DB.WithContext(ctx), throttle.AccountSubject(user.Username), actorID)
+}
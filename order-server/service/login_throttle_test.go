@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"library-contract/throttle"
+	db "order-server/DB"
+	"order-server/dbtest"
+)
+
+func TestLoginLocksTheAccountAfterRepeatedFailures(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	auth := NewAuthService()
+	ctx := context.Background()
+	user := createTestUser(t, "reader")
+	login := func(password, ip string) error {
+		_, _, err := auth.Login(ctx, user.Username, password, ip)
+		return err
+	}
+
+	for i := 0; i < 5; i++ {
+		if err := login("wrong", "192.0.2.1"); !errors.Is(err, ErrInvalidCredentials) {
+			t.Fatalf("failed login %d: got %v, want %v", i+1, err, ErrInvalidCredentials)
+		}
+	}
+	var locked *LoginLockedError
+	if err := login("password", "198.51.100.1"); !errors.As(err, &locked) || locked.RetryAfter <= 0 {
+		t.Fatalf("right password while locked: got %v, want a lockout", err)
+	}
+
+	adminID := uint(3)
+	if err := auth.UnlockUser(ctx, user.ID, &adminID); err != nil {
+		t.Fatal(err)
+	}
+	if err := login("password", "192.0.2.1"); err != nil {
+		t.Errorf("logging in after being unlocked: %v", err)
+	}
+	var unlocks int64
+	err := db.DB.Model(&throttle.LockoutEvent{}).
+		Where("subject = ? AND action = ? AND actor_id = ?", throttle.AccountSubject(user.Username), throttle.LockoutActionUnlocked, adminID).
+		Count(&unlocks).Error
+	if err != nil || unlocks != 1 {
+		t.Errorf("got %d unlock events (%v), want 1 by admin %d", unlocks, err, adminID)
+	}
+	if err := auth.UnlockUser(ctx, 9999, &adminID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("unlocking a missing user: got %v, want %v", err, ErrUserNotFound)
+	}
+}
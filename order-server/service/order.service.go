@@ -0,0 +1,537 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	apiv1 "library-contract/v1"
+	"log"
+	db "order-server/DB"
+	"order-server/model"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// MaxOrderBooks is the most books a single order may ask for
+const MaxOrderBooks = 10
+
+// commandResendAfter is how long a line waits for the library-server to
+// answer before its command is published again
+const commandResendAfter = 10 * time.Minute
+
+// cancelRequestSuffix tells a line's cancel command apart from its place
+// command, which shares the line's request ID
+const cancelRequestSuffix = "-cancel"
+
+var (
+	ErrOrderNotFound        = errors.New("order not found")
+	ErrCancellationNotFound = errors.New("no cancellation was requested for this receipt")
+	ErrEmptyOrder           = errors.New("an order needs at least one book")
+	ErrTooManyBooks         = fmt.Errorf("an order can have at most %d books", MaxOrderBooks)
+	ErrDuplicateBook        = errors.New("each book can only be ordered once")
+)
+
+// Broker is the part of broker.RabbitMQ the OrderService sends commands and
+// receives results through
+type Broker interface {
+	PublishMessage(queueName string, message interface{}) error
+	ConsumeMessages(queueName string, handler func([]byte) error) error
+}
+
+// OrderService places orders on the library-server as a saga run over
+// RabbitMQ: a PlaceReceiptRequested command is sent for every book, and once
+// one of them fails a CancelReceiptRequested undoes each receipt already
+// placed. It cancels single receipts for users with the same commands. Orders
+// and cancellations are kept here, so they can be taken while the
+// library-server is down and are carried out when it is back.
+type OrderService struct {
+	rabbitmq Broker
+}
+
+// NewOrderService creates an OrderService that sends its commands through rabbitmq
+func NewOrderService(rabbitmq Broker) *OrderService {
+	return &OrderService{rabbitmq: rabbitmq}
+}
+
+// PlaceOrder saves an order for every book in bookIDs and asks the
+// library-server to reserve them. The order is returned while still placing;
+// its outcome arrives later through HandleLibraryEvent.
+func (s *OrderService) PlaceOrder(ctx context.Context, userID uint, bookIDs []uint) (*model.Order, error) {
+	if len(bookIDs) == 0 {
+		return nil, ErrEmptyOrder
+	}
+	if len(bookIDs) > MaxOrderBooks {
+		return nil, ErrTooManyBooks
+	}
+	order := model.Order{UserID: userID, Status: model.OrderStatusPlacing}
+	seen := make(map[uint]bool, len(bookIDs))
+	for _, bookID := range bookIDs {
+		if seen[bookID] {
+			return nil, ErrDuplicateBook
+		}
+		seen[bookID] = true
+		requestID, err := newRequestID()
+		if err != nil {
+			return nil, err
+		}
+		order.Lines = append(order.Lines, model.OrderLine{BookID: bookID, Status: model.OrderLineReserving, RequestID: requestID})
+	}
+	err := db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Holds off account deletion until the order is saved
+		if _, err := lockUser(tx, userID, "SHARE"); err != nil {
+			return err
+		}
+		return tx.Create(&order).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Commands that cannot be published now are left to the dispatcher
+	for i := range order.Lines {
+		if err := s.sendCommand(order.UserID, &order.Lines[i]); err != nil {
+			log.Printf("Failed to send command for order %d, will retry: %v", order.ID, err)
+			break
+		}
+	}
+	return &order, nil
+}
+
+// GetOrder returns one of userID's orders with its lines
+func (s *OrderService) GetOrder(ctx context.Context, userID, orderID uint) (*model.Order, error) {
+	var order model.Order
+	err := db.DB.WithContext(ctx).Preload("Lines", orderLinesInOrder).
+		Where("id = ? AND user_id = ?", orderID, userID).
+		First(&order).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrOrderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// GetOrdersByUserID returns every order of userID, newest first
+func (s *OrderService) GetOrdersByUserID(ctx context.Context, userID uint) ([]model.Order, error) {
+	var orders []model.Order
+	err := db.DB.WithContext(ctx).Preload("Lines", orderLinesInOrder).
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Find(&orders).Error
+	return orders, err
+}
+
+// CancelReceipt asks the library-server to cancel one of userID's pending
+// receipts. The cancellation is returned while still pending; its outcome
+// arrives later through HandleLibraryEvent. Asking again while a cancellation
+// of the receipt is pending returns that one. The library-server refuses
+// receipts of other users as not found.
+func (s *OrderService) CancelReceipt(ctx context.Context, userID, receiptID uint) (*model.ReceiptCancellation, error) {
+	var cancellation model.ReceiptCancellation
+	err := db.DB.WithContext(ctx).
+		Where("user_id = ? AND receipt_id = ? AND status = ?", userID, receiptID, model.ReceiptCancellationPending).
+		First(&cancellation).Error
+	if err == nil {
+		return &cancellation, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	requestID, err := newRequestID()
+	if err != nil {
+		return nil, err
+	}
+	cancellation = model.ReceiptCancellation{
+		UserID:    userID,
+		ReceiptID: receiptID,
+		Status:    model.ReceiptCancellationPending,
+		RequestID: requestID,
+	}
+	err = db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := lockUser(tx, userID, "SHARE"); err != nil {
+			return err
+		}
+		return tx.Create(&cancellation).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	// A command that cannot be published now is left to the dispatcher
+	if err := s.sendCancellation(&cancellation); err != nil {
+		log.Printf("Failed to send cancellation %d, will retry: %v", cancellation.ID, err)
+	}
+	return &cancellation, nil
+}
+
+// GetReceiptCancellation returns the latest cancellation userID asked for of a receipt
+func (s *OrderService) GetReceiptCancellation(ctx context.Context, userID, receiptID uint) (*model.ReceiptCancellation, error) {
+	var cancellation model.ReceiptCancellation
+	err := db.DB.WithContext(ctx).
+		Where("user_id = ? AND receipt_id = ?", userID, receiptID).
+		Order("id DESC").
+		First(&cancellation).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ErrCancellationNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &cancellation, nil
+}
+
+// DispatchCommands publishes the commands of lines and cancellations that were
+// never sent, or that went unanswered for longer than commandResendAfter. The
+// library-server carries out each request only once, so sending one again is
+// harmless.
+func (s *OrderService) DispatchCommands() error {
+	var lines []orderLineWithUser
+	err := db.DB.Model(&model.OrderLine{}).
+		Select("order_lines.*, orders.user_id").
+		Joins("JOIN orders ON orders.id = order_lines.order_id").
+		Where("order_lines.status IN ?", []model.OrderLineStatus{model.OrderLineReserving, model.OrderLineReleasing}).
+		Where("order_lines.request_id <> ''").
+		Where("order_lines.sent_at IS NULL OR order_lines.sent_at < ?", time.Now().Add(-commandResendAfter)).
+		Order("order_lines.id").
+		Find(&lines).Error
+	if err != nil {
+		return err
+	}
+
+	for i := range lines {
+		if err := s.sendCommand(lines[i].UserID, &lines[i].OrderLine); err != nil {
+			return err
+		}
+	}
+
+	var cancellations []model.ReceiptCancellation
+	err = db.DB.Where("status = ?", model.ReceiptCancellationPending).
+		Where("sent_at IS NULL OR sent_at < ?", time.Now().Add(-commandResendAfter)).
+		Order("id").
+		Find(&cancellations).Error
+	if err != nil {
+		return err
+	}
+	for i := range cancellations {
+		if err := s.sendCancellation(&cancellations[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StartEventConsumer applies the result events the library-server publishes
+// on the order event queue as they arrive
+func (s *OrderService) StartEventConsumer() error {
+	return s.rabbitmq.ConsumeMessages(apiv1.OrderEventQueue, s.HandleLibraryEvent)
+}
+
+// StartDispatcher runs DispatchCommands now and then once per interval until
+// the process exits
+func (s *OrderService) StartDispatcher(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := s.DispatchCommands(); err != nil {
+				log.Printf("Dispatching order commands failed: %v", err)
+			}
+			<-ticker.C
+		}
+	}()
+	log.Printf("Dispatching order commands every %s", interval)
+}
+
+// HandleLibraryEvent applies a result event from the library-server to the
+// order line or cancellation it answers. Events are delivered at least once
+// and may arrive after the line moved on, so only those the line is waiting
+// for change it. Errors are returned when the event should be delivered again.
+func (s *OrderService) HandleLibraryEvent(body []byte) error {
+	var message apiv1.Message
+	if err := json.Unmarshal(body, &message); err != nil {
+		log.Printf("Dropping malformed library event: %v", err)
+		return nil
+	}
+
+	var requestID string
+	var apply func(order *model.Order, line *model.OrderLine)
+	switch message.Type {
+	case apiv1.MessageReceiptPlaced:
+		var event apiv1.ReceiptPlaced
+		if err := json.Unmarshal(message.Payload, &event); err != nil {
+			log.Printf("Dropping malformed %s %s: %v", message.Type, message.ID, err)
+			return nil
+		}
+		requestID = event.RequestID
+		apply = func(order *model.Order, line *model.OrderLine) {
+			if line.Status != model.OrderLineReserving {
+				return
+			}
+			receiptID := event.Receipt.ID
+			line.ReceiptID = &receiptID
+			line.SentAt = nil
+			if order.Status == model.OrderStatusPlacing {
+				line.Status = model.OrderLineReserved
+			} else {
+				// The order failed meanwhile, so the receipt goes back at once
+				line.Status = model.OrderLineReleasing
+			}
+		}
+	case apiv1.MessageReceiptPlacementFailed:
+		var event apiv1.ReceiptPlacementFailed
+		if err := json.Unmarshal(message.Payload, &event); err != nil {
+			log.Printf("Dropping malformed %s %s: %v", message.Type, message.ID, err)
+			return nil
+		}
+		requestID = event.RequestID
+		apply = func(order *model.Order, line *model.OrderLine) {
+			if line.Status != model.OrderLineReserving {
+				return
+			}
+			line.Status = model.OrderLineFailed
+			line.Error = event.Error
+			if order.Status == model.OrderStatusPlacing {
+				order.Status = model.OrderStatusCompensating
+				order.FailureReason = fmt.Sprintf("book %d: %s", line.BookID, event.Error)
+			}
+		}
+	case apiv1.MessageReceiptCanceled:
+		var event apiv1.ReceiptCanceled
+		if err := json.Unmarshal(message.Payload, &event); err != nil {
+			log.Printf("Dropping malformed %s %s: %v", message.Type, message.ID, err)
+			return nil
+		}
+		if !strings.HasSuffix(event.RequestID, cancelRequestSuffix) {
+			return applyCancellationEvent(event.RequestID, model.ReceiptCancellationDone, "")
+		}
+		requestID = strings.TrimSuffix(event.RequestID, cancelRequestSuffix)
+		apply = func(order *model.Order, line *model.OrderLine) {
+			if line.Status == model.OrderLineReleasing {
+				line.Status = model.OrderLineReleased
+			}
+		}
+	case apiv1.MessageReceiptCancellationFailed:
+		var event apiv1.ReceiptCancellationFailed
+		if err := json.Unmarshal(message.Payload, &event); err != nil {
+			log.Printf("Dropping malformed %s %s: %v", message.Type, message.ID, err)
+			return nil
+		}
+		if !strings.HasSuffix(event.RequestID, cancelRequestSuffix) {
+			return applyCancellationEvent(event.RequestID, model.ReceiptCancellationFailed, event.Error)
+		}
+		requestID = strings.TrimSuffix(event.RequestID, cancelRequestSuffix)
+		apply = func(order *model.Order, line *model.OrderLine) {
+			// A receipt that is gone or no longer pending was already released
+			if line.Status == model.OrderLineReleasing {
+				line.Status = model.OrderLineReleased
+				line.Error = event.Error
+			}
+		}
+	default:
+		log.Printf("Dropping library event %s of unknown type %q", message.ID, message.Type)
+		return nil
+	}
+
+	order, err := applyLineEvent(requestID, apply)
+	if err != nil || order == nil {
+		return err
+	}
+	// Receipts to give back are sent now; the dispatcher retries any that fail
+	for i := range order.Lines {
+		line := &order.Lines[i]
+		if line.Status == model.OrderLineReleasing && line.SentAt == nil {
+			if err := s.sendCommand(order.UserID, line); err != nil {
+				log.Printf("Failed to send command for order %d, will retry: %v", order.ID, err)
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// applyLineEvent locks the order of the line with requestID, lets apply
+// change the order and line, and then works out where the order stands. It
+// returns nil when no line has requestID.
+func applyLineEvent(requestID string, apply func(order *model.Order, line *model.OrderLine)) (*model.Order, error) {
+	if requestID == "" {
+		return nil, nil
+	}
+	var order model.Order
+	err := db.DB.Transaction(func(tx *gorm.DB) error {
+		var line model.OrderLine
+		if err := tx.Where("request_id = ?", requestID).First(&line).Error; err != nil {
+			return err
+		}
+		// Events for the same order are applied one at a time
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Preload("Lines", orderLinesInOrder).
+			First(&order, line.OrderID).Error
+		if err != nil {
+			return err
+		}
+
+		var changed *model.OrderLine
+		for i := range order.Lines {
+			if order.Lines[i].ID == line.ID {
+				changed = &order.Lines[i]
+			}
+		}
+		status := order.Status
+		apply(&order, changed)
+		if err := tx.Save(changed).Error; err != nil {
+			return err
+		}
+
+		if order.Status == model.OrderStatusCompensating && status == model.OrderStatusPlacing {
+			for i := range order.Lines {
+				line := &order.Lines[i]
+				if line.Status == model.OrderLineReserved {
+					line.Status = model.OrderLineReleasing
+					line.SentAt = nil
+					if err := tx.Save(line).Error; err != nil {
+						return err
+					}
+				}
+			}
+		}
+		order.Status = orderOutcome(&order)
+		if order.Status == status {
+			return nil
+		}
+		return tx.Model(&order).Updates(map[string]interface{}{
+			"status":         order.Status,
+			"failure_reason": order.FailureReason,
+		}).Error
+	})
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Dropping library event for unknown request %s", requestID)
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+// applyCancellationEvent settles the pending cancellation with requestID.
+// Cancellations that already settled, or that are unknown, are left alone.
+func applyCancellationEvent(requestID string, status model.ReceiptCancellationStatus, reason string) error {
+	result := db.DB.Model(&model.ReceiptCancellation{}).
+		Where("request_id = ? AND status = ?", requestID, model.ReceiptCancellationPending).
+		Updates(map[string]interface{}{"status": status, "error": reason, "sent_at": nil})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		log.Printf("Dropping library event for unknown or settled cancellation %s", requestID)
+	}
+	return nil
+}
+
+// orderOutcome is the status an order moves to once its lines settle: placed
+// when every book is reserved, failed when a compensating order holds no
+// receipt anymore
+func orderOutcome(order *model.Order) model.OrderStatus {
+	switch order.Status {
+	case model.OrderStatusPlacing:
+		for _, line := range order.Lines {
+			if line.Status != model.OrderLineReserved {
+				return order.Status
+			}
+		}
+		return model.OrderStatusPlaced
+	case model.OrderStatusCompensating:
+		for _, line := range order.Lines {
+			if line.Status == model.OrderLineReserving || line.Status == model.OrderLineReleasing {
+				return order.Status
+			}
+		}
+		return model.OrderStatusFailed
+	default:
+		return order.Status
+	}
+}
+
+// sendCommand publishes the command a line is waiting on and records when it
+// was sent
+func (s *OrderService) sendCommand(userID uint, line *model.OrderLine) error {
+	var message *apiv1.Message
+	var err error
+	switch line.Status {
+	case model.OrderLineReserving:
+		message, err = apiv1.NewMessage(apiv1.MessagePlaceReceiptRequested, apiv1.PlaceReceiptRequested{
+			RequestID: line.RequestID,
+			UserID:    userID,
+			BookID:    line.BookID,
+		})
+	case model.OrderLineReleasing:
+		message, err = apiv1.NewMessage(apiv1.MessageCancelReceiptRequested, apiv1.CancelReceiptRequested{
+			RequestID: line.RequestID + cancelRequestSuffix,
+			UserID:    userID,
+			ReceiptID: *line.ReceiptID,
+		})
+	default:
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := s.rabbitmq.PublishMessage(apiv1.LibraryCommandQueue, message); err != nil {
+		return err
+	}
+
+	sentAt := time.Now()
+	line.SentAt = &sentAt
+	// Only if the line still waits on this command; an answer may have beaten us here
+	return db.DB.Model(&model.OrderLine{}).
+		Where("id = ? AND status = ?", line.ID, line.Status).
+		Update("sent_at", sentAt).Error
+}
+
+// sendCancellation publishes the command of a pending cancellation and
+// records when it was sent
+func (s *OrderService) sendCancellation(cancellation *model.ReceiptCancellation) error {
+	message, err := apiv1.NewMessage(apiv1.MessageCancelReceiptRequested, apiv1.CancelReceiptRequested{
+		RequestID: cancellation.RequestID,
+		UserID:    cancellation.UserID,
+		ReceiptID: cancellation.ReceiptID,
+	})
+	if err != nil {
+		return err
+	}
+	if err := s.rabbitmq.PublishMessage(apiv1.LibraryCommandQueue, message); err != nil {
+		return err
+	}
+
+	sentAt := time.Now()
+	cancellation.SentAt = &sentAt
+	return db.DB.Model(&model.ReceiptCancellation{}).
+		Where("id = ? AND status = ?", cancellation.ID, model.ReceiptCancellationPending).
+		Update("sent_at", sentAt).Error
+}
+
+// orderLineWithUser is an order line with the user its order belongs to
+type orderLineWithUser struct {
+	model.OrderLine
+	UserID uint
+}
+
+func orderLinesInOrder(tx *gorm.DB) *gorm.DB {
+	return tx.Order("id")
+}
+
+// newRequestID returns a random ID for a line's commands
+func newRequestID() (string, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(id), nil
+}
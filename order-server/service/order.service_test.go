@@ -0,0 +1,495 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	apiv1 "library-contract/v1"
+	db "order-server/DB"
+	"order-server/dbtest"
+	"order-server/model"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeBroker records the commands published through it, and fails to publish
+// while down is set
+type fakeBroker struct {
+	mu       sync.Mutex
+	down     bool
+	commands []apiv1.Message
+}
+
+func (b *fakeBroker) PublishMessage(queueName string, message interface{}) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.down {
+		return errors.New("broker is down")
+	}
+	b.commands = append(b.commands, *message.(*apiv1.Message))
+	return nil
+}
+
+func (b *fakeBroker) ConsumeMessages(queueName string, handler func([]byte) error) error {
+	return nil
+}
+
+func (b *fakeBroker) setDown(down bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = down
+}
+
+// cancelCommands decodes every CancelReceiptRequested published so far
+func (b *fakeBroker) cancelCommands(t *testing.T) []apiv1.CancelReceiptRequested {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var payloads []apiv1.CancelReceiptRequested
+	for _, message := range b.commands {
+		if message.Type != apiv1.MessageCancelReceiptRequested {
+			continue
+		}
+		var payload apiv1.CancelReceiptRequested
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			t.Fatalf("decoding %s: %v", message.Type, err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+// placeCommands decodes every PlaceReceiptRequested published so far
+func (b *fakeBroker) placeCommands(t *testing.T) []apiv1.PlaceReceiptRequested {
+	t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var payloads []apiv1.PlaceReceiptRequested
+	for _, message := range b.commands {
+		if message.Type != apiv1.MessagePlaceReceiptRequested {
+			continue
+		}
+		var payload apiv1.PlaceReceiptRequested
+		if err := json.Unmarshal(message.Payload, &payload); err != nil {
+			t.Fatalf("decoding %s: %v", message.Type, err)
+		}
+		payloads = append(payloads, payload)
+	}
+	return payloads
+}
+
+// libraryEvent encodes a result event the way the library-server publishes it
+func libraryEvent(t *testing.T, messageType string, payload interface{}) []byte {
+	t.Helper()
+	message, err := apiv1.NewMessage(messageType, payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := json.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+// createTestUser stores a verified user whose password is "password"
+func createTestUser(t *testing.T, username string) model.User {
+	t.Helper()
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := model.User{Username: username, Email: username + "@example.com", Password: string(hash)}
+	if err := db.DB.Create(&user).Error; err != nil {
+		t.Fatalf("creating user: %v", err)
+	}
+	return user
+}
+
+func TestCancelReceiptSendsOneCommand(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	user := createTestUser(t, "reader")
+	broker := &fakeBroker{}
+	orders := NewOrderService(broker)
+	ctx := context.Background()
+
+	cancellation, err := orders.CancelReceipt(ctx, user.ID, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancellation.Status != model.ReceiptCancellationPending {
+		t.Fatalf("got status %s, want %s", cancellation.Status, model.ReceiptCancellationPending)
+	}
+	again, err := orders.CancelReceipt(ctx, user.ID, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != cancellation.ID {
+		t.Errorf("asking again created cancellation %d, want %d", again.ID, cancellation.ID)
+	}
+
+	commands := broker.cancelCommands(t)
+	if len(commands) != 1 {
+		t.Fatalf("got %d commands, want 1", len(commands))
+	}
+	command := commands[0]
+	if command.UserID != user.ID || command.ReceiptID != 7 || command.RequestID != cancellation.RequestID {
+		t.Errorf("got command %+v for cancellation %+v", command, cancellation)
+	}
+
+	event := libraryEvent(t, apiv1.MessageReceiptCanceled, apiv1.ReceiptCanceled{RequestID: command.RequestID, ReceiptID: 7})
+	for i := 0; i < 2; i++ {
+		if err := orders.HandleLibraryEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settled, err := orders.GetReceiptCancellation(ctx, user.ID, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settled.Status != model.ReceiptCancellationDone {
+		t.Errorf("got status %s, want %s", settled.Status, model.ReceiptCancellationDone)
+	}
+}
+
+func TestRefusedCancellationFails(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	owner := createTestUser(t, "owner")
+	other := createTestUser(t, "other")
+	broker := &fakeBroker{}
+	orders := NewOrderService(broker)
+	ctx := context.Background()
+
+	if _, err := orders.CancelReceipt(ctx, other.ID, 7); err != nil {
+		t.Fatal(err)
+	}
+	command := broker.cancelCommands(t)[0]
+	// The library-server answers a receipt of another user as not found
+	event := libraryEvent(t, apiv1.MessageReceiptCancellationFailed, apiv1.ReceiptCancellationFailed{
+		RequestID: command.RequestID, ReceiptID: 7, Error: "receipt not found", Code: apiv1.CodeReceiptNotFound,
+	})
+	if err := orders.HandleLibraryEvent(event); err != nil {
+		t.Fatal(err)
+	}
+
+	cancellation, err := orders.GetReceiptCancellation(ctx, other.ID, 7)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cancellation.Status != model.ReceiptCancellationFailed || cancellation.Error != "receipt not found" {
+		t.Errorf("got %s %q, want failed with the library's error", cancellation.Status, cancellation.Error)
+	}
+	if _, err := orders.GetReceiptCancellation(ctx, owner.ID, 7); !errors.Is(err, ErrCancellationNotFound) {
+		t.Errorf("owner sees another user's cancellation: %v", err)
+	}
+}
+
+func TestDispatchResendsUnsentCancellations(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	user := createTestUser(t, "reader")
+	broker := &fakeBroker{down: true}
+	orders := NewOrderService(broker)
+
+	cancellation, err := orders.CancelReceipt(context.Background(), user.ID, 7)
+	if err != nil {
+		t.Fatalf("a broker outage must not refuse the cancellation: %v", err)
+	}
+	if err := orders.DispatchCommands(); err == nil {
+		t.Fatal("dispatching while the broker is down succeeded")
+	}
+
+	broker.setDown(false)
+	if err := orders.DispatchCommands(); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.DispatchCommands(); err != nil {
+		t.Fatal(err)
+	}
+	commands := broker.cancelCommands(t)
+	if len(commands) != 1 || commands[0].RequestID != cancellation.RequestID {
+		t.Errorf("got commands %+v, want the cancellation sent once", commands)
+	}
+}
+
+func TestDeleteAccountWaitsForCommands(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	user := createTestUser(t, "reader")
+	broker := &fakeBroker{}
+	orders := NewOrderService(broker)
+	// The library is never reached while commands are in flight
+	profiles := NewProfileService(nil, nil)
+	ctx := context.Background()
+
+	order, err := orders.PlaceOrder(ctx, user.ID, []uint{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := profiles.DeleteAccount(ctx, user.ID, "password"); !errors.Is(err, ErrCommandsInFlight) {
+		t.Fatalf("deleting with an order placing: got %v, want %v", err, ErrCommandsInFlight)
+	}
+
+	event := libraryEvent(t, apiv1.MessageReceiptPlacementFailed, apiv1.ReceiptPlacementFailed{
+		RequestID: order.Lines[0].RequestID, Error: "no copy is available",
+	})
+	if err := orders.HandleLibraryEvent(event); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := orders.CancelReceipt(ctx, user.ID, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := profiles.DeleteAccount(ctx, user.ID, "password"); !errors.Is(err, ErrCommandsInFlight) {
+		t.Fatalf("deleting with a cancellation pending: got %v, want %v", err, ErrCommandsInFlight)
+	}
+}
+
+// deliver hands orders a library event and fails the test if it is not applied
+func deliver(t *testing.T, orders *OrderService, messageType string, payload interface{}) {
+	t.Helper()
+	if err := orders.HandleLibraryEvent(libraryEvent(t, messageType, payload)); err != nil {
+		t.Fatalf("handling %s: %v", messageType, err)
+	}
+}
+
+func TestPlaceOrderChecksTheBooks(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	user := createTestUser(t, "reader")
+	broker := &fakeBroker{}
+	orders := NewOrderService(broker)
+	ctx := context.Background()
+
+	tooMany := make([]uint, MaxOrderBooks+1)
+	for i := range tooMany {
+		tooMany[i] = uint(i + 1)
+	}
+	cases := []struct {
+		name    string
+		bookIDs []uint
+		want    error
+	}{
+		{"no books", nil, ErrEmptyOrder},
+		{"too many books", tooMany, ErrTooManyBooks},
+		{"the same book twice", []uint{3, 4, 3}, ErrDuplicateBook},
+	}
+	for _, tc := range cases {
+		if _, err := orders.PlaceOrder(ctx, user.ID, tc.bookIDs); !errors.Is(err, tc.want) {
+			t.Errorf("%s: got %v, want %v", tc.name, err, tc.want)
+		}
+	}
+	if commands := broker.placeCommands(t); len(commands) != 0 {
+		t.Errorf("refused orders sent %d commands", len(commands))
+	}
+}
+
+func TestOrderIsPlacedOnceEveryBookIsReserved(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	user := createTestUser(t, "reader")
+	broker := &fakeBroker{}
+	orders := NewOrderService(broker)
+	ctx := context.Background()
+
+	order, err := orders.PlaceOrder(ctx, user.ID, []uint{3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if order.Status != model.OrderStatusPlacing {
+		t.Fatalf("got status %s, want %s", order.Status, model.OrderStatusPlacing)
+	}
+	commands := broker.placeCommands(t)
+	if len(commands) != 2 {
+		t.Fatalf("got %d commands, want one per book", len(commands))
+	}
+	for i, command := range commands {
+		line := order.Lines[i]
+		if command.RequestID != line.RequestID || command.UserID != user.ID || command.BookID != line.BookID {
+			t.Errorf("got command %+v for line %+v", command, line)
+		}
+	}
+
+	deliver(t, orders, apiv1.MessageReceiptPlaced, apiv1.ReceiptPlaced{
+		RequestID: commands[0].RequestID, Receipt: apiv1.Receipt{ID: 10, UserID: user.ID, BookID: 3},
+	})
+	if placing, _ := orders.GetOrder(ctx, user.ID, order.ID); placing.Status != model.OrderStatusPlacing {
+		t.Errorf("got status %s with one book reserved, want %s", placing.Status, model.OrderStatusPlacing)
+	}
+	deliver(t, orders, apiv1.MessageReceiptPlaced, apiv1.ReceiptPlaced{
+		RequestID: commands[1].RequestID, Receipt: apiv1.Receipt{ID: 11, UserID: user.ID, BookID: 4},
+	})
+
+	placed, err := orders.GetOrder(ctx, user.ID, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if placed.Status != model.OrderStatusPlaced {
+		t.Fatalf("got status %s, want %s", placed.Status, model.OrderStatusPlaced)
+	}
+	for i, receiptID := range []uint{10, 11} {
+		line := placed.Lines[i]
+		if line.Status != model.OrderLineReserved || line.ReceiptID == nil || *line.ReceiptID != receiptID {
+			t.Errorf("got line %+v, want it reserved with receipt %d", line, receiptID)
+		}
+	}
+	if _, err := orders.GetOrder(ctx, user.ID+1, order.ID); !errors.Is(err, ErrOrderNotFound) {
+		t.Errorf("another user's order: got %v, want %v", err, ErrOrderNotFound)
+	}
+}
+
+func TestFailedOrderReleasesItsReceipts(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	user := createTestUser(t, "reader")
+	broker := &fakeBroker{}
+	orders := NewOrderService(broker)
+	ctx := context.Background()
+
+	order, err := orders.PlaceOrder(ctx, user.ID, []uint{3, 4, 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved, refused, late := order.Lines[0], order.Lines[1], order.Lines[2]
+
+	deliver(t, orders, apiv1.MessageReceiptPlaced, apiv1.ReceiptPlaced{
+		RequestID: reserved.RequestID, Receipt: apiv1.Receipt{ID: 10, UserID: user.ID, BookID: 3},
+	})
+	deliver(t, orders, apiv1.MessageReceiptPlacementFailed, apiv1.ReceiptPlacementFailed{
+		RequestID: refused.RequestID, Error: "no copy is available",
+	})
+	compensating, err := orders.GetOrder(ctx, user.ID, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if compensating.Status != model.OrderStatusCompensating || compensating.FailureReason != "book 4: no copy is available" {
+		t.Errorf("got status %s with reason %q, want it compensating for book 4", compensating.Status, compensating.FailureReason)
+	}
+	if line := compensating.Lines[0]; line.Status != model.OrderLineReleasing {
+		t.Errorf("the reserved line is %s, want %s", line.Status, model.OrderLineReleasing)
+	}
+	cancels := broker.cancelCommands(t)
+	if len(cancels) != 1 || cancels[0].ReceiptID != 10 || cancels[0].RequestID != reserved.RequestID+cancelRequestSuffix {
+		t.Fatalf("got cancel commands %+v, want receipt 10 given back", cancels)
+	}
+
+	// A receipt placed after the order failed is given back at once
+	deliver(t, orders, apiv1.MessageReceiptPlaced, apiv1.ReceiptPlaced{
+		RequestID: late.RequestID, Receipt: apiv1.Receipt{ID: 12, UserID: user.ID, BookID: 5},
+	})
+	cancels = broker.cancelCommands(t)
+	if len(cancels) != 2 || cancels[1].ReceiptID != 12 {
+		t.Fatalf("got cancel commands %+v, want receipt 12 given back too", cancels)
+	}
+
+	deliver(t, orders, apiv1.MessageReceiptCanceled, apiv1.ReceiptCanceled{RequestID: cancels[0].RequestID, ReceiptID: 10})
+	if still, _ := orders.GetOrder(ctx, user.ID, order.ID); still.Status != model.OrderStatusCompensating {
+		t.Errorf("got status %s with a receipt still held, want %s", still.Status, model.OrderStatusCompensating)
+	}
+	// A receipt that is gone already counts as given back
+	deliver(t, orders, apiv1.MessageReceiptCancellationFailed, apiv1.ReceiptCancellationFailed{
+		RequestID: cancels[1].RequestID, ReceiptID: 12, Error: "receipt is no longer pending",
+	})
+
+	failed, err := orders.GetOrder(ctx, user.ID, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if failed.Status != model.OrderStatusFailed {
+		t.Fatalf("got status %s, want %s", failed.Status, model.OrderStatusFailed)
+	}
+	want := []model.OrderLineStatus{model.OrderLineReleased, model.OrderLineFailed, model.OrderLineReleased}
+	for i, line := range failed.Lines {
+		if line.Status != want[i] {
+			t.Errorf("line for book %d is %s, want %s", line.BookID, line.Status, want[i])
+		}
+	}
+}
+
+func TestDispatchResendsUnansweredOrderCommands(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	user := createTestUser(t, "reader")
+	broker := &fakeBroker{down: true}
+	orders := NewOrderService(broker)
+
+	order, err := orders.PlaceOrder(context.Background(), user.ID, []uint{3, 4})
+	if err != nil {
+		t.Fatalf("a broker outage must not refuse the order: %v", err)
+	}
+	broker.setDown(false)
+	if err := orders.DispatchCommands(); err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.DispatchCommands(); err != nil {
+		t.Fatal(err)
+	}
+	if commands := broker.placeCommands(t); len(commands) != 2 {
+		t.Fatalf("got %d commands, want each unsent line sent once", len(commands))
+	}
+
+	// A line the library-server never answered is sent again, with the same request ID
+	deliver(t, orders, apiv1.MessageReceiptPlaced, apiv1.ReceiptPlaced{
+		RequestID: order.Lines[0].RequestID, Receipt: apiv1.Receipt{ID: 10, UserID: user.ID, BookID: 3},
+	})
+	err = db.DB.Model(&model.OrderLine{}).Where("order_id = ?", order.ID).
+		Update("sent_at", time.Now().Add(-commandResendAfter-time.Minute)).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := orders.DispatchCommands(); err != nil {
+		t.Fatal(err)
+	}
+	commands := broker.placeCommands(t)
+	if len(commands) != 3 || commands[2].RequestID != order.Lines[1].RequestID {
+		t.Errorf("got commands %+v, want only the unanswered line sent again", commands)
+	}
+}
+
+func TestUnusableLibraryEventsAreDropped(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	user := createTestUser(t, "reader")
+	orders := NewOrderService(&fakeBroker{})
+	ctx := context.Background()
+	order, err := orders.PlaceOrder(ctx, user.ID, []uint{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	events := map[string][]byte{
+		"not JSON":          []byte("{"),
+		"unknown type":      libraryEvent(t, "BookBurned", map[string]string{"request_id": order.Lines[0].RequestID}),
+		"malformed payload": []byte(`{"id":"1","type":"ReceiptPlaced","payload":"not an object"}`),
+		"unknown request":   libraryEvent(t, apiv1.MessageReceiptPlaced, apiv1.ReceiptPlaced{RequestID: "unknown", Receipt: apiv1.Receipt{ID: 10}}),
+		"without a request": libraryEvent(t, apiv1.MessageReceiptPlacementFailed, apiv1.ReceiptPlacementFailed{Error: "no copy is available"}),
+	}
+	for name, event := range events {
+		if err := orders.HandleLibraryEvent(event); err != nil {
+			t.Errorf("%s: got %v, want it dropped", name, err)
+		}
+	}
+	unchanged, err := orders.GetOrder(ctx, user.ID, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if unchanged.Status != model.OrderStatusPlacing || unchanged.Lines[0].Status != model.OrderLineReserving {
+		t.Errorf("got order %s with line %s, want it untouched", unchanged.Status, unchanged.Lines[0].Status)
+	}
+
+	// An answer delivered again after the line moved on changes nothing
+	placed := libraryEvent(t, apiv1.MessageReceiptPlaced, apiv1.ReceiptPlaced{
+		RequestID: order.Lines[0].RequestID, Receipt: apiv1.Receipt{ID: 10, UserID: user.ID, BookID: 3},
+	})
+	refused := libraryEvent(t, apiv1.MessageReceiptPlacementFailed, apiv1.ReceiptPlacementFailed{
+		RequestID: order.Lines[0].RequestID, Error: "no copy is available",
+	})
+	for _, event := range [][]byte{placed, placed, refused} {
+		if err := orders.HandleLibraryEvent(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settled, err := orders.GetOrder(ctx, user.ID, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if settled.Status != model.OrderStatusPlaced || settled.Lines[0].Status != model.OrderLineReserved {
+		t.Errorf("got order %s with line %s, want it placed", settled.Status, settled.Lines[0].Status)
+	}
+}
@@ -0,0 +1,294 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"library-contract/session"
+	"library-contract/throttle"
+	apiv1 "library-contract/v1"
+	"log"
+	db "order-server/DB"
+	"order-server/model"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrUsernameTaken     = errors.New("username is already taken")
+	ErrEmailTaken        = errors.New("email is already in use")
+	ErrIncorrectPassword = errors.New("current password is incorrect")
+	ErrCommandsInFlight  = errors.New("wait for your orders and receipt cancellations to finish first")
+)
+
+// ProfileUpdate lists the profile fields to change; nil fields are left alone
+type ProfileUpdate struct {
+	Username *string
+	Email    *string
+}
+
+// AccountExport is everything kept about a user, across both servers
+type AccountExport struct {
+	ExportedAt    time.Time
+	User          *model.User
+	Orders        []model.Order
+	Cancellations []model.ReceiptCancellation
+	Receipts      []apiv1.Receipt
+	Holds         []apiv1.Hold
+	Fines         *apiv1.FineBalance
+}
+
+// ProfileService lets users manage their own account
+type ProfileService struct {
+	accountService *AccountService
+	userService    *UserService
+}
+
+// NewProfileService creates a ProfileService that sends verification emails
+// through accountService and reaches the library-server through userService
+func NewProfileService(accountService *AccountService, userService *UserService) *ProfileService {
+	return &ProfileService{accountService: accountService, userService: userService}
+}
+
+// GetProfile returns the profile of a user
+func (s *ProfileService) GetProfile(ctx context.Context, userID uint) (*model.User, error) {
+	return findUser(db.DB.WithContext(ctx), userID)
+}
+
+// UpdateProfile changes a user's username and email. A new email address has
+// to be verified again, so the user cannot place receipts or holds until they
+// follow the link sent to it, and reset links sent to the old one stop working.
+func (s *ProfileService) UpdateProfile(ctx context.Context, userID uint, update ProfileUpdate) (*model.User, error) {
+	var user *model.User
+	var oldUsername string
+	var emailChanged bool
+	err := db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		user, err = findUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		oldUsername = user.Username
+
+		changes := map[string]interface{}{}
+		if update.Username != nil && *update.Username != user.Username {
+			if err := checkUnique(tx, "username", *update.Username, userID, ErrUsernameTaken); err != nil {
+				return err
+			}
+			changes["username"] = *update.Username
+		}
+		if update.Email != nil && *update.Email != user.Email {
+			if err := checkUnique(tx, "email", *update.Email, userID, ErrEmailTaken); err != nil {
+				return err
+			}
+			changes["email"] = *update.Email
+			changes["email_verified_at"] = nil
+			emailChanged = true
+		}
+		if len(changes) == 0 {
+			return nil
+		}
+
+		if err := tx.Model(user).Updates(changes).Error; err != nil {
+			return err
+		}
+		if update.Username != nil {
+			user.Username = *update.Username
+		}
+		if !emailChanged {
+			return nil
+		}
+		user.Email = *update.Email
+		user.EmailVerifiedAt = nil
+		return tx.Model(&model.UserToken{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if user.Username != oldUsername {
+		// Failed logins were counted against the old name, which someone else may now take
+		throttle.Clear(db.DB.WithContext(ctx), throttle.AccountSubject(oldUsername))
+	}
+	if emailChanged {
+		if err := s.accountService.SendVerificationEmail(ctx, user); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", user.ID, err)
+		}
+	}
+	return user, nil
+}
+
+// ChangePassword sets a new password after checking the current one. Every
+// session of the user is revoked, including the one making the change.
+func (s *ProfileService) ChangePassword(ctx context.Context, userID uint, currentPassword, newPassword string) error {
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		user, err := findUser(tx, userID)
+		if err != nil {
+			return err
+		}
+		if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(currentPassword)) != nil {
+			return ErrIncorrectPassword
+		}
+		hash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(user).Update("password", string(hash)).Error; err != nil {
+			return err
+		}
+		return revokeUserSessions(tx, userID)
+	})
+}
+
+// DeleteAccount deletes a user after checking their password. The user's
+// receipts, holds and fines on the library-server are anonymized first, which
+// is refused while they still have books or owe fines. It is also refused
+// while orders or receipt cancellations still wait on the library-server, as
+// their commands could link new receipts to the user afterwards.
+func (s *ProfileService) DeleteAccount(ctx context.Context, userID uint, password string) error {
+	user, err := findUser(db.DB.WithContext(ctx), userID)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return ErrIncorrectPassword
+	}
+	if err := checkCommandsSettled(db.DB.WithContext(ctx), userID); err != nil {
+		return err
+	}
+
+	if err := s.userService.AnonymizeUser(ctx, userID); err != nil {
+		return err
+	}
+
+	return db.DB.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// Orders and cancellations lock the user too, so none start until we are done
+		if _, err := lockUser(tx, userID, "UPDATE"); err != nil {
+			return err
+		}
+		if err := checkCommandsSettled(tx, userID); err != nil {
+			return err
+		}
+		if err := session.DeleteRefreshTokens(tx, userID); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.UserToken{}).Error; err != nil {
+			return err
+		}
+		orderIDs := tx.Model(&model.Order{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Where("order_id IN (?)", orderIDs).Delete(&model.OrderLine{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.Order{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&model.ReceiptCancellation{}).Error; err != nil {
+			return err
+		}
+		if err := throttle.Forget(tx, throttle.AccountSubject(user.Username)); err != nil {
+			return err
+		}
+		// Access tokens of a deleted user fail validation, so none need revoking
+		return tx.Delete(&model.User{}, userID).Error
+	})
+}
+
+// Export gathers a user's profile and orders together with their full
+// borrowing history from the library-server
+func (s *ProfileService) Export(ctx context.Context, userID uint) (*AccountExport, error) {
+	user, err := s.GetProfile(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	var orders []model.Order
+	err = db.DB.WithContext(ctx).Preload("Lines", orderLinesInOrder).Where("user_id = ?", userID).Order("id").Find(&orders).Error
+	if err != nil {
+		return nil, err
+	}
+	var cancellations []model.ReceiptCancellation
+	err = db.DB.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&cancellations).Error
+	if err != nil {
+		return nil, err
+	}
+	receipts, err := s.userService.GetReceiptsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	holds, err := s.userService.GetHoldsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	fines, err := s.userService.GetFineBalance(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &AccountExport{
+		ExportedAt:    time.Now().UTC(),
+		User:          user,
+		Orders:        orders,
+		Cancellations: cancellations,
+		Receipts:      receipts,
+		Holds:         holds,
+		Fines:         fines,
+	}, nil
+}
+
+// checkCommandsSettled returns ErrCommandsInFlight while an order line or
+// receipt cancellation of userID still waits on the library-server
+func checkCommandsSettled(tx *gorm.DB, userID uint) error {
+	var lines int64
+	err := tx.Model(&model.OrderLine{}).
+		Joins("JOIN orders ON orders.id = order_lines.order_id").
+		Where("orders.user_id = ?", userID).
+		Where("order_lines.status IN ?", []model.OrderLineStatus{model.OrderLineReserving, model.OrderLineReleasing}).
+		Count(&lines).Error
+	if err != nil {
+		return err
+	}
+	var cancellations int64
+	err = tx.Model(&model.ReceiptCancellation{}).
+		Where("user_id = ? AND status = ?", userID, model.ReceiptCancellationPending).
+		Count(&cancellations).Error
+	if err != nil {
+		return err
+	}
+	if lines > 0 || cancellations > 0 {
+		return ErrCommandsInFlight
+	}
+	return nil
+}
+
+// lockUser locks the row of userID with strength, UPDATE or SHARE
+func lockUser(tx *gorm.DB, userID uint, strength string) (*model.User, error) {
+	return findUser(tx.Clauses(clause.Locking{Strength: strength}), userID)
+}
+
+func findUser(tx *gorm.DB, userID uint) (*model.User, error) {
+	var user model.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return &user, nil
+}
+
+// checkUnique returns taken when another user already has value in column
+func checkUnique(tx *gorm.DB, column, value string, userID uint, taken error) error {
+	var count int64
+	err := tx.Model(&model.User{}).
+		Where(column+" = ? AND id <> ?", value, userID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return taken
+	}
+	return nil
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"library-contract/session"
+	apiv1 "library-contract/v1"
+	db "order-server/DB"
+	"order-server/dbtest"
+	"order-server/libraryclient"
+	"order-server/model"
+)
+
+// fakePatronLibrary serves one receipt, one hold and a fine balance for
+// userID, and refuses to anonymize them while obligated is set
+type fakePatronLibrary struct {
+	userID uint
+
+	mu         sync.Mutex
+	obligated  bool
+	anonymized bool
+}
+
+func (f *fakePatronLibrary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch r.Method + " " + r.URL.Path {
+	case fmt.Sprintf("GET /receipts/user/%d", f.userID):
+		json.NewEncoder(w).Encode([]apiv1.Receipt{{ID: 5, UserID: f.userID, Status: apiv1.ReceiptStatusReturned}})
+	case fmt.Sprintf("GET /holds/user/%d", f.userID):
+		json.NewEncoder(w).Encode([]apiv1.Hold{{ID: 6, UserID: f.userID, Status: apiv1.HoldStatusWaiting}})
+	case fmt.Sprintf("GET /fines/user/%d", f.userID):
+		json.NewEncoder(w).Encode(apiv1.FineBalance{UserID: f.userID, BalanceCents: 150})
+	case fmt.Sprintf("DELETE /patrons/%d", f.userID):
+		if f.obligated {
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(apiv1.ErrorResponse{Error: "patron has books on loan"})
+			return
+		}
+		f.anonymized = true
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(apiv1.ErrorResponse{Error: "not found"})
+	}
+}
+
+// newTestProfileService wires a ProfileService to library and mail
+func newTestProfileService(t *testing.T, library http.Handler, mail *fakeMailer) *ProfileService {
+	t.Helper()
+	server := httptest.NewServer(library)
+	t.Cleanup(server.Close)
+	client := libraryclient.New(libraryclient.Config{
+		BaseURL:     server.URL,
+		ServiceName: libraryclient.ServiceName,
+		Secret:      "test-secret",
+	})
+	return NewProfileService(NewAccountService(mail, "https://library.example.com"), NewUserService(client))
+}
+
+func TestUpdateProfileRequiresVerifyingTheNewEmail(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	mail := &fakeMailer{}
+	profiles := newTestProfileService(t, &fakePatronLibrary{}, mail)
+	accounts := NewAccountService(mail, "https://library.example.com")
+	ctx := context.Background()
+	user := createTestUser(t, "reader")
+	createTestUser(t, "other")
+	if err := db.DB.Model(&user).Update("email_verified_at", time.Now()).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	taken, takenEmail := "other", "other@example.com"
+	if _, err := profiles.UpdateProfile(ctx, user.ID, ProfileUpdate{Username: &taken}); !errors.Is(err, ErrUsernameTaken) {
+		t.Errorf("taken username: got %v, want %v", err, ErrUsernameTaken)
+	}
+	if _, err := profiles.UpdateProfile(ctx, user.ID, ProfileUpdate{Email: &takenEmail}); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("taken email: got %v, want %v", err, ErrEmailTaken)
+	}
+
+	// Keeping the same address leaves it verified
+	sameEmail, newName := user.Email, "bookworm"
+	updated, err := profiles.UpdateProfile(ctx, user.ID, ProfileUpdate{Username: &newName, Email: &sameEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Username != newName || updated.EmailVerifiedAt == nil || len(mail.sent) != 0 {
+		t.Errorf("got %+v and %d emails, want only the username changed", updated, len(mail.sent))
+	}
+
+	if err := accounts.RequestPasswordReset(ctx, user.Email); err != nil {
+		t.Fatal(err)
+	}
+	resetToken := mail.lastToken(t, user.Email)
+	newEmail := "bookworm@example.com"
+	updated, err = profiles.UpdateProfile(ctx, user.ID, ProfileUpdate{Email: &newEmail})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Email != newEmail || updated.EmailVerifiedAt != nil {
+		t.Errorf("got %+v, want the new address unverified", updated)
+	}
+	if err := accounts.ResetPassword(ctx, resetToken, "new password"); !errors.Is(err, ErrInvalidUserToken) {
+		t.Errorf("reset link sent to the old address: got %v, want %v", err, ErrInvalidUserToken)
+	}
+	if err := accounts.VerifyEmail(ctx, mail.lastToken(t, newEmail)); err != nil {
+		t.Errorf("following the link sent to the new address: %v", err)
+	}
+}
+
+func TestChangePasswordRevokesEverySession(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	profiles := newTestProfileService(t, &fakePatronLibrary{}, &fakeMailer{})
+	auth := NewAuthService()
+	ctx := context.Background()
+	user := createTestUser(t, "reader")
+	tokens := logIn(t, auth, user)
+
+	if err := profiles.ChangePassword(ctx, user.ID, "wrong", "new password"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("wrong current password: got %v, want %v", err, ErrIncorrectPassword)
+	}
+	if err := profiles.ChangePassword(ctx, user.ID, "password", "new password"); err != nil {
+		t.Fatal(err)
+	}
+	if accepted(t, auth, tokens.AccessToken) {
+		t.Error("the session making the change is still accepted")
+	}
+	if _, err := auth.Refresh(ctx, tokens.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("refreshing after the change: got %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if _, _, err := auth.Login(ctx, user.Username, "new password", "192.0.2.1"); err != nil {
+		t.Errorf("logging in with the new password: %v", err)
+	}
+}
+
+func TestExportGathersBothServers(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	user := createTestUser(t, "reader")
+	profiles := newTestProfileService(t, &fakePatronLibrary{userID: user.ID}, &fakeMailer{})
+	orders := NewOrderService(&fakeBroker{})
+	ctx := context.Background()
+
+	order, err := orders.PlaceOrder(ctx, user.ID, []uint{3, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	export, err := profiles.Export(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if export.User.ID != user.ID || len(export.Orders) != 1 || export.Orders[0].ID != order.ID || len(export.Orders[0].Lines) != 2 {
+		t.Errorf("got user %+v and orders %+v, want the order placed", export.User, export.Orders)
+	}
+	if len(export.Receipts) != 1 || len(export.Holds) != 1 || export.Fines == nil || export.Fines.BalanceCents != 150 {
+		t.Errorf("got receipts %+v, holds %+v and fines %+v, want the library's records", export.Receipts, export.Holds, export.Fines)
+	}
+}
+
+func TestDeleteAccount(t *testing.T) {
+	dbtest.Connect(t, "service_test")
+	loadTestSigningKeys(t)
+	user := createTestUser(t, "reader")
+	library := &fakePatronLibrary{userID: user.ID, obligated: true}
+	profiles := newTestProfileService(t, library, &fakeMailer{})
+	orders := NewOrderService(&fakeBroker{})
+	auth := NewAuthService()
+	ctx := context.Background()
+	tokens := logIn(t, auth, user)
+
+	order, err := orders.PlaceOrder(ctx, user.ID, []uint{3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	event := libraryEvent(t, apiv1.MessageReceiptPlaced, apiv1.ReceiptPlaced{
+		RequestID: order.Lines[0].RequestID, Receipt: apiv1.Receipt{ID: 5, UserID: user.ID, BookID: 3},
+	})
+	if err := orders.HandleLibraryEvent(event); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := profiles.DeleteAccount(ctx, user.ID, "wrong"); !errors.Is(err, ErrIncorrectPassword) {
+		t.Errorf("wrong password: got %v, want %v", err, ErrIncorrectPassword)
+	}
+	if err := profiles.DeleteAccount(ctx, user.ID, "password"); !errors.Is(err, ErrLibraryObligated) {
+		t.Errorf("with books on loan: got %v, want %v", err, ErrLibraryObligated)
+	}
+	if _, err := profiles.GetProfile(ctx, user.ID); err != nil {
+		t.Fatalf("a refused deletion removed the user: %v", err)
+	}
+
+	library.mu.Lock()
+	library.obligated = false
+	library.mu.Unlock()
+	if err := profiles.DeleteAccount(ctx, user.ID, "password"); err != nil {
+		t.Fatal(err)
+	}
+	if !library.anonymized {
+		t.Error("the library-server was not asked to anonymize the user")
+	}
+	if _, err := profiles.GetProfile(ctx, user.ID); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("deleted user: got %v, want %v", err, ErrUserNotFound)
+	}
+	for name, table := range map[string]interface{}{"orders": &model.Order{}, "refresh tokens": &session.RefreshToken{}} {
+		var count int64
+		if err := db.DB.Model(table).Count(&count).Error; err != nil {
+			t.Fatal(err)
+		}
+		if count != 0 {
+			t.Errorf("%d %s are left", count, name)
+		}
+	}
+	if accepted(t, auth, tokens.AccessToken) {
+		t.Error("the deleted user's access token is still accepted")
+	}
+	// The username is free for someone else
+	createTestUser(t, "reader")
+}
@@ -1,102 +1,108 @@
 package service
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"time"
+	"errors"
+	apiv1 "library-contract/v1"
+	"order-server/libraryclient"
+)
+
+var (
+	ErrReceiptNotFound  = errors.New("receipt not found")
+	ErrHoldNotFound     = errors.New("hold not found")
+	ErrLibraryObligated = errors.New("return reserved or borrowed books and pay outstanding fines first")
 )
 
 type UserService struct {
-	client  *http.Client
-	baseURL string
+	library *libraryclient.Client
 }
 
-func NewUserService(baseURL string) *UserService {
-	return &UserService{
-		client:  &http.Client{},
-		baseURL: baseURL,
-	}
+// NewUserService creates a UserService that acts for users on the library-server
+func NewUserService(library *libraryclient.Client) *UserService {
+	return &UserService{library: library}
 }
 
-func (s *UserService) PlaceReceipt(ctx context.Context, userID, bookID uint) error {
-	url := fmt.Sprintf("%s/receipts", s.baseURL)
+// CancelAnyReceipt cancels a receipt whoever owns it, for library staff
+func (s *UserService) CancelAnyReceipt(ctx context.Context, receiptID uint) error {
+	return s.library.UpdateReceiptStatus(ctx, receiptID, apiv1.ReceiptStatusCanceled)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "POST", url, nil)
+// GetUserReceipt fetches a receipt of userID; other users' receipts are not found
+func (s *UserService) GetUserReceipt(ctx context.Context, userID, receiptID uint) (*apiv1.Receipt, error) {
+	receipt, err := s.GetReceiptByID(ctx, receiptID)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
-
-	req.Header.Set("Content-Type", "application/json")
-	req.Body = io.NopCloser(bytes.NewBuffer([]byte(fmt.Sprintf(`{"user_id": %d, "book_id": %d}`, userID, bookID))))
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+	if receipt.UserID != userID {
+		return nil, ErrReceiptNotFound
 	}
-	defer resp.Body.Close()
+	return receipt, nil
+}
 
-	if resp.StatusCode != http.StatusCreated {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+func (s *UserService) GetReceiptByID(ctx context.Context, receiptID uint) (*apiv1.Receipt, error) {
+	receipt, err := s.library.GetReceipt(ctx, receiptID)
+	if errors.Is(err, libraryclient.ErrNotFound) {
+		return nil, ErrReceiptNotFound
 	}
-
-	return nil
+	return receipt, err
 }
 
-func (s *UserService) CancelReceipt(ctx context.Context, receiptID uint) error {
-	url := fmt.Sprintf("%s/receipts/%d/status", s.baseURL, receiptID)
-
-	req, err := http.NewRequestWithContext(ctx, "PATCH", url, nil)
-	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
-	}
+func (s *UserService) GetReceiptsByUserID(ctx context.Context, userID uint) ([]apiv1.Receipt, error) {
+	return s.library.ListUserReceipts(ctx, userID)
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Body = io.NopCloser(bytes.NewBuffer([]byte(`{"status": "canceled"}`)))
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
-	}
-	defer resp.Body.Close()
+func (s *UserService) PlaceHold(ctx context.Context, userID, bookID uint) (*apiv1.Hold, error) {
+	return s.library.PlaceHold(ctx, apiv1.PlaceHoldRequest{UserID: userID, BookID: bookID})
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+// CancelHold takes userID's hold out of the queue; the hold must belong to them
+func (s *UserService) CancelHold(ctx context.Context, userID, holdID uint) error {
+	if _, err := s.GetUserHold(ctx, userID, holdID); err != nil {
+		return err
 	}
-
-	return nil
+	return s.CancelAnyHold(ctx, holdID)
 }
 
-func (s *UserService) GetReceiptsByUserID(ctx context.Context, userID uint) ([]Receipt, error) {
-	url := fmt.Sprintf("%s/receipts/user/%d", s.baseURL, userID)
+// CancelAnyHold takes a hold out of the queue whoever placed it, for library staff
+func (s *UserService) CancelAnyHold(ctx context.Context, holdID uint) error {
+	return s.library.CancelHold(ctx, holdID)
+}
 
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+// GetUserHold fetches a hold of userID; other users' holds are not found
+func (s *UserService) GetUserHold(ctx context.Context, userID, holdID uint) (*apiv1.Hold, error) {
+	hold, err := s.GetHoldByID(ctx, holdID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create request: %w", err)
+		return nil, err
 	}
-
-	resp, err := s.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("failed to send request: %w", err)
+	if hold.UserID != userID {
+		return nil, ErrHoldNotFound
 	}
-	defer resp.Body.Close()
+	return hold, nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+func (s *UserService) GetHoldByID(ctx context.Context, holdID uint) (*apiv1.Hold, error) {
+	hold, err := s.library.GetHold(ctx, holdID)
+	if errors.Is(err, libraryclient.ErrNotFound) {
+		return nil, ErrHoldNotFound
 	}
+	return hold, err
+}
 
-	var receipts []Receipt
-	if err := json.NewDecoder(resp.Body).Decode(&receipts); err != nil {
-		return nil, fmt.Errorf("failed to decode response: %w", err)
-	}
+func (s *UserService) GetHoldsByUserID(ctx context.Context, userID uint) ([]apiv1.Hold, error) {
+	return s.library.ListUserHolds(ctx, userID)
+}
 
-	return receipts, nil
+func (s *UserService) GetFineBalance(ctx context.Context, userID uint) (*apiv1.FineBalance, error) {
+	return s.library.GetFineBalance(ctx, userID)
 }
 
-type Receipt struct {
-	ID     uint      `json:"id"`
-	UserID uint      `json:"user_id"`
-	BookID uint      `json:"book_id"`
-	Date   time.Time `json:"date"`
+// AnonymizeUser asks the library-server to detach userID's receipts, holds and
+// fines from them. It fails with ErrLibraryObligated while the user still has
+// books reserved or on loan, or owes fines.
+func (s *UserService) AnonymizeUser(ctx context.Context, userID uint) error {
+	err := s.library.AnonymizePatron(ctx, userID)
+	if errors.Is(err, libraryclient.ErrConflict) {
+		return ErrLibraryObligated
+	}
+	return err
 }